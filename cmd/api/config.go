@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rudcode/go_image_converter_api/internal/fetch"
+	"github.com/rudcode/go_image_converter_api/internal/presets"
+	"github.com/rudcode/go_image_converter_api/internal/storage"
+	"github.com/rudcode/go_image_converter_api/internal/utils"
+)
+
+// Config holds the service settings, read from environment variables by loadConfig
+type Config struct {
+	// StorageRoot is the directory of the local storage backend, its sub-directories are the buckets
+	// (IMAGE_STORAGE_ROOT), the local storage is disabled when empty
+	StorageRoot string
+
+	// SigningSecret is the shared secret GET /img URLs must be signed with (IMAGE_SIGNING_SECRET),
+	// see pkg/urlsign, URLs are not verified when empty
+	SigningSecret string
+
+	// JobWorkers is the number of jobs processed concurrently (IMAGE_JOB_WORKERS), default to the number of CPUs
+	JobWorkers int
+
+	// JobQueueSize is the number of jobs waiting for a worker before POST /jobs answers 503
+	// (IMAGE_JOB_QUEUE_SIZE)
+	JobQueueSize int
+
+	// JobRetention is how long finished jobs and their results are kept (IMAGE_JOB_RETENTION)
+	JobRetention time.Duration
+
+	// CallbackSecret sign the job callbacks (IMAGE_CALLBACK_SECRET), see pkg/webhook,
+	// callbacks are sent unsigned when empty
+	CallbackSecret string
+
+	// CallbackMaxAttempts is the number of deliveries tried for each job callback (IMAGE_CALLBACK_MAX_ATTEMPTS)
+	CallbackMaxAttempts int
+
+	// CallbackWorkers is the number of job callbacks delivered concurrently (IMAGE_CALLBACK_WORKERS)
+	CallbackWorkers int
+
+	// CallbackQueueSize is the number of job callbacks waiting for a worker before they are dropped
+	// (IMAGE_CALLBACK_QUEUE_SIZE)
+	CallbackQueueSize int
+
+	// BatchWorkers is the number of files of a /batch request processed concurrently (IMAGE_BATCH_WORKERS),
+	// default to the number of CPUs
+	BatchWorkers int
+
+	// BatchMaxFiles is the maximum number of files of a /batch request (IMAGE_BATCH_MAX_FILES)
+	BatchMaxFiles int
+
+	// BatchMaxBytes is the maximum uncompressed size of the files of a /batch request (IMAGE_BATCH_MAX_BYTES)
+	BatchMaxBytes int64
+
+	// ThumbnailSizes are the named sizes accepted by /thumbnail (IMAGE_THUMBNAIL_SIZES),
+	// e.g. "small=128x128,medium=256x256,large=512x512"
+	ThumbnailSizes map[string]ThumbnailSize
+
+	// Presets are the named operation chains accepted as preset=<name> (IMAGE_PRESETS_FILE),
+	// loaded and validated at startup from a YAML or JSON file, none when unset
+	Presets presets.Presets
+
+	// Backend is the image processing backend (IMAGE_BACKEND): auto (ffmpeg when installed, go otherwise), ffmpeg or go,
+	// the operations the go backend doesn't support are answered with 501
+	Backend string
+
+	// CacheMemoryBytes is the total size of the responses cached in memory (IMAGE_CACHE_MEMORY_BYTES), 0 (the default) disable it
+	CacheMemoryBytes int64
+
+	// CacheDir is the directory of the disk cache tier (IMAGE_CACHE_DIR), disabled when empty
+	CacheDir string
+
+	// CacheDiskBytes is the total size of the responses cached in CacheDir (IMAGE_CACHE_DISK_BYTES)
+	CacheDiskBytes int64
+
+	// CacheControl is the Cache-Control header of the GET /img responses (IMAGE_CACHE_CONTROL)
+	CacheControl string
+
+	// StorageBackend hold the source and destination objects (IMAGE_STORAGE_BACKEND): local (buckets are
+	// the directories of StorageRoot) or s3
+	StorageBackend string
+
+	// S3 configure the s3 storage backend (IMAGE_S3_ENDPOINT, IMAGE_S3_REGION, IMAGE_S3_ACCESS_KEY_ID,
+	// IMAGE_S3_SECRET_ACCESS_KEY and IMAGE_S3_PATH_STYLE)
+	S3 storage.S3Config
+
+	// StorageBuckets are the buckets the source, destination and GET /img objects may use (IMAGE_STORAGE_BUCKETS),
+	// comma separated, every bucket is refused when empty
+	StorageBuckets []string
+
+	// StorageKeyPrefix is the prefix the keys of these objects must start with (IMAGE_STORAGE_KEY_PREFIX),
+	// e.g. "images/", any key is accepted when empty
+	StorageKeyPrefix string
+
+	// DestinationToken is the bearer token allowing the requests to write a destination (IMAGE_DESTINATION_TOKEN),
+	// without it destinations must be signed with SigningSecret, they are refused when both are empty
+	DestinationToken string
+
+	// SourceMaxBytes is the maximum size of the source objects and image_url downloads (IMAGE_SOURCE_MAX_BYTES)
+	SourceMaxBytes int64
+
+	// FetchTimeout bound the image_url downloads, redirects included (IMAGE_FETCH_TIMEOUT)
+	FetchTimeout time.Duration
+
+	// FetchMaxRedirects is the number of redirects followed by the image_url downloads (IMAGE_FETCH_MAX_REDIRECTS)
+	FetchMaxRedirects int
+
+	// FetchContentTypes are the media types accepted from image_url (IMAGE_FETCH_CONTENT_TYPES)
+	FetchContentTypes []string
+
+	// FetchAllowlist are the private networks image_url and the job callbacks may reach (IMAGE_FETCH_ALLOWLIST),
+	// e.g. "10.0.0.0/8,192.168.1.7", loopback, private and link-local addresses are refused otherwise
+	FetchAllowlist []netip.Prefix
+
+	// AdminToken is the bearer token of the admin routes such as DELETE /cache (IMAGE_ADMIN_TOKEN),
+	// they answer 404 when empty
+	AdminToken string
+}
+
+// ThumbnailSize is the box of a named thumbnail size
+type ThumbnailSize struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+var config = loadConfig()
+
+func loadConfig() Config {
+	return Config{
+		StorageRoot:   os.Getenv("IMAGE_STORAGE_ROOT"),
+		SigningSecret: os.Getenv("IMAGE_SIGNING_SECRET"),
+		JobWorkers:    getEnvInt("IMAGE_JOB_WORKERS", runtime.NumCPU()),
+		JobQueueSize:  getEnvInt("IMAGE_JOB_QUEUE_SIZE", 100),
+		JobRetention:  getEnvDuration("IMAGE_JOB_RETENTION", time.Hour),
+
+		CallbackSecret:      os.Getenv("IMAGE_CALLBACK_SECRET"),
+		CallbackMaxAttempts: getEnvInt("IMAGE_CALLBACK_MAX_ATTEMPTS", 5),
+		CallbackWorkers:     getEnvInt("IMAGE_CALLBACK_WORKERS", 4),
+		CallbackQueueSize:   getEnvInt("IMAGE_CALLBACK_QUEUE_SIZE", 100),
+
+		BatchWorkers:  getEnvInt("IMAGE_BATCH_WORKERS", runtime.NumCPU()),
+		BatchMaxFiles: getEnvInt("IMAGE_BATCH_MAX_FILES", 500),
+		BatchMaxBytes: int64(getEnvInt("IMAGE_BATCH_MAX_BYTES", 512<<20)),
+
+		ThumbnailSizes: getEnvThumbnailSizes("IMAGE_THUMBNAIL_SIZES", "small=128x128,medium=256x256,large=512x512"),
+
+		Presets: getEnvPresets("IMAGE_PRESETS_FILE"),
+
+		Backend: getEnvString("IMAGE_BACKEND", utils.BackendAuto),
+
+		CacheMemoryBytes: getEnvBytes("IMAGE_CACHE_MEMORY_BYTES", 0),
+		CacheDir:         os.Getenv("IMAGE_CACHE_DIR"),
+		CacheDiskBytes:   getEnvBytes("IMAGE_CACHE_DISK_BYTES", 1<<30),
+		CacheControl:     getEnvString("IMAGE_CACHE_CONTROL", "public, max-age=86400"),
+		AdminToken:       os.Getenv("IMAGE_ADMIN_TOKEN"),
+
+		StorageBackend: getEnvString("IMAGE_STORAGE_BACKEND", storage.BackendLocal),
+		S3: storage.S3Config{
+			Endpoint:        os.Getenv("IMAGE_S3_ENDPOINT"),
+			Region:          getEnvString("IMAGE_S3_REGION", "us-east-1"),
+			AccessKeyID:     os.Getenv("IMAGE_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("IMAGE_S3_SECRET_ACCESS_KEY"),
+			PathStyle:       getEnvBool("IMAGE_S3_PATH_STYLE", os.Getenv("IMAGE_S3_ENDPOINT") != ""),
+		},
+		StorageBuckets:   getEnvList("IMAGE_STORAGE_BUCKETS"),
+		StorageKeyPrefix: os.Getenv("IMAGE_STORAGE_KEY_PREFIX"),
+		DestinationToken: os.Getenv("IMAGE_DESTINATION_TOKEN"),
+		SourceMaxBytes:   int64(getEnvInt("IMAGE_SOURCE_MAX_BYTES", 64<<20)),
+
+		FetchTimeout:      getEnvDuration("IMAGE_FETCH_TIMEOUT", 30*time.Second),
+		FetchMaxRedirects: getEnvInt("IMAGE_FETCH_MAX_REDIRECTS", 3),
+		FetchContentTypes: strings.Split(getEnvString("IMAGE_FETCH_CONTENT_TYPES", strings.Join(fetch.DefaultContentTypes, ",")), ","),
+		FetchAllowlist:    getEnvAllowlist("IMAGE_FETCH_ALLOWLIST"),
+	}
+}
+
+// getEnvInt return the positive integer stored in the environment variable key, or fallback when unset
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		log.Fatalf("%s must be a positive integer, got %q", key, value)
+	}
+	return number
+}
+
+// getEnvBytes return the size in bytes (0 or more) stored in the environment variable key, or fallback when unset
+func getEnvBytes(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		log.Fatalf("%s must be a size in bytes, got %q", key, value)
+	}
+	return size
+}
+
+// getEnvBool return the boolean (true, false, 1, 0) stored in the environment variable key, or fallback when unset
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s must be a boolean, got %q", key, value)
+	}
+	return enabled
+}
+
+// getEnvAllowlist parse the comma separated networks and addresses stored in the environment variable key
+func getEnvAllowlist(key string) []netip.Prefix {
+	allowlist, err := fetch.ParseAllowlist(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("%s: %s", key, err.Error())
+	}
+	return allowlist
+}
+
+// getEnvList return the comma separated values stored in the environment variable key, blanks are dropped
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvString return the environment variable key, or fallback when unset
+func getEnvString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvDuration return the duration (e.g. "30m") stored in the environment variable key, or fallback when unset
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("%s must be a positive duration, got %q", key, value)
+	}
+	return duration
+}
+
+// getEnvPresets load the presets file whose path is stored in the environment variable key
+func getEnvPresets(key string) presets.Presets {
+	path := os.Getenv(key)
+	if path == "" {
+		return presets.Presets{}
+	}
+	loaded, err := presets.Load(path)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err.Error())
+	}
+	return loaded
+}
+
+// getEnvThumbnailSizes parse the "name=<width>x<height>" comma separated list stored in the environment variable key,
+// or fallback when unset
+func getEnvThumbnailSizes(key string, fallback string) map[string]ThumbnailSize {
+	value := os.Getenv(key)
+	if value == "" {
+		value = fallback
+	}
+	sizes, err := parseThumbnailSizes(value)
+	if err != nil {
+		log.Fatalf("%s: %s", key, err.Error())
+	}
+	return sizes
+}
+
+func parseThumbnailSizes(value string) (map[string]ThumbnailSize, error) {
+	sizes := map[string]ThumbnailSize{}
+	for _, entry := range strings.Split(value, ",") {
+		name, box, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		width, height, ok2 := strings.Cut(box, "x")
+		if !ok || !ok2 || name == "" {
+			return nil, fmt.Errorf("size %q must be name=<width>x<height>", entry)
+		}
+
+		size := ThumbnailSize{}
+		for _, dimension := range []struct {
+			value  string
+			max    uint16
+			target *uint16
+		}{
+			{width, utils.ResizeMaxWidth, &size.Width},
+			{height, utils.ResizeMaxHeight, &size.Height},
+		} {
+			number, err := strconv.ParseUint(dimension.value, 10, 16)
+			if err != nil || number < 1 || number > uint64(dimension.max) {
+				return nil, fmt.Errorf("size %q must be between 1x1 and %dx%d", entry, utils.ResizeMaxWidth, utils.ResizeMaxHeight)
+			}
+			*dimension.target = uint16(number)
+		}
+		sizes[name] = size
+	}
+	return sizes, nil
+}
@@ -1,47 +1,330 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/rudcode/go_image_converter_api/docs"
+	"github.com/rudcode/go_image_converter_api/internal/batch"
+	"github.com/rudcode/go_image_converter_api/internal/cache"
+	"github.com/rudcode/go_image_converter_api/internal/fetch"
+	"github.com/rudcode/go_image_converter_api/internal/jobs"
+	"github.com/rudcode/go_image_converter_api/internal/presets"
+	"github.com/rudcode/go_image_converter_api/internal/storage"
 	"github.com/rudcode/go_image_converter_api/internal/utils"
+	"github.com/rudcode/go_image_converter_api/pkg/urlsign"
+	"github.com/rudcode/go_image_converter_api/pkg/webhook"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-type convertToJpegInputParameter struct {
-	File *multipart.FileHeader `form:"file" binding:"required"`
+type convertImageInputParameter struct {
+	TargetFormat string                `form:"target_format" binding:"required"`
+	Page         *int                  `form:"page"`
+	File         *multipart.FileHeader `form:"file" binding:"required"`
+	encoderInputParameter
+}
+
+// encoderInputParameter are the optional encoder settings of /convert and /compress_image (see utils.EncoderOptions)
+type encoderInputParameter struct {
+	Quality             *int   `form:"quality"`
+	Progressive         bool   `form:"progressive"`
+	ChromaSubsampling   string `form:"chroma_subsampling"`
+	PngCompressionLevel *int   `form:"png_compression_level"`
+	Palette             bool   `form:"palette"`
+	Lossless            bool   `form:"lossless"`
+	Method              *int   `form:"method"`
+	NearLossless        *int   `form:"near_lossless"`
+	TiffCompression     string `form:"tiff_compression"`
 }
 
 type resizeImageInputParameter struct {
-	Width  *uint16               `form:"width" binding:"required"`
-	Height *uint16               `form:"height" binding:"required"`
-	File   *multipart.FileHeader `form:"file" binding:"required"`
+	Width      *uint16               `form:"width"`
+	Height     *uint16               `form:"height"`
+	Mode       string                `form:"mode"`
+	Background string                `form:"background"`
+	File       *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type cropImageInputParameter struct {
+	X       *uint16               `form:"x"`
+	Y       *uint16               `form:"y"`
+	Width   *uint16               `form:"width" binding:"required"`
+	Height  *uint16               `form:"height" binding:"required"`
+	Gravity string                `form:"gravity"`
+	File    *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type transformImageInputParameter struct {
+	Rotate     *float64              `form:"rotate"`
+	Flip       string                `form:"flip"`
+	AutoOrient bool                  `form:"auto_orient"`
+	Background string                `form:"background"`
+	File       *multipart.FileHeader `form:"file" binding:"required"`
 }
 
 type compressImageInputParameter struct {
-	CompressionLevel *uint8                `form:"compression_level" binding:"required"`
+	CompressionLevel *uint8                `form:"compression_level"`
+	MaxBytes         *int                  `form:"max_bytes"`
+	Downscale        bool                  `form:"downscale"`
 	File             *multipart.FileHeader `form:"file" binding:"required"`
+	encoderInputParameter
+}
+
+type processImageInputParameter struct {
+	Operations string                `form:"operations"`
+	Preset     string                `form:"preset"`
+	File       *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type submitJobInputParameter struct {
+	Operations  string                `form:"operations"`
+	Preset      string                `form:"preset"`
+	CallbackURL string                `form:"callback_url"`
+	File        *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type batchInputParameter struct {
+	Operations string                  `form:"operations"`
+	Preset     string                  `form:"preset"`
+	Files      []*multipart.FileHeader `form:"files"`
+	Archive    *multipart.FileHeader   `form:"archive"`
+	ImageURLs  []string                `form:"image_urls"`
+}
+
+type splitPagesInputParameter struct {
+	TargetFormat string                `form:"target_format"`
+	Output       string                `form:"output"`
+	File         *multipart.FileHeader `form:"file" binding:"required"`
+	encoderInputParameter
+}
+
+type srcsetInputParameter struct {
+	Widths  string                `form:"widths" binding:"required"`
+	Formats string                `form:"formats"`
+	Alt     string                `form:"alt"`
+	Sizes   string                `form:"sizes"`
+	BaseURL string                `form:"base_url"`
+	Output  string                `form:"output"`
+	File    *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// srcsetManifest is the manifest.json part of the /srcset response
+type srcsetManifest struct {
+	Variants []srcsetManifestVariant `json:"variants"`
+	HTML     string                  `json:"html"`
+}
+
+type srcsetManifestVariant struct {
+	File     string `json:"file"`
+	Width    uint16 `json:"width"`
+	Height   uint16 `json:"height"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+}
+
+type thumbnailInputParameter struct {
+	Size   string                `form:"size"`
+	Width  *uint16               `form:"width"`
+	Height *uint16               `form:"height"`
+	Format string                `form:"format"`
+	File   *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type imageInfoInputParameter struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
 }
 
 type ErrorResponse struct {
 	Detail string `json:"detail"`
 }
 
+// processingStatus return the status answering err, an error of the processing backend:
+// 501 when the backend doesn't support the operation, 400 otherwise
+func processingStatus(err error) int {
+	if errors.Is(err, utils.ErrNotSupported) {
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadRequest
+}
+
+// destinationResponse is the answer of the processing routes given a destination
+type destinationResponse struct {
+	Destination string `json:"destination"` // bucket/key
+	Location    string `json:"location"`    // URL of the written object
+	MimeType    string `json:"mime_type"`
+	Size        int    `json:"size"`
+}
+
+// cachePurgeResponse is the answer of DELETE /cache
+type cachePurgeResponse struct {
+	Purged int `json:"purged"` // number of removed entries
+}
+
+// jobCallbackPayload is POSTed to the callback_url of a job once it is finished
+type jobCallbackPayload struct {
+	JobID      string             `json:"job_id"`
+	Status     jobs.Status        `json:"status"`
+	Output     *jobCallbackOutput `json:"output,omitempty"`
+	Error      *ErrorResponse     `json:"error,omitempty"`
+	FinishedAt time.Time          `json:"finished_at"`
+}
+
+type jobCallbackOutput struct {
+	MimeType   string    `json:"mime_type"`
+	Size       int       `json:"size"`
+	ResultPath string    `json:"result_path"` // GET it to download the output
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// jobQueue run the jobs submitted to POST /jobs
+var jobQueue = jobs.NewQueue(config.JobWorkers, config.JobQueueSize, config.JobRetention)
+
+// callbackSender deliver the job callbacks, its client refuse the private addresses like imageFetcher
+var callbackSender = &webhook.Sender{
+	Client:      fetch.NewClient(config.FetchAllowlist, 10*time.Second),
+	Secret:      []byte(config.CallbackSecret),
+	MaxAttempts: config.CallbackMaxAttempts,
+	Backoff:     time.Second,
+	MaxBackoff:  time.Minute,
+}
+
+// callbackQueue bound the number of job callbacks being delivered and waiting to be
+var callbackQueue = webhook.NewQueue(callbackSender, config.CallbackWorkers, config.CallbackQueueSize)
+
+// processor is the backend of /convert, /convert_png_to_jpeg, /resize_image and /compress_image
+var processor = newProcessor(config.Backend)
+
+// newProcessor return the processing backend named backend, see utils.NewProcessor
+func newProcessor(backend string) utils.ImageProcessor {
+	processor, err := utils.NewProcessor(backend)
+	if err != nil {
+		log.Fatalf("IMAGE_BACKEND: %s", err.Error())
+	}
+	log.Printf("Processing images with the %s backend", processor.Name())
+	return processor
+}
+
+// resultCache keep the responses of the processing routes, nil when disabled, see cacheResponse
+var resultCache = newResultCache()
+
+// newResultCache return the cache configured by IMAGE_CACHE_*, nil when both tiers are disabled
+func newResultCache() *cache.Cache {
+	if config.CacheMemoryBytes == 0 && config.CacheDir == "" {
+		return nil
+	}
+	resultCache, err := cache.New(config.CacheMemoryBytes, config.CacheDir, config.CacheDiskBytes)
+	if err != nil {
+		log.Fatalf("IMAGE_CACHE_DIR: %s", err.Error())
+	}
+	return resultCache
+}
+
+// objectStorage hold the source and destination objects, nil when not configured, see readSource and writeDestination
+var objectStorage = newObjectStorage()
+
+// newObjectStorage return the storage configured by IMAGE_STORAGE_BACKEND
+func newObjectStorage() storage.Storage {
+	switch config.StorageBackend {
+	case storage.BackendLocal:
+		if config.StorageRoot == "" {
+			return nil
+		}
+		return storage.NewLocal(config.StorageRoot)
+	case storage.BackendS3:
+		s3Storage, err := storage.NewS3(config.S3)
+		if err != nil {
+			log.Fatalf("IMAGE_S3: %s", err.Error())
+		}
+		return s3Storage
+	}
+	log.Fatalf("IMAGE_STORAGE_BACKEND: backend %s is not supported", config.StorageBackend)
+	return nil
+}
+
+// imageFetcher download the image_url of the requests, see fetchImageURL
+var imageFetcher = &fetch.Fetcher{
+	MaxBytes:     config.SourceMaxBytes,
+	Timeout:      config.FetchTimeout,
+	MaxRedirects: config.FetchMaxRedirects,
+	ContentTypes: config.FetchContentTypes,
+	Allowlist:    config.FetchAllowlist,
+}
+
 // @Summary		Convert PNG to JPEG
-// @Description	Convert image from PNG format to JPEG format
+// @Description	Alias of /convert with target_format=jpeg, kept for the existing clients, any supported input format is accepted
+// @Description	presets are rejected as they could change the output format
 // @ID			convert_png_to_jpeg
 // @Accept		multipart/form-data
 // @Produce		json
-// @Param		file	formData	file	true	"image file"
+// @Param		file	formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Success		201	{object}	destinationResponse
 //
 // @Router		/convert_png_to_jpeg [post]
 func convertPngToJpeg(c *gin.Context) {
-	var input convertToJpegInputParameter
+	// Force the target format, the other fields (page, encoder options) are handled by /convert
+	if form, err := c.MultipartForm(); err == nil {
+		form.Value["target_format"] = []string{"jpeg"}
+		c.Request.PostForm.Set("target_format", "jpeg")
+	}
+	convertImage(c)
+}
+
+// @Summary		Convert image
+// @Description	Convert image from any supported format to the target format (jpeg, png, webp, bmp, gif, avif, tiff)
+// @Description	the encoder of jpeg, png, webp and tiff targets can be tuned with the options of its format
+// @Description	animated GIF and WebP stay animated when converted to gif or webp, other targets keep the first frame
+// @ID			convert_image
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file			formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		target_format	formData	string	true	"target format (jpeg, png, webp, bmp, gif, avif, tiff)"
+// @Param		page			formData	int		false	"page of a multi-page TIFF to convert, starting at 1"
+// @Param		quality					formData	int		false	"jpeg or webp quality (1-100)"
+// @Param		progressive				formData	bool	false	"progressive jpeg, rejected as the mjpeg encoder only produce baseline jpeg"
+// @Param		chroma_subsampling		formData	string	false	"jpeg chroma subsampling (444, 422, 420)"
+// @Param		png_compression_level	formData	int		false	"png zlib compression level (0-9)"
+// @Param		palette					formData	bool	false	"reduce the png to a 256 colours palette"
+// @Param		lossless				formData	bool	false	"lossless webp"
+// @Param		method					formData	int		false	"webp compression method (0-6)"
+// @Param		near_lossless			formData	int		false	"near lossless webp, rejected as the libwebp encoder of ffmpeg doesn't expose it"
+// @Param		tiff_compression		formData	string	false	"tiff compression (none, lzw, deflate), default packbits"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/convert [post]
+func convertImage(c *gin.Context) {
+	var input convertImageInputParameter
 
 	// Input verification
 	if err := c.ShouldBind(&input); err != nil {
@@ -58,6 +341,14 @@ func convertPngToJpeg(c *gin.Context) {
 		return
 	}
 
+	targetFormat := utils.NormalizeFormat(input.TargetFormat)
+	if _, ok := utils.ConvertImageFormats[targetFormat]; !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Target format %s is not supported", input.TargetFormat),
+		})
+		return
+	}
+
 	// Get file buffer
 	inBuf, err := input.File.Open()
 	if err != nil {
@@ -68,26 +359,54 @@ func convertPngToJpeg(c *gin.Context) {
 	}
 	defer inBuf.Close()
 
-	// Convert PNG to JPG
+	// Select the page of multi-page TIFF
+	var source io.ReadSeeker = inBuf
+	if input.Page != nil {
+		data, err := io.ReadAll(inBuf)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+			return
+		}
+		page, err := utils.TiffPage(data, *input.Page)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Detail: fmt.Sprintf("Error while reading page: %s", err.Error()),
+			})
+			return
+		}
+		source = bytes.NewReader(page)
+	}
+
+	// Convert
 	outBuf := bytes.NewBuffer(nil)
-	err = utils.ConvertPngToJpeg(inBuf, outBuf)
+	err = processor.Convert(source, targetFormat, utils.EncoderOptions(input.encoderInputParameter), outBuf)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
+		c.JSON(processingStatus(err), ErrorResponse{
 			Detail: fmt.Sprintf("Error while converting: %s", err.Error()),
 		})
 		return
 	}
-	c.Data(http.StatusOK, "image/jpeg", outBuf.Bytes())
+	c.Data(http.StatusOK, fmt.Sprintf("image/%s", targetFormat), outBuf.Bytes())
 }
 
 // @Summary		Resize image
-// @Description	Resize image to the specified width and height
+// @Description	Resize image to the specified width and height, when only one of them is given the other is derived from the aspect ratio
+// @Description	The EXIF orientation is applied before resizing, every frame of animated GIF and WebP is resized
 // @ID			resize_image
 // @Accept		multipart/form-data
 // @Produce		json
-// @Param		file	formData	file	true	"image file"
-// @Param		width	formData	uint16	true	"width"
-// @Param		height	formData	uint16	true	"height"
+// @Param		file		formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		width		formData	uint16	false	"width"
+// @Param		height		formData	uint16	false	"height"
+// @Param		mode		formData	string	false	"resize mode (fill, fit, cover, pad), default fill"
+// @Param		background	formData	string	false	"background colour used by pad mode, default black"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Success		201	{object}	destinationResponse
 //
 // @Router		/resize_image [post]
 func resizeImage(c *gin.Context) {
@@ -104,6 +423,28 @@ func resizeImage(c *gin.Context) {
 		return
 	}
 
+	if input.Width == nil && input.Height == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Width or height is required"})
+		return
+	}
+
+	// Omitted dimension is derived from the aspect ratio
+	var width, height uint16
+	if input.Width != nil {
+		if *input.Width < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Width must be positive"})
+			return
+		}
+		width = *input.Width
+	}
+	if input.Height != nil {
+		if *input.Height < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Height must be positive"})
+			return
+		}
+		height = *input.Height
+	}
+
 	// Get file buffer
 	inBuf, err := input.File.Open()
 	if err != nil {
@@ -115,39 +456,230 @@ func resizeImage(c *gin.Context) {
 	defer inBuf.Close()
 
 	// Get format
-	format, err := utils.GetImageFormat(inBuf)
+	probe, err := processor.Probe(inBuf)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Detail: fmt.Sprintf("Can't probe file, make sure the file is valid image: %s", err.Error()),
 		})
 		return
 	}
+	format := probe.Format
 
 	inBuf.Seek(0, 0)
 
 	// Resize
 	outBuf := bytes.NewBuffer(nil)
-	err = utils.ResizeImage(inBuf, format, *input.Width, *input.Height, outBuf)
+	err = processor.Resize(inBuf, format, width, height, input.Mode, input.Background, outBuf)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
+		c.JSON(processingStatus(err), ErrorResponse{
 			Detail: fmt.Sprintf("Error while resizing: %s", err.Error()),
 		})
 		return
 	}
 
-	if format == "mjpeg" {
-		format = "jpeg" // return image/jpeg mimetype
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// @Summary		Crop image
+// @Description	Crop image to the rectangle given by x, y, width and height, or to width and height anchored with gravity
+// @Description	the EXIF orientation is applied first, the rectangle is relative to the oriented image
+// @ID			crop_image
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file	formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		width	formData	uint16	true	"width"
+// @Param		height	formData	uint16	true	"height"
+// @Param		x		formData	uint16	false	"left offset, required with y when gravity is not set"
+// @Param		y		formData	uint16	false	"top offset, required with x when gravity is not set"
+// @Param		gravity	formData	string	false	"gravity (center, north, south, east, west, north-east, north-west, south-east, south-west), default center"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/crop_image [post]
+func cropImage(c *gin.Context) {
+	var input cropImageInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	options := utils.CropOptions{
+		Width:   *input.Width,
+		Height:  *input.Height,
+		Gravity: input.Gravity,
+	}
+	if input.X != nil || input.Y != nil {
+		if input.X == nil || input.Y == nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Both x and y are required"})
+			return
+		}
+		if input.Gravity != "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Gravity can't be combined with x and y"})
+			return
+		}
+		options.X = *input.X
+		options.Y = *input.Y
+	} else if options.Gravity == "" {
+		options.Gravity = utils.GravityCenter
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Get format
+	probe, err := processor.Probe(inBuf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Can't probe file, make sure the file is valid image: %s", err.Error()),
+		})
+		return
+	}
+	format := probe.Format
+	inBuf.Seek(0, 0)
+
+	// Crop
+	outBuf := bytes.NewBuffer(nil)
+	err = processor.Crop(inBuf, format, options, outBuf)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while cropping: %s", err.Error()),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// @Summary		Transform image
+// @Description	Rotate and/or flip image, auto_orient apply the EXIF orientation first
+// @ID			transform_image
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file		formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		rotate		formData	number	false	"clockwise rotation in degrees, multiples of 90 are lossless"
+// @Param		flip		formData	string	false	"flip direction (horizontal, vertical, both)"
+// @Param		auto_orient	formData	bool	false	"apply the EXIF orientation"
+// @Param		background	formData	string	false	"colour of the uncovered area when rotating by an arbitrary angle, default black"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/transform_image [post]
+func transformImage(c *gin.Context) {
+	var input transformImageInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	if input.Rotate == nil && input.Flip == "" && !input.AutoOrient {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "At least one of rotate, flip or auto_orient is required"})
+		return
+	}
+
+	options := utils.TransformOptions{
+		AutoOrient: input.AutoOrient,
+		Flip:       input.Flip,
+		Background: input.Background,
+	}
+	if input.Rotate != nil {
+		options.Rotate = *input.Rotate
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Get format
+	probe, err := processor.Probe(inBuf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Can't probe file, make sure the file is valid image: %s", err.Error()),
+		})
+		return
+	}
+	format := probe.Format
+	inBuf.Seek(0, 0)
+
+	// Transform
+	outBuf := bytes.NewBuffer(nil)
+	err = processor.Transform(inBuf, format, options, outBuf)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while transforming: %s", err.Error()),
+		})
+		return
 	}
-	c.Data(http.StatusOK, fmt.Sprintf("image/%s", format), outBuf.Bytes())
+
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
 }
 
 // @Summary		Compress image
 // @Description	Compress image with specified compression level (1-5)
+// @Description	or with the highest quality keeping the output under max_bytes, the chosen quality (1-100) is reported
+// @Description	in the X-Image-Quality header (absent for PNG and TIFF, which are lossless), with downscale the image is also
+// @Description	downscaled when needed and its final size is reported in the X-Image-Width and X-Image-Height headers
+// @Description	The encoder options of the image format override compression_level, they can't be combined with max_bytes
+// @Description	The EXIF orientation is applied before compressing
 // @ID			compress_image
 // @Accept		multipart/form-data
 // @Produce		json
-// @Param		file				formData	file	true	"image file"
-// @Param		compression_level	formData	uint8	true	"compression level (1-5)"
+// @Param		file				formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		compression_level	formData	uint8	false	"compression level (1-5), required without max_bytes or encoder options"
+// @Param		max_bytes			formData	int		false	"maximum output size in bytes, instead of compression_level"
+// @Param		downscale			formData	bool	false	"downscale the image when max_bytes can't be reached otherwise"
+// @Param		quality					formData	int		false	"jpeg or webp quality (1-100)"
+// @Param		progressive				formData	bool	false	"progressive jpeg, rejected as the mjpeg encoder only produce baseline jpeg"
+// @Param		chroma_subsampling		formData	string	false	"jpeg chroma subsampling (444, 422, 420)"
+// @Param		png_compression_level	formData	int		false	"png zlib compression level (0-9)"
+// @Param		palette					formData	bool	false	"reduce the png to a 256 colours palette"
+// @Param		lossless				formData	bool	false	"lossless webp"
+// @Param		method					formData	int		false	"webp compression method (0-6)"
+// @Param		near_lossless			formData	int		false	"near lossless webp, rejected as the libwebp encoder of ffmpeg doesn't expose it"
+// @Param		tiff_compression		formData	string	false	"tiff compression (none, lzw, deflate)"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Success		201	{object}	destinationResponse
 //
 // @Router		/compress_image [post]
 func compressImage(c *gin.Context) {
@@ -168,13 +700,35 @@ func compressImage(c *gin.Context) {
 		return
 	}
 
-	if *input.CompressionLevel < 1 || *input.CompressionLevel > 5 {
+	options := utils.EncoderOptions(input.encoderInputParameter)
+	if input.MaxBytes != nil && (input.CompressionLevel != nil || !options.IsZero()) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: "Max bytes can't be combined with compression_level or encoder options",
+		})
+		return
+	}
+
+	if input.MaxBytes == nil && input.CompressionLevel == nil && options.IsZero() {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: "Either compression_level, max_bytes or encoder options must be specified",
+		})
+		return
+	}
+
+	if input.CompressionLevel != nil && (*input.CompressionLevel < 1 || *input.CompressionLevel > 5) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Detail: "Compression Level must be 1 <= level <= 5",
 		})
 		return
 	}
 
+	if input.MaxBytes != nil && *input.MaxBytes < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: "Max bytes must be positive",
+		})
+		return
+	}
+
 	// Get file buffer
 	inBuf, err := input.File.Open()
 	if err != nil {
@@ -186,37 +740,1591 @@ func compressImage(c *gin.Context) {
 	defer inBuf.Close()
 
 	// Get format
-	format, err := utils.GetImageFormat(inBuf)
+	probe, err := processor.Probe(inBuf)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Detail: fmt.Sprintf("Can't probe file, make sure the file is valid image: %s", err.Error()),
 		})
 		return
 	}
+	format := probe.Format
 	inBuf.Seek(0, 0)
 
 	// Compress
 	outBuf := bytes.NewBuffer(nil)
-	err = utils.CompressImage(inBuf, format, *input.CompressionLevel, outBuf)
+	if input.MaxBytes != nil {
+		var result utils.TargetSizeResult
+		result, err = processor.CompressToSize(inBuf, format, *input.MaxBytes, input.Downscale, outBuf)
+		if err == nil {
+			if result.Quality > 0 {
+				c.Header("X-Image-Quality", strconv.Itoa(result.Quality))
+			}
+			c.Header("X-Image-Width", strconv.Itoa(int(result.Width)))
+			c.Header("X-Image-Height", strconv.Itoa(int(result.Height)))
+		}
+	} else {
+		var compressionLevel uint8
+		if input.CompressionLevel != nil {
+			compressionLevel = *input.CompressionLevel
+		}
+		err = processor.Compress(inBuf, format, compressionLevel, options, outBuf)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
+		c.JSON(processingStatus(err), ErrorResponse{
 			Detail: fmt.Sprintf("Error while compressing: %s", err.Error()),
 		})
 		return
 	}
 
-	if format == "mjpeg" {
-		format = "jpeg" // return image/jpeg mimetype
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// @Summary		Process image
+// @Description	Apply an ordered list of operations to the image with a single ffmpeg invocation
+// @Description	operations is a JSON array, e.g. [{"op":"resize","width":400,"mode":"fit"},{"op":"compress","compression_level":3},{"op":"convert","format":"webp"}]
+// @Description	Supported operations: resize (width, height, mode, background), crop (width, height, x, y, gravity),
+// @Description	rotate (angle, background), flip (direction), auto_orient, compress (compression_level and/or the encoder options of /convert), convert (format)
+// @ID			process_image
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file		formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		operations	formData	string	false	"JSON array of operations"
+// @Param		preset		formData	string	false	"preset name instead of operations (see /presets)"
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/process [post]
+func processImage(c *gin.Context) {
+	var input processImageInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	// Validate the whole pipeline before touching the file
+	pipeline, err := resolveOperations(input.Operations, input.Preset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Process
+	outBuf := bytes.NewBuffer(nil)
+	format, err := processor.Pipeline(inBuf, pipeline, outBuf, nil)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while processing: %s", err.Error()),
+		})
+		return
+	}
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// resolveOperations return the pipeline of /process, /jobs and /batch,
+// either the named preset or the decoded operations form field
+func resolveOperations(operations string, preset string) (utils.Pipeline, error) {
+	switch {
+	case operations != "" && preset != "":
+		return nil, fmt.Errorf("Operations can't be combined with preset")
+	case preset != "":
+		return lookupPreset(preset)
+	case operations == "":
+		return nil, fmt.Errorf("Operations or preset must be specified")
+	}
+	return parseOperations(operations)
+}
+
+// lookupPreset return the pipeline of the configured preset name
+func lookupPreset(name string) (utils.Pipeline, error) {
+	preset, ok := config.Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("Preset %s is not configured", name)
+	}
+	return preset.Operations, nil
+}
+
+// parseOperations decode and validate the operations form field of /process and /jobs
+func parseOperations(operations string) (utils.Pipeline, error) {
+	var pipeline utils.Pipeline
+	decoder := json.NewDecoder(bytes.NewBufferString(operations))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&pipeline); err != nil {
+		return nil, fmt.Errorf("Operations must be a JSON array of operations: %s", err.Error())
+	}
+	if err := pipeline.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid operations: %s", err.Error())
+	}
+	return pipeline, nil
+}
+
+// @Summary		Submit job
+// @Description	Enqueue the same operations as /process and return immediately with the job ID,
+// @Description	poll GET /jobs/{id} until the status is succeeded or failed then download GET /jobs/{id}/result
+// @Description	when callback_url is set, a JSON payload (job_id, status, output or error) is POSTed to it once the job is finished,
+// @Description	signed with the X-Webhook-Signature and X-Webhook-Timestamp headers (see pkg/webhook)
+// @Description	like image_url, the callback can't reach private addresses unless they are in IMAGE_FETCH_ALLOWLIST
+// @ID			submit_job
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file		formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		operations	formData	string	false	"JSON array of operations (see /process)"
+// @Param		preset		formData	string	false	"preset name instead of operations (see /presets)"
+// @Param		callback_url	formData	string	false	"URL notified when the job is finished"
+// @Success		202	{object}	jobs.Job
+// @Failure		400	{object}	ErrorResponse
+// @Failure		503	{object}	ErrorResponse
+//
+// @Router		/jobs [post]
+func submitJob(c *gin.Context) {
+	var input submitJobInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	pipeline, err := resolveOperations(input.Operations, input.Preset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.CallbackURL != "" {
+		callbackURL, err := url.Parse(input.CallbackURL)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Callback URL must be an absolute http or https URL"})
+			return
+		}
+	}
+
+	// Read the file now, the upload is gone once the request returns
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+
+	var notify func(jobs.Job)
+	if input.CallbackURL != "" {
+		callbackURL := input.CallbackURL
+		notify = func(job jobs.Job) {
+			err := callbackQueue.Enqueue(callbackURL, newJobCallbackPayload(job), func(err error) {
+				if err != nil {
+					log.Printf("job %s: callback to %s failed: %s", job.ID, callbackURL, err.Error())
+				}
+			})
+			if err != nil {
+				log.Printf("job %s: callback to %s dropped: %s", job.ID, callbackURL, err.Error())
+			}
+		}
+	}
+
+	job, err := jobQueue.SubmitNotify(func(progress func(int)) (jobs.Result, error) {
+		outBuf := bytes.NewBuffer(nil)
+		format, err := processor.Pipeline(bytes.NewReader(data), pipeline, outBuf, progress)
+		if err != nil {
+			return jobs.Result{}, fmt.Errorf("Error while processing: %s", err.Error())
+		}
+		return jobs.Result{Data: outBuf.Bytes(), MimeType: utils.GetMimeType(format)}, nil
+	}, notify)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Detail: fmt.Sprintf("Can't submit job: %s", err.Error()),
+		})
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/jobs/%s", job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+// newJobCallbackPayload return the payload POSTed to the callback_url of the finished job
+func newJobCallbackPayload(job jobs.Job) jobCallbackPayload {
+	payload := jobCallbackPayload{
+		JobID:      job.ID,
+		Status:     job.Status,
+		FinishedAt: *job.FinishedAt,
+	}
+	if job.Status == jobs.StatusSucceeded {
+		payload.Output = &jobCallbackOutput{
+			MimeType:   job.MimeType,
+			Size:       job.Size,
+			ResultPath: fmt.Sprintf("/jobs/%s/result", job.ID),
+			ExpiresAt:  *job.ExpiresAt,
+		}
+	} else {
+		payload.Error = &ErrorResponse{Detail: job.Error}
+	}
+	return payload
+}
+
+// @Summary		Get job
+// @Description	Return the status, progress (share of the pipeline steps done, 100 once finished) and error of a job
+// @ID			get_job
+// @Produce		json
+// @Param		id	path	string	true	"job ID"
+// @Success		200	{object}	jobs.Job
+// @Failure		404	{object}	ErrorResponse
+//
+// @Router		/jobs/{id} [get]
+func getJob(c *gin.Context) {
+	job, err := jobQueue.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// @Summary		Get job result
+// @Description	Return the output image of a succeeded job, with a strong ETag honoured by If-None-Match
+// @ID			get_job_result
+// @Produce		image/jpeg,image/png,image/webp,image/bmp,image/gif,image/avif
+// @Param		id	path	string	true	"job ID"
+// @Param		If-None-Match	header	string	false	"ETag of a previous response, answered with 304 when unchanged"
+// @Failure		404	{object}	ErrorResponse
+// @Failure		409	{object}	ErrorResponse
+//
+// @Router		/jobs/{id}/result [get]
+func getJobResult(c *gin.Context) {
+	result, err := jobQueue.Result(c.Param("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Job not found"})
+		return
+	case errors.Is(err, jobs.ErrNotFinished):
+		c.JSON(http.StatusConflict, ErrorResponse{Detail: "Job is not finished"})
+		return
+	case err != nil:
+		job, _ := jobQueue.Get(c.Param("id"))
+		c.JSON(http.StatusConflict, ErrorResponse{Detail: fmt.Sprintf("Job failed: %s", job.Error)})
+		return
+	}
+	respondData(c, result.MimeType, result.Data)
+}
+
+// @Summary		Batch process images
+// @Description	Apply the same operations as /process to many images, uploaded as repeated files fields or as a zip archive
+// @Description	and/or downloaded from repeated image_urls fields (checked like image_url),
+// @Description	and return a zip archive with the processed images and a manifest.json listing the outcome of every file
+// @Description	a failed file (or download) doesn't fail the request, it is reported in the failures of the manifest
+// @ID			batch
+// @Accept		multipart/form-data
+// @Produce		application/zip
+// @Param		files		formData	file	false	"image files (repeat the field)"
+// @Param		archive		formData	file	false	"zip archive of images, instead of files"
+// @Param		image_urls	formData	[]string	false	"http or https URLs of images to download (repeat the field)"	collectionFormat(multi)
+// @Param		operations	formData	string	false	"JSON array of operations (see /process)"
+// @Param		preset		formData	string	false	"preset name instead of operations (see /presets)"
+// @Failure		400	{object}	ErrorResponse
+// @Failure		413	{object}	ErrorResponse
+//
+// @Router		/batch [post]
+func batchProcess(c *gin.Context) {
+	var input batchInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if len(input.Files) > 0 && input.Archive != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Files and archive can't be combined"})
+		return
+	}
+	if len(input.Files) == 0 && input.Archive == nil && len(input.ImageURLs) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Either files, archive or image_urls must be specified"})
+		return
+	}
+	if len(input.ImageURLs) > config.BatchMaxFiles {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Detail: fmt.Sprintf("At most %d files can be processed", config.BatchMaxFiles),
+		})
+		return
+	}
+
+	pipeline, err := resolveOperations(input.Operations, input.Preset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	// Read the files
+	var files []batch.File
+	if input.Archive != nil {
+		data, err := readFormFile(input.Archive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+			return
+		}
+		files, err = batch.ReadZip(data, config.BatchMaxFiles-len(input.ImageURLs), config.BatchMaxBytes)
+		if errors.Is(err, batch.ErrTooManyFiles) || errors.Is(err, batch.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+				Detail: fmt.Sprintf("Archive must contain at most %d files and %d bytes", config.BatchMaxFiles, config.BatchMaxBytes),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+			return
+		}
+	} else if len(input.Files) > 0 {
+		var total int64
+		for _, fileHeader := range input.Files {
+			total += fileHeader.Size
+		}
+		if len(input.Files)+len(input.ImageURLs) > config.BatchMaxFiles || total > config.BatchMaxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+				Detail: fmt.Sprintf("At most %d files and %d bytes can be processed", config.BatchMaxFiles, config.BatchMaxBytes),
+			})
+			return
+		}
+		for _, fileHeader := range input.Files {
+			data, err := readFormFile(fileHeader)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+				return
+			}
+			files = append(files, batch.File{Name: filepath.Base(fileHeader.Filename), Data: data})
+		}
+	}
+
+	// The images of image_urls are downloaded by the workers, within the bytes left by the files
+	var downloaded atomic.Int64
+	downloaded.Store(batchBytes(files))
+	for _, imageURL := range input.ImageURLs {
+		files = append(files, batch.File{Name: batchURLName(imageURL), URL: imageURL})
+	}
+
+	// Process
+	outputs, manifest := batch.Process(files, config.BatchWorkers, func(file batch.File) ([]byte, string, error) {
+		if file.URL != "" {
+			image, err := imageFetcher.Fetch(c.Request.Context(), file.URL)
+			if err != nil {
+				return nil, "", fmt.Errorf("Error while fetching image_url: %s", err.Error())
+			}
+			if downloaded.Add(int64(len(image.Data))) > config.BatchMaxBytes {
+				return nil, "", fmt.Errorf("Batch is larger than %d bytes", config.BatchMaxBytes)
+			}
+			file.Data = image.Data
+		}
+		outBuf := bytes.NewBuffer(nil)
+		format, err := processor.Pipeline(bytes.NewReader(file.Data), pipeline, outBuf, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("Error while processing: %s", err.Error())
+		}
+		return outBuf.Bytes(), utils.GetExtension(format), nil
+	})
+
+	outBuf := bytes.NewBuffer(nil)
+	if err := batch.WriteZip(outBuf, outputs, manifest); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Detail: fmt.Sprintf("Error while writing archive: %s", err.Error()),
+		})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="batch.zip"`)
+	c.Data(http.StatusOK, "application/zip", outBuf.Bytes())
+}
+
+// batchBytes return the size of the data of files
+func batchBytes(files []batch.File) int64 {
+	var total int64
+	for _, file := range files {
+		total += int64(len(file.Data))
+	}
+	return total
+}
+
+// batchURLName return the name of the image downloaded from imageURL in a batch, the last segment of its path
+func batchURLName(imageURL string) string {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return "image"
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		return "image"
+	}
+	return name
+}
+
+// readFormFile return the content of an uploaded file
+func readFormFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	inBuf, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer inBuf.Close()
+	return io.ReadAll(inBuf)
+}
+
+// @Summary		Responsive image set
+// @Description	Resize the image to every width in every format with a single ffmpeg invocation,
+// @Description	heights follow the source aspect ratio and widths larger than the source are dropped
+// @Description	the response (zip archive or multipart/mixed) holds the variants named <name>-<width>.<ext>,
+// @Description	a picture.html <picture> snippet and a manifest.json describing the variants, presets are rejected
+// @ID			srcset
+// @Accept		multipart/form-data
+// @Produce		application/zip,multipart/mixed
+// @Param		file		formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		widths		formData	string	true	"comma separated widths, e.g. 320,640,1280"
+// @Param		formats		formData	string	false	"comma separated formats, the last one is the <img> fallback, e.g. webp,jpeg (default: source format)"
+// @Param		alt			formData	string	false	"alt text of the <img>"
+// @Param		sizes		formData	string	false	"sizes attribute (default: 100vw)"
+// @Param		base_url	formData	string	false	"prefix of the variant URLs in the snippet"
+// @Param		output		formData	string	false	"zip (default) or multipart"
+// @Failure		400	{object}	ErrorResponse
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/srcset [post]
+func srcset(c *gin.Context) {
+	var input srcsetInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	var widths []uint16
+	for _, value := range strings.Split(input.Widths, ",") {
+		width, err := strconv.ParseUint(strings.TrimSpace(value), 10, 16)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: fmt.Sprintf("Invalid width %s", value)})
+			return
+		}
+		widths = append(widths, uint16(width))
+	}
+
+	var formats []string
+	if input.Formats != "" {
+		formats = strings.Split(input.Formats, ",")
+	}
+
+	if input.Output == "" {
+		input.Output = "zip"
+	}
+	if input.Output != "zip" && input.Output != "multipart" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Output must be zip or multipart"})
+		return
+	}
+	if input.Sizes == "" {
+		input.Sizes = "100vw"
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Generate
+	variants, err := processor.Variants(inBuf, widths, formats)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while generating variants: %s", err.Error()),
+		})
+		return
+	}
+
+	name := uploadName(input.File)
+	fileName := func(variant utils.Variant) string {
+		return fmt.Sprintf("%s-%d.%s", name, variant.Width, utils.GetExtension(variant.Format))
+	}
+
+	manifest := srcsetManifest{
+		HTML: utils.PictureHTML(variants, func(variant utils.Variant) string {
+			return input.BaseURL + fileName(variant)
+		}, input.Alt, input.Sizes),
+	}
+	for _, variant := range variants {
+		manifest.Variants = append(manifest.Variants, srcsetManifestVariant{
+			File:     fileName(variant),
+			Width:    variant.Width,
+			Height:   variant.Height,
+			MimeType: utils.GetMimeType(variant.Format),
+			Size:     len(variant.Data),
+		})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	// Write the response
+	parts := []srcsetPart{
+		{"manifest.json", "application/json", manifestData},
+		{"picture.html", "text/html; charset=utf-8", []byte(manifest.HTML)},
+	}
+	for _, variant := range variants {
+		parts = append(parts, srcsetPart{fileName(variant), utils.GetMimeType(variant.Format), variant.Data})
+	}
+
+	outBuf := bytes.NewBuffer(nil)
+	var contentType string
+	if input.Output == "zip" {
+		contentType, err = writeSrcsetZip(outBuf, parts)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-srcset.zip"`, name))
+	} else {
+		contentType, err = writeSrcsetMultipart(outBuf, parts)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Detail: fmt.Sprintf("Error while writing response: %s", err.Error()),
+		})
+		return
+	}
+	c.Data(http.StatusOK, contentType, outBuf.Bytes())
+}
+
+// srcsetPart is a file of the /srcset response
+type srcsetPart struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// writeSrcsetZip write the parts as a zip archive and return its content type
+func writeSrcsetZip(w io.Writer, parts []srcsetPart) (string, error) {
+	writer := zip.NewWriter(w)
+	for _, part := range parts {
+		fileWriter, err := writer.Create(part.name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := fileWriter.Write(part.data); err != nil {
+			return "", err
+		}
+	}
+	return "application/zip", writer.Close()
+}
+
+// writeSrcsetMultipart write the parts as a multipart/mixed body and return its content type
+func writeSrcsetMultipart(w io.Writer, parts []srcsetPart) (string, error) {
+	writer := multipart.NewWriter(w)
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":        {part.contentType},
+			"Content-Disposition": {fmt.Sprintf(`attachment; filename="%s"`, part.name)},
+		})
+		if err != nil {
+			return "", err
+		}
+		if _, err := partWriter.Write(part.data); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("multipart/mixed; boundary=%s", writer.Boundary()), writer.Close()
+}
+
+// uploadName return the name of the uploaded file without extension,
+// restricted to characters safe in headers and URLs
+func uploadName(fileHeader *multipart.FileHeader) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename)))
+	if strings.Trim(name, "_") == "" {
+		return "image"
+	}
+	return name
+}
+
+// @Summary		Split pages
+// @Description	Explode every page of a multi-page TIFF into separate images named <name>-<page>.<ext>,
+// @Description	returned as a zip archive or multipart/mixed body, the pages are single page TIFFs unless target_format is given
+// @Description	presets are rejected
+// @ID			split_pages
+// @Accept		multipart/form-data
+// @Produce		application/zip,multipart/mixed
+// @Param		file				formData	file	false	"TIFF file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		target_format		formData	string	false	"format of the pages (jpeg, png, webp, bmp, gif, avif, tiff), default tiff"
+// @Param		tiff_compression	formData	string	false	"tiff compression (none, lzw, deflate), the pages are re-encoded when set"
+// @Param		output				formData	string	false	"zip (default) or multipart"
+// @Failure		400	{object}	ErrorResponse
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/split_pages [post]
+func splitPages(c *gin.Context) {
+	var input splitPagesInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	// Re-encode the pages only when asked to, the extracted pages are already valid TIFFs
+	targetFormat := utils.NormalizeFormat(input.TargetFormat)
+	options := utils.EncoderOptions(input.encoderInputParameter)
+	if targetFormat == "" && !options.IsZero() {
+		targetFormat = "tiff"
+	}
+	if _, ok := utils.ConvertImageFormats[targetFormat]; targetFormat != "" && !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Target format %s is not supported", input.TargetFormat),
+		})
+		return
+	}
+
+	if input.Output == "" {
+		input.Output = "zip"
+	}
+	if input.Output != "zip" && input.Output != "multipart" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Output must be zip or multipart"})
+		return
+	}
+
+	// Get file buffer
+	data, err := readFormFile(input.File)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	// Split
+	pages, err := utils.TiffPages(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Error while reading pages: %s", err.Error()),
+		})
+		return
+	}
+
+	name := uploadName(input.File)
+	format := "tiff"
+	if targetFormat != "" {
+		format = utils.ConvertImageFormats[targetFormat]
+	}
+	var parts []srcsetPart
+	for i, page := range pages {
+		if targetFormat != "" {
+			outBuf := bytes.NewBuffer(nil)
+			if err := processor.Convert(bytes.NewReader(page), targetFormat, options, outBuf); err != nil {
+				c.JSON(processingStatus(err), ErrorResponse{
+					Detail: fmt.Sprintf("Error while converting page %d: %s", i+1, err.Error()),
+				})
+				return
+			}
+			page = outBuf.Bytes()
+		}
+		parts = append(parts, srcsetPart{
+			fmt.Sprintf("%s-%d.%s", name, i+1, utils.GetExtension(format)), utils.GetMimeType(format), page,
+		})
+	}
+
+	// Write the response
+	outBuf := bytes.NewBuffer(nil)
+	var contentType string
+	if input.Output == "zip" {
+		contentType, err = writeSrcsetZip(outBuf, parts)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-pages.zip"`, name))
+	} else {
+		contentType, err = writeSrcsetMultipart(outBuf, parts)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Detail: fmt.Sprintf("Error while writing response: %s", err.Error()),
+		})
+		return
+	}
+	c.Header("X-Page-Count", strconv.Itoa(len(pages)))
+	c.Data(http.StatusOK, contentType, outBuf.Bytes())
+}
+
+// @Summary		Thumbnail
+// @Description	Produce a thumbnail filling the box of a named size (configured server-side, see GET /thumbnail/sizes)
+// @Description	or of width x height, the image is auto oriented, cover cropped and its metadata is stripped
+// @Description	the format default to webp when the Accept header allow it, otherwise png for transparent images or jpeg
+// @ID			thumbnail
+// @Accept		multipart/form-data
+// @Produce		image/jpeg,image/png,image/webp
+// @Param		file	formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Param		destination	formData	string	false	"bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature"
+// @Param		destination_signature	formData	string	false	"signature of the destination made with the signing secret"
+// @Param		destination_expires	formData	int	false	"expiry unix timestamp of destination_signature"
+// @Param		size	formData	string	false	"named size, e.g. small, medium or large"
+// @Param		width	formData	uint16	false	"thumbnail width, instead of size"
+// @Param		height	formData	uint16	false	"thumbnail height, default to width"
+// @Param		format	formData	string	false	"jpeg, png or webp (default: automatic)"
+// @Param		preset	formData	string	false	"preset name, replace the other parameters (see /presets)"
+// @Failure		400	{object}	ErrorResponse
+// @Success		201	{object}	destinationResponse
+//
+// @Router		/thumbnail [post]
+func thumbnail(c *gin.Context) {
+	var input thumbnailInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	options := utils.ThumbnailOptions{Format: input.Format}
+	switch {
+	case input.Size != "" && (input.Width != nil || input.Height != nil):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Size can't be combined with width and height"})
+		return
+	case input.Size != "":
+		size, ok := config.ThumbnailSizes[input.Size]
+		if !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Detail: fmt.Sprintf("Size %s is not configured", input.Size)})
+			return
+		}
+		options.Width, options.Height = size.Width, size.Height
+	case input.Width != nil:
+		options.Width, options.Height = *input.Width, *input.Width
+		if input.Height != nil {
+			options.Height = *input.Height
+		}
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "Size or width must be specified"})
+		return
+	}
+
+	if input.Format == "" {
+		options.AcceptWebp = strings.Contains(c.GetHeader("Accept"), "image/webp")
+		c.Header("Vary", "Accept")
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Thumbnail
+	outBuf := bytes.NewBuffer(nil)
+	format, err := processor.Thumbnail(inBuf, options, outBuf)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while creating thumbnail: %s", err.Error()),
+		})
+		return
+	}
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// @Summary		Thumbnail sizes
+// @Description	List the named sizes accepted by /thumbnail
+// @ID			thumbnail_sizes
+// @Produce		json
+// @Success		200	{object}	map[string]ThumbnailSize
+//
+// @Router		/thumbnail/sizes [get]
+func thumbnailSizes(c *gin.Context) {
+	c.JSON(http.StatusOK, config.ThumbnailSizes)
+}
+
+// @Summary		Image information
+// @Description	Return the codec, container, size, pixel format, bit depth, alpha, colour space, frame count,
+// @Description	duration (animations only), file size and EXIF/XMP/ICC presence of the image
+// @ID			image_info
+// @Accept		multipart/form-data
+// @Produce		json
+// @Param		file	formData	file	false	"image file, required unless source or image_url is given"
+// @Param		source	formData	string	false	"bucket/key of the source image in the storage, instead of file"
+// @Param		image_url	formData	string	false	"http or https URL of the image to download, instead of file"
+// @Success		200	{object}	utils.ImageInfo
+// @Failure		400	{object}	ErrorResponse
+//
+// @Router		/info [post]
+func imageInfo(c *gin.Context) {
+	var input imageInfoInputParameter
+
+	// Input verification
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	if input.File == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	// Get file buffer
+	inBuf, err := input.File.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	info, err := processor.Info(inBuf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Can't probe file, make sure the file is valid image: %s", err.Error()),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// @Summary		Serve transformed image
+// @Description	Serve an image from the configured storage (IMAGE_STORAGE_BACKEND) transformed according to the options segment
+// @Description	options are separated by "," e.g. rs:fit:300:200,q:3,f:webp ("-" serve the source untouched)
+// @Description	rs:<mode>:<width>:<height>, w:<width>, h:<height>, m:<mode>, bg:<colour>, c:<width>:<height>[:<gravity>], q:<level>, f:<format>
+// @Description	Responses carry a strong ETag and the configured Cache-Control, If-None-Match is answered with 304 Not Modified
+// @ID			serve_image
+// @Produce		image/jpeg,image/png,image/webp,image/bmp,image/gif,image/avif
+// @Param		options		path	string	true	"transformation options"
+// @Param		source		path	string	true	"bucket/key of the source image in the storage"
+// @Param		expires		query	int		false	"expiry unix timestamp of the signature"
+// @Param		signature	query	string	false	"URL signature, required when a signing secret is configured"
+// @Param		If-None-Match	header	string	false	"ETag of a previous response, answered with 304 when unchanged"
+//
+// @Router		/img/{options}/{source} [get]
+func serveImage(c *gin.Context) {
+	var pipeline utils.Pipeline
+	var err error
+	if name, ok := strings.CutPrefix(c.Param("options"), "preset:"); ok {
+		pipeline, err = lookupPreset(name)
+	} else {
+		pipeline, err = utils.ParsePathOptions(c.Param("options"))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Invalid options: %s", err.Error()),
+		})
+		return
+	}
+
+	// Process
+	outBuf := bytes.NewBuffer(nil)
+	format, err := processor.Pipeline(bytes.NewReader(c.MustGet(storageSourceKey).([]byte)), pipeline, outBuf, nil)
+	if err != nil {
+		c.JSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while processing: %s", err.Error()),
+		})
+		return
+	}
+	c.Header("Cache-Control", config.CacheControl)
+	respondData(c, utils.GetMimeType(format), outBuf.Bytes())
+}
+
+// applyPreset answer the single image endpoints with the pipeline of the preset form field when set,
+// so any of them can be called with e.g. preset=avatar instead of its own parameters
+func applyPreset(c *gin.Context) {
+	name := c.PostForm("preset")
+	if name == "" {
+		c.Next()
+		return
+	}
+
+	pipeline, err := lookupPreset(name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "File is missing"})
+		return
+	}
+
+	// Get file buffer
+	inBuf, err := fileHeader.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{
+			Detail: err.Error(),
+		})
+		return
+	}
+	defer inBuf.Close()
+
+	// Process
+	outBuf := bytes.NewBuffer(nil)
+	format, err := processor.Pipeline(inBuf, pipeline, outBuf, nil)
+	if err != nil {
+		c.AbortWithStatusJSON(processingStatus(err), ErrorResponse{
+			Detail: fmt.Sprintf("Error while processing: %s", err.Error()),
+		})
+		return
+	}
+	c.Data(http.StatusOK, utils.GetMimeType(format), outBuf.Bytes())
+	c.Abort()
+}
+
+// rejectPreset answer 400 to the requests with a preset form field on the endpoints whose response a preset
+// can't produce: several images, or a fixed format
+func rejectPreset(c *gin.Context) {
+	if c.PostForm("preset") != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{
+			Detail: fmt.Sprintf("Preset can't be used with %s", c.FullPath()),
+		})
+		return
+	}
+	c.Next()
+}
+
+// @Summary		Presets
+// @Description	List the presets configured server-side, each is a named operation chain (see /process)
+// @Description	accepted as the preset form field of every processing endpoint and as preset:<name> options of /img
+// @ID			presets
+// @Produce		json
+// @Success		200	{object}	map[string]presets.Preset
+//
+// @Router		/presets [get]
+func listPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Presets)
+}
+
+// verifySignature reject GET /img requests whose URL isn't signed with the configured secret
+func verifySignature(c *gin.Context) {
+	if config.SigningSecret == "" {
+		c.Next()
+		return
+	}
+
+	path := strings.TrimPrefix(c.Request.URL.Path, "/img")
+	err := urlsign.Verify(
+		[]byte(config.SigningSecret),
+		path,
+		c.Query(urlsign.ExpiresParam),
+		c.Query(urlsign.SignatureParam),
+		time.Now(),
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+			Detail: fmt.Sprintf("Invalid URL signature: %s", err.Error()),
+		})
+		return
+	}
+	c.Next()
+}
+
+// respondData answer with data and its strong ETag (SHA-256 of data, unless already set),
+// or with 304 Not Modified when the If-None-Match header of the request has this ETag
+func respondData(c *gin.Context, contentType string, data []byte) {
+	etag := c.Writer.Header().Get("ETag")
+	if etag == "" {
+		etag = fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+		c.Header("ETag", etag)
+	}
+	if etagMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// etagMatch report whether the If-None-Match header ifNoneMatch has etag, compared weakly as required by RFC 9110
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readSource replace the file of the request by the source=bucket/key object of objectStorage
+func readSource(c *gin.Context) {
+	reference := c.PostForm("source")
+	if reference == "" {
+		c.Next()
+		return
+	}
+	if _, err := c.FormFile("file"); err == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "File and source can't be combined"})
+		return
+	}
+	if objectStorage == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "Storage is not configured"})
+		return
+	}
+
+	data, key, ok := readStorageObject(c, reference)
+	if !ok {
+		return
+	}
+
+	if err := setFormFile(c, "file", path.Base(key), data); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// storageSourceKey is the context key of the source of GET /img read by readStorageSource
+const storageSourceKey = "storage_source"
+
+// readStorageSource read the bucket/key source of GET /img from objectStorage, its content is kept in the context
+// for storageCacheKey and serveImage
+func readStorageSource(c *gin.Context) {
+	if objectStorage == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Detail: "Image storage is not configured"})
+		return
+	}
+	data, _, ok := readStorageObject(c, strings.TrimPrefix(c.Param("source"), "/"))
+	if !ok {
+		return
+	}
+	c.Set(storageSourceKey, data)
+	c.Next()
+}
+
+// readStorageObject read the bucket/key reference from objectStorage and return its content and key,
+// the request is aborted when it can't be read
+func readStorageObject(c *gin.Context, reference string) ([]byte, string, bool) {
+	bucket, key, ok := parseStorageReference(c, "source", reference)
+	if !ok {
+		return nil, "", false
+	}
+	data, err := storage.Read(c.Request.Context(), objectStorage, bucket, key, config.SourceMaxBytes)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Detail: "Source not found"})
+		return nil, "", false
+	case errors.Is(err, storage.ErrTooLarge):
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Detail: fmt.Sprintf("Source is larger than %d bytes", config.SourceMaxBytes),
+		})
+		return nil, "", false
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadGateway, ErrorResponse{Detail: fmt.Sprintf("Error while reading source: %s", err.Error())})
+		return nil, "", false
+	}
+	return data, key, true
+}
+
+// parseStorageReference parse the bucket/key reference of the name object, the bucket must be one of
+// IMAGE_STORAGE_BUCKETS and the key start with IMAGE_STORAGE_KEY_PREFIX, the request is aborted otherwise
+func parseStorageReference(c *gin.Context, name string, reference string) (string, string, bool) {
+	bucket, key, err := storage.ParseReference(reference)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: fmt.Sprintf("Invalid %s: %s", name, err.Error())})
+		return "", "", false
+	}
+	if !slices.Contains(config.StorageBuckets, bucket) {
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Detail: fmt.Sprintf("Bucket %q is not allowed", bucket)})
+		return "", "", false
+	}
+	if !strings.HasPrefix(key, config.StorageKeyPrefix) {
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+			Detail: fmt.Sprintf("Key of the %s must start with %q", name, config.StorageKeyPrefix),
+		})
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// fetchImageURL replace the file of the request by the image downloaded from image_url
+func fetchImageURL(c *gin.Context) {
+	imageURL := c.PostForm("image_url")
+	if imageURL == "" {
+		c.Next()
+		return
+	}
+	if _, err := c.FormFile("file"); err == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "File and image_url can't be combined"})
+		return
+	}
+	if c.PostForm("source") != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "Source and image_url can't be combined"})
+		return
+	}
+
+	image, err := imageFetcher.Fetch(c.Request.Context(), imageURL)
+	switch {
+	case errors.Is(err, fetch.ErrInvalidURL):
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: fmt.Sprintf("Invalid image_url: %s", err.Error())})
+		return
+	case errors.Is(err, fetch.ErrBlockedAddress):
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Detail: fmt.Sprintf("Can't fetch image_url: %s", err.Error())})
+		return
+	case errors.Is(err, fetch.ErrTooLarge):
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Detail: fmt.Sprintf("Image is larger than %d bytes", config.SourceMaxBytes),
+		})
+		return
+	case errors.Is(err, fetch.ErrContentType):
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, ErrorResponse{Detail: fmt.Sprintf("Can't fetch image_url: %s", err.Error())})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadGateway, ErrorResponse{Detail: fmt.Sprintf("Error while fetching image_url: %s", err.Error())})
+		return
+	}
+
+	if err := setFormFile(c, "file", image.FileName, image.Data); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// setFormFile rebuild the multipart body of the request with its values and files plus data as the field file,
+// so that the handlers bind data like an uploaded file
+func setFormFile(c *gin.Context, field string, fileName string, data []byte) error {
+	var values url.Values
+	var files map[string][]*multipart.FileHeader
+	form, err := c.MultipartForm()
+	switch {
+	case errors.Is(err, http.ErrNotMultipart):
+		values = c.Request.PostForm
+	case err != nil:
+		return err
+	default:
+		values, files = form.Value, form.File
+		defer form.RemoveAll()
+	}
+
+	body := bytes.NewBuffer(nil)
+	multipartWriter := multipart.NewWriter(body)
+	for _, name := range sortedKeys(values) {
+		for _, value := range values[name] {
+			if err := multipartWriter.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range sortedKeys(files) {
+		for _, fileHeader := range files[name] {
+			fileData, err := readFormFile(fileHeader)
+			if err != nil {
+				return err
+			}
+			part, err := multipartWriter.CreateFormFile(name, fileHeader.Filename)
+			if err != nil {
+				return err
+			}
+			part.Write(fileData)
+		}
+	}
+	part, err := multipartWriter.CreateFormFile(field, fileName)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := multipartWriter.Close(); err != nil {
+		return err
+	}
+
+	c.Request.Body = io.NopCloser(body)
+	c.Request.ContentLength = int64(body.Len())
+	c.Request.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+	c.Request.Form, c.Request.PostForm, c.Request.MultipartForm = nil, nil, nil
+	return nil
+}
+
+// bufferWriter keep the response body written by the handlers instead of sending it
+type bufferWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) WriteString(data string) (int, error) {
+	return w.body.WriteString(data)
+}
+
+// writeDestination write the output of the next handlers to the destination=bucket/key object of objectStorage
+// and answer with its location (201) instead of the output, errors of the handlers are sent as is
+func writeDestination(c *gin.Context) {
+	reference := c.PostForm("destination")
+	if reference == "" {
+		c.Next()
+		return
+	}
+	if objectStorage == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Detail: "Storage is not configured"})
+		return
+	}
+	bucket, key, ok := parseStorageReference(c, "destination", reference)
+	if !ok {
+		return
+	}
+	if err := authorizeDestination(c, reference); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Detail: fmt.Sprintf("Destination not allowed: %s", err.Error())})
+		return
+	}
+
+	writer := &bufferWriter{ResponseWriter: c.Writer, body: bytes.NewBuffer(nil)}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+	if c.Writer.Status() != http.StatusOK {
+		c.Writer.Write(writer.body.Bytes())
+		return
+	}
+
+	// Replace the output headers by the ones of the JSON answer
+	mimeType := c.Writer.Header().Get("Content-Type")
+	for _, name := range []string{"Content-Type", "Content-Disposition", "ETag", "Vary"} {
+		c.Writer.Header().Del(name)
+	}
+	location, err := objectStorage.Put(c.Request.Context(), bucket, key, writer.body.Bytes(), mimeType)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Destination bucket not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, ErrorResponse{Detail: fmt.Sprintf("Error while writing destination: %s", err.Error())})
+		return
+	}
+	c.Header("Location", location)
+	c.JSON(http.StatusCreated, destinationResponse{
+		Destination: reference,
+		Location:    location,
+		MimeType:    mimeType,
+		Size:        writer.body.Len(),
+	})
+}
+
+// authorizeDestination check the request may write the destination reference: it has the IMAGE_DESTINATION_TOKEN
+// bearer token, or the destination_signature of reference made with IMAGE_SIGNING_SECRET
+func authorizeDestination(c *gin.Context, reference string) error {
+	if config.DestinationToken != "" {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(config.DestinationToken)) == 1 {
+			return nil
+		}
+	}
+	if config.SigningSecret != "" {
+		return urlsign.Verify(
+			[]byte(config.SigningSecret),
+			urlsign.DestinationPath(reference),
+			c.PostForm(urlsign.DestinationExpiresField),
+			c.PostForm(urlsign.DestinationSignatureField),
+			time.Now(),
+		)
+	}
+	if config.DestinationToken != "" {
+		return errors.New("destination token is invalid")
+	}
+	return errors.New("destinations are not enabled")
+}
+
+// cacheWriter copy the response body written by the handlers
+type cacheWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// cacheResponse answer with the response stored in resultCache for the key of the request (X-Cache: HIT),
+// or run the next handlers and store their response when successful (X-Cache: MISS)
+// key return false when the request can't be cached, the handlers then report the error
+func cacheResponse(key func(c *gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if resultCache == nil {
+			c.Next()
+			return
+		}
+		cacheKey, ok := key(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		c.Header("X-Cache-Key", cacheKey)
+
+		if entry, tier, ok := resultCache.Get(cacheKey); ok {
+			for name, value := range entry.Header {
+				c.Header(name, value)
+			}
+			c.Header("X-Cache", "HIT")
+			c.Header("X-Cache-Tier", string(tier))
+			if c.Request.Method == http.MethodGet {
+				respondData(c, entry.Header["Content-Type"], entry.Data)
+			} else {
+				c.Data(http.StatusOK, entry.Header["Content-Type"], entry.Data)
+			}
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Cache", "MISS")
+		writer := &cacheWriter{ResponseWriter: c.Writer, body: bytes.NewBuffer(nil)}
+		c.Writer = writer
+		c.Next()
+		if writer.Status() != http.StatusOK {
+			return
+		}
+
+		entry := cache.Entry{Data: writer.body.Bytes(), Header: map[string]string{}}
+		for name, values := range writer.Header() {
+			if len(values) > 0 && name != "Content-Length" && !strings.HasPrefix(name, "X-Cache") {
+				entry.Header[name] = values[0]
+			}
+		}
+		if err := resultCache.Set(cacheKey, entry); err != nil && !errors.Is(err, cache.ErrTooLarge) {
+			log.Printf("Can't cache response: %s", err.Error())
+		}
+	}
+}
+
+// formCacheKey return the cache key of multipart requests: the uploaded files, the normalised form values,
+// the names of the files when the response includes them and the values of the request headers
+func formCacheKey(fileNames bool, headers ...string) func(c *gin.Context) (string, bool) {
+	return func(c *gin.Context) (string, bool) {
+		form, err := c.MultipartForm()
+		if err != nil || len(form.File) == 0 {
+			return "", false
+		}
+
+		params := []string{c.FullPath(), cacheSettings()}
+		var inputs [][]byte
+		for _, name := range sortedKeys(form.File) {
+			for _, fileHeader := range form.File[name] {
+				data, err := readFormFile(fileHeader)
+				if err != nil {
+					return "", false
+				}
+				inputs = append(inputs, data)
+				if fileNames {
+					params = append(params, fmt.Sprintf("%s:%s", name, fileHeader.Filename))
+				} else {
+					params = append(params, name)
+				}
+			}
+		}
+		for _, name := range sortedKeys(form.Value) {
+			for _, value := range form.Value[name] {
+				if value = normalizeFormValue(name, value); value != "" {
+					params = append(params, fmt.Sprintf("%s=%s", name, value))
+				}
+			}
+		}
+		for _, header := range headers {
+			params = append(params, fmt.Sprintf("%s: %s", header, c.GetHeader(header)))
+		}
+		return cache.Key(inputs, params...), true
+	}
+}
+
+// storageCacheKey return the cache key of GET /img requests: the source read by readStorageSource and the options
+func storageCacheKey(c *gin.Context) (string, bool) {
+	data, ok := c.Get(storageSourceKey)
+	if !ok {
+		return "", false
+	}
+	return cache.Key([][]byte{data.([]byte)}, c.FullPath(), cacheSettings(), c.Param("options")), true
+}
+
+// cacheSettings return the settings the responses depend on, so that the cached responses are not reused
+// once they changed
+func cacheSettings() string {
+	settings, _ := json.Marshal(struct {
+		Backend        string
+		Presets        presets.Presets
+		ThumbnailSizes map[string]ThumbnailSize
+	}{processor.Name(), config.Presets, config.ThumbnailSizes})
+	return string(settings)
+}
+
+// normalizeFormValue trim value and normalise the formats and operations, so that equivalent requests share a cache key
+func normalizeFormValue(name string, value string) string {
+	value = strings.TrimSpace(value)
+	switch name {
+	case "target_format", "format":
+		return utils.NormalizeFormat(value)
+	case "source", "image_url", "destination":
+		// The source object and the downloaded image are part of the inputs, the destination doesn't change the output
+		return ""
+	case "operations":
+		compacted := bytes.NewBuffer(nil)
+		if err := json.Compact(compacted, []byte(value)); err == nil {
+			return compacted.String()
+		}
+	}
+	return value
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// requireAdmin check the IMAGE_ADMIN_TOKEN bearer token of the admin routes
+func requireAdmin(c *gin.Context) {
+	if config.AdminToken == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Detail: "Admin API is not configured"})
+		return
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Detail: "Invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+// @Summary		Cache statistics
+// @Description	Number of responses and bytes held by the memory and disk tiers of the cache
+// @Description	Requires the IMAGE_ADMIN_TOKEN bearer token
+// @ID			cache_stats
+// @Produce		json
+// @Param		Authorization	header	string	true	"Bearer <IMAGE_ADMIN_TOKEN>"
+// @Success		200	{object}	cache.Stats
+// @Failure		401	{object}	ErrorResponse
+// @Failure		404	{object}	ErrorResponse
+//
+// @Router		/cache [get]
+func cacheStats(c *gin.Context) {
+	if resultCache == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Cache is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, resultCache.Stats())
+}
+
+// @Summary		Purge cache
+// @Description	Remove every cached response, or only the one whose key is given (X-Cache-Key response header)
+// @Description	Requires the IMAGE_ADMIN_TOKEN bearer token
+// @ID			purge_cache
+// @Produce		json
+// @Param		Authorization	header	string	true	"Bearer <IMAGE_ADMIN_TOKEN>"
+// @Param		key				path	string	false	"cache key"
+// @Success		200	{object}	cachePurgeResponse
+// @Failure		401	{object}	ErrorResponse
+// @Failure		404	{object}	ErrorResponse
+//
+// @Router		/cache [delete]
+// @Router		/cache/{key} [delete]
+func purgeCache(c *gin.Context) {
+	if resultCache == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Cache is disabled"})
+		return
+	}
+
+	key := c.Param("key")
+	if key == "" {
+		c.JSON(http.StatusOK, cachePurgeResponse{Purged: resultCache.Purge()})
+		return
+	}
+	if !resultCache.Delete(key) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Detail: "Cache entry not found"})
+		return
 	}
-	c.Data(http.StatusOK, fmt.Sprintf("image/%s", format), outBuf.Bytes())
+	c.JSON(http.StatusOK, cachePurgeResponse{Purged: 1})
 }
 
 func setupRouter() *gin.Engine {
 	r := gin.Default()
 	r.StaticFile("/favicon.ico", "./favicon.ico")
-	r.POST("/convert_png_to_jpeg", convertPngToJpeg)
-	r.POST("/resize_image", resizeImage)
-	r.POST("/compress_image", compressImage)
+	r.POST("/convert", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), applyPreset, convertImage)
+	r.POST("/convert_png_to_jpeg", rejectPreset, fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), convertPngToJpeg)
+	r.POST("/resize_image", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), applyPreset, resizeImage)
+	r.POST("/crop_image", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), applyPreset, cropImage)
+	r.POST("/transform_image", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), applyPreset, transformImage)
+	r.POST("/compress_image", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), applyPreset, compressImage)
+	r.POST("/process", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false)), processImage)
+	r.POST("/batch", batchProcess)
+	r.POST("/srcset", rejectPreset, fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(true)), srcset)
+	r.POST("/split_pages", rejectPreset, fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(true)), splitPages)
+	r.POST("/thumbnail", fetchImageURL, readSource, writeDestination, cacheResponse(formCacheKey(false, "Accept")), applyPreset, thumbnail)
+	r.GET("/thumbnail/sizes", thumbnailSizes)
+	r.POST("/info", fetchImageURL, readSource, imageInfo)
+	r.GET("/presets", listPresets)
+	r.POST("/jobs", fetchImageURL, readSource, submitJob)
+	r.GET("/jobs/:id", getJob)
+	r.GET("/jobs/:id/result", getJobResult)
+	r.GET("/img/:options/*source", verifySignature, readStorageSource, cacheResponse(storageCacheKey), serveImage)
+	r.GET("/cache", requireAdmin, cacheStats)
+	r.DELETE("/cache", requireAdmin, purgeCache)
+	r.DELETE("/cache/:key", requireAdmin, purgeCache)
 
 	// swagger
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
@@ -1,17 +1,37 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rudcode/go_image_converter_api/internal/batch"
+	"github.com/rudcode/go_image_converter_api/internal/cache"
+	"github.com/rudcode/go_image_converter_api/internal/fetch"
+	"github.com/rudcode/go_image_converter_api/internal/jobs"
+	"github.com/rudcode/go_image_converter_api/internal/presets"
+	"github.com/rudcode/go_image_converter_api/internal/storage"
 	"github.com/rudcode/go_image_converter_api/internal/utils"
+	"github.com/rudcode/go_image_converter_api/pkg/urlsign"
+	"github.com/rudcode/go_image_converter_api/pkg/webhook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func AssertImageSizeEqual(t *testing.T, inBuf io.Reader, width uint16, height uint16) {
@@ -41,10 +61,10 @@ func TestConvertPngToJpeg(t *testing.T) {
 		height   uint16
 		wantCode int
 	}{
-		{"../../test/data/test_1000x1000.bmp", 1000, 1000, http.StatusBadRequest},
-		{"../../test/data/test_1000x1000.jpg", 1000, 1000, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.bmp", 1000, 1000, http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", 1000, 1000, http.StatusOK},
 		{"../../test/data/test_1000x1000.png", 1000, 1000, http.StatusOK},
-		{"../../test/data/test_1000x1000.webp", 1000, 1000, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.webp", 1000, 1000, http.StatusOK},
 		{"../../test/data/test_1000x625.png", 1000, 625, http.StatusOK},
 		{"../../test/data/test_625x1000.png", 625, 1000, http.StatusOK},
 	}
@@ -86,6 +106,77 @@ func TestConvertPngToJpeg(t *testing.T) {
 	}
 }
 
+func TestConvertImage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName     string
+		targetFormat string
+		width        uint16
+		height       uint16
+		wantFormat   string
+		wantMimeType string
+		wantCode     int
+	}{
+		{"../../test/data/test_1000x1000.bmp", "jpeg", 1000, 1000, "mjpeg", "image/jpeg", http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", "png", 1000, 1000, "png", "image/png", http.StatusOK},
+		{"../../test/data/test_1000x1000.png", "jpg", 1000, 1000, "mjpeg", "image/jpeg", http.StatusOK},
+		{"../../test/data/test_1000x1000.webp", "bmp", 1000, 1000, "bmp", "image/bmp", http.StatusOK},
+		{"../../test/data/test_1000x625.png", "webp", 1000, 625, "webp", "image/webp", http.StatusOK},
+		{"../../test/data/test_625x1000.png", "gif", 625, 1000, "gif", "image/gif", http.StatusOK},
+		{"../../test/data/test_1000x1000.png", "avif", 1000, 1000, "av1", "image/avif", http.StatusOK},
+		{"../../test/data/test_320x180.avif", "webp", 320, 180, "webp", "image/webp", http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", "tiff", 1000, 1000, "tiff", "image/tiff", http.StatusOK},
+		{"../../test/data/test_100x50_3_pages.tiff", "png", 100, 50, "png", "image/png", http.StatusOK},
+		{"../../test/data/test_1000x1000.png", "tga", 1000, 1000, "", "", http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", "", 1000, 1000, "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestConvertImage %s to %s",
+			tt.fileName, tt.targetFormat,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create target_format field form
+			formTargetFormat, err := multipartWriter.CreateFormField("target_format")
+			assert.NoError(err)
+			formTargetFormat.Write([]byte(tt.targetFormat))
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/convert", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.width, tt.height)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			}
+		})
+	}
+}
+
 func TestResizeImage(t *testing.T) {
 	assert := assert.New(t)
 	router := setupRouter()
@@ -170,6 +261,200 @@ func TestResizeImage(t *testing.T) {
 	}
 }
 
+func TestResizeImageMode(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName   string
+		width      string
+		height     string
+		mode       string
+		wantWidth  uint16
+		wantHeight uint16
+		wantCode   int
+	}{
+		{"../../test/data/test_1000x625.png", "400", "400", "fit", 400, 250, http.StatusOK},
+		{"../../test/data/test_1000x625.png", "400", "400", "cover", 400, 400, http.StatusOK},
+		{"../../test/data/test_1000x625.png", "400", "400", "pad", 400, 400, http.StatusOK},
+		{"../../test/data/test_1000x625.png", "400", "400", "fill", 400, 400, http.StatusOK},
+		{"../../test/data/test_1000x625.png", "500", "", "", 500, 313, http.StatusOK},
+		{"../../test/data/test_625x1000.png", "", "500", "fit", 313, 500, http.StatusOK},
+		{"../../test/data/test_1000x625.png", "", "", "fit", 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", "0", "", "fit", 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", "400", "400", "stretch", 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestResizeImageMode %s:%s %s",
+			tt.width, tt.height, tt.mode,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create optional field forms
+			fields := map[string]string{"width": tt.width, "height": tt.height, "mode": tt.mode}
+			for name, value := range fields {
+				if value == "" {
+					continue
+				}
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/resize_image", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCropImage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName   string
+		fields     map[string]string
+		wantWidth  uint16
+		wantHeight uint16
+		wantCode   int
+	}{
+		{"../../test/data/test_1000x1000.png", map[string]string{"x": "100", "y": "50", "width": "300", "height": "200"}, 300, 200, http.StatusOK},
+		{"../../test/data/test_1000x625.png", map[string]string{"width": "625", "height": "625"}, 625, 625, http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"width": "300", "height": "200", "gravity": "south-west"}, 300, 200, http.StatusOK},
+		{"../../test/data/test_1000x1000.webp", map[string]string{"width": "300", "height": "200", "gravity": "north"}, 300, 200, http.StatusOK},
+		{"../../test/data/test_1000x625.png", map[string]string{"width": "700", "height": "700"}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", map[string]string{"x": "900", "y": "0", "width": "300", "height": "200"}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", map[string]string{"x": "100", "width": "300", "height": "200"}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", map[string]string{"x": "0", "y": "0", "width": "300", "height": "200", "gravity": "north"}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", map[string]string{"width": "300"}, 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCropImage %s %v",
+			tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/crop_image", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestTransformImage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName   string
+		fields     map[string]string
+		wantWidth  uint16
+		wantHeight uint16
+		wantCode   int
+	}{
+		{"../../test/data/test_1000x625.png", map[string]string{"rotate": "90"}, 625, 1000, http.StatusOK},
+		{"../../test/data/test_1000x625.png", map[string]string{"rotate": "-90", "flip": "horizontal"}, 625, 1000, http.StatusOK},
+		{"../../test/data/test_1000x625.png", map[string]string{"rotate": "45", "background": "white"}, 1149, 1149, http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"flip": "vertical"}, 1000, 1000, http.StatusOK},
+		{"../../test/data/test_1000x625_orientation_6.jpg", map[string]string{"auto_orient": "true"}, 625, 1000, http.StatusOK},
+		{"../../test/data/test_1000x625.png", map[string]string{}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", map[string]string{"flip": "diagonal"}, 0, 0, http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", map[string]string{"rotate": "quarter"}, 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestTransformImage %s %v",
+			tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/transform_image", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
 func TestCompressImage(t *testing.T) {
 	assert := assert.New(t)
 	router := setupRouter()
@@ -293,3 +578,1887 @@ func TestCompressImage(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressImageMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName    string
+		fields      map[string]string
+		wantCode    int
+		wantFormat  string
+		wantQuality bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"max_bytes": "50000"}, http.StatusOK, "mjpeg", true},
+		{"../../test/data/test_1000x1000.webp", map[string]string{"max_bytes": "20000"}, http.StatusOK, "webp", true},
+		{"../../test/data/test_1000x1000.png", map[string]string{"max_bytes": "20000", "downscale": "true"}, http.StatusOK, "png", false},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"max_bytes": "50000", "compression_level": "3"}, http.StatusBadRequest, "", false},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{}, http.StatusBadRequest, "", false},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"max_bytes": "0"}, http.StatusBadRequest, "", false},
+		{"../../test/data/test_1000x1000.png", map[string]string{"max_bytes": "100"}, http.StatusBadRequest, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCompressImageMaxBytes %s %v",
+			tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/compress_image", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			maxBytes, _ := strconv.Atoi(tt.fields["max_bytes"])
+			assert.LessOrEqual(res.Body.Len(), maxBytes)
+			assert.Equal(tt.wantQuality, res.Header().Get("X-Image-Quality") != "")
+			width, _ := strconv.Atoi(res.Header().Get("X-Image-Width"))
+			height, _ := strconv.Atoi(res.Header().Get("X-Image-Height"))
+			AssertImageFormatEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), uint16(width), uint16(height))
+		})
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		path       string
+		fileName   string
+		fields     map[string]string
+		wantCode   int
+		wantFormat string
+	}{
+		{"/convert", "../../test/data/test_1000x1000.png", map[string]string{"target_format": "jpeg", "quality": "90", "chroma_subsampling": "444"}, http.StatusOK, "mjpeg"},
+		{"/convert", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "png", "palette": "true"}, http.StatusOK, "png"},
+		{"/convert", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "webp", "lossless": "true", "method": "0"}, http.StatusOK, "webp"},
+		{"/convert", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "jpeg", "progressive": "true"}, http.StatusBadRequest, ""},
+		{"/convert", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "webp", "near_lossless": "60"}, http.StatusBadRequest, ""},
+		{"/convert", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "bmp", "quality": "80"}, http.StatusBadRequest, ""},
+		{"/compress_image", "../../test/data/test_1000x1000.webp", map[string]string{"quality": "50", "method": "6"}, http.StatusOK, "webp"},
+		{"/compress_image", "../../test/data/test_1000x1000.png", map[string]string{"compression_level": "1", "png_compression_level": "9"}, http.StatusOK, "png"},
+		{"/compress_image", "../../test/data/test_1000x1000.jpg", map[string]string{"max_bytes": "50000", "quality": "50"}, http.StatusBadRequest, ""},
+		{"/compress_image", "../../test/data/test_1000x1000.jpg", map[string]string{"lossless": "true"}, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestEncoderOptions %s %s %v",
+			tt.path, tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			AssertImageFormatEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), 1000, 1000)
+		})
+	}
+}
+
+func TestGoBackend(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	// Process the requests without ffmpeg
+	backend := processor
+	processor = utils.GoProcessor{}
+	defer func() { processor = backend }()
+
+	var tests = []struct {
+		path         string
+		fileName     string
+		fields       map[string]string
+		wantFormat   string
+		wantMimeType string
+		wantWidth    int
+		wantHeight   int
+		wantCode     int
+	}{
+		{"/convert_png_to_jpeg", "../../test/data/test_1000x625.png", nil, "mjpeg", "image/jpeg", 1000, 625, http.StatusOK},
+		{"/convert_png_to_jpeg", "../../test/data/test_1000x1000.jpg", map[string]string{"target_format": "png"}, "mjpeg", "image/jpeg", 1000, 1000, http.StatusOK},
+		{"/convert", "../../test/data/test_1000x1000.webp", map[string]string{"target_format": "png"}, "png", "image/png", 1000, 1000, http.StatusOK},
+		{"/convert", "../../test/data/test_1000x1000.png", map[string]string{"target_format": "jpeg", "quality": "80"}, "mjpeg", "image/jpeg", 1000, 1000, http.StatusOK},
+		{"/convert", "../../test/data/test_1000x1000.png", map[string]string{"target_format": "jpeg", "progressive": "true"}, "", "", 0, 0, http.StatusBadRequest},
+		{"/convert", "../../test/data/test_1000x1000.png", map[string]string{"target_format": "webp"}, "", "", 0, 0, http.StatusBadRequest},
+		{"/resize_image", "../../test/data/test_1000x625.png", map[string]string{"width": "400", "height": "400", "mode": "fit"}, "png", "image/png", 400, 250, http.StatusOK},
+		{"/resize_image", "../../test/data/test_1000x1000.bmp", map[string]string{"width": "200", "height": "100", "mode": "cover"}, "bmp", "image/bmp", 200, 100, http.StatusOK},
+		{"/resize_image", "../../test/data/test_1000x1000.webp", map[string]string{"width": "200"}, "", "", 0, 0, http.StatusBadRequest},
+		{"/compress_image", "../../test/data/test_1000x1000.jpg", map[string]string{"compression_level": "5"}, "mjpeg", "image/jpeg", 1000, 1000, http.StatusOK},
+		{"/compress_image", "../../test/data/test_1000x1000.png", map[string]string{"png_compression_level": "9"}, "png", "image/png", 1000, 1000, http.StatusOK},
+		{"/compress_image", "../../test/data/test_1000x1000.jpg", map[string]string{"max_bytes": "60000"}, "mjpeg", "image/jpeg", 1000, 1000, http.StatusOK},
+		{"/crop_image", "../../test/data/test_1000x1000.jpg", map[string]string{"width": "300", "height": "200"}, "mjpeg", "image/jpeg", 300, 200, http.StatusOK},
+		{"/transform_image", "../../test/data/test_1000x625.png", map[string]string{"rotate": "90"}, "png", "image/png", 625, 1000, http.StatusOK},
+		{"/transform_image", "../../test/data/test_1000x625.png", map[string]string{"rotate": "45"}, "", "", 0, 0, http.StatusNotImplemented},
+		{"/thumbnail", "../../test/data/test_1000x1000.jpg", map[string]string{"width": "200", "height": "100"}, "mjpeg", "image/jpeg", 200, 100, http.StatusOK},
+		{"/process", "../../test/data/test_1000x1000.jpg", map[string]string{"operations": `[{"op":"resize","width":400},{"op":"crop","width":200,"height":100},{"op":"convert","format":"png"}]`}, "png", "image/png", 200, 100, http.StatusOK},
+		{"/process", "../../test/data/test_1000x1000.jpg", map[string]string{"operations": `[{"op":"rotate","angle":45}]`}, "", "", 0, 0, http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoBackend %s %s %v",
+			tt.path, tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+				probe, err := utils.GoProcessor{}.Probe(bytes.NewReader(res.Body.Bytes()))
+				assert.NoError(err)
+				assert.Equal(tt.wantFormat, probe.Format)
+				assert.Equal(tt.wantWidth, probe.Width)
+				assert.Equal(tt.wantHeight, probe.Height)
+			}
+		})
+	}
+}
+
+// unsupportedProcessor is a backend supporting neither conversions nor resizes
+type unsupportedProcessor struct {
+	utils.GoProcessor
+}
+
+func (unsupportedProcessor) Convert(inBuf io.ReadSeeker, targetFormat string, options utils.EncoderOptions, outBuf io.Writer) error {
+	return fmt.Errorf("converting is not supported by the test backend: %w", utils.ErrNotSupported)
+}
+
+func (unsupportedProcessor) Resize(inBuf io.ReadSeeker, format string, width uint16, height uint16, mode string, background string, outBuf io.Writer) error {
+	return fmt.Errorf("resizing is not supported by the test backend: %w", utils.ErrNotSupported)
+}
+
+func TestNotSupported(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	backend := processor
+	processor = unsupportedProcessor{}
+	defer func() { processor = backend }()
+
+	source, err := os.ReadFile("../../test/data/test_1000x625.png")
+	assert.NoError(err)
+
+	var tests = []struct {
+		path   string
+		fields map[string]string
+	}{
+		{"/convert", map[string]string{"target_format": "jpeg"}},
+		{"/convert_png_to_jpeg", nil},
+		{"/resize_image", map[string]string{"width": "100"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestNotSupported %s", tt.path), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+			formFile, err := multipartWriter.CreateFormFile("file", "test_1000x625.png")
+			assert.NoError(err)
+			formFile.Write(source)
+			for name, value := range tt.fields {
+				assert.NoError(multipartWriter.WriteField(name, value))
+			}
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(http.StatusNotImplemented, res.Code, res.Body.String())
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	// Process the requests without ffmpeg, in an empty cache
+	backend, cached, adminToken := processor, resultCache, config.AdminToken
+	processor = utils.GoProcessor{}
+	defer func() { processor, resultCache, config.AdminToken = backend, cached, adminToken }()
+	var err error
+	resultCache, err = cache.New(64<<20, "", 0)
+	assert.NoError(err)
+
+	convert := func(fileName string, targetFormat string) *httptest.ResponseRecorder {
+		body := bytes.NewBuffer(nil)
+		multipartWriter := multipart.NewWriter(body)
+		formFile, err := multipartWriter.CreateFormFile("file", fileName)
+		assert.NoError(err)
+		data, err := os.ReadFile(fileName)
+		assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+		formFile.Write(data)
+		assert.NoError(multipartWriter.WriteField("target_format", targetFormat))
+		assert.NoError(multipartWriter.Close())
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/convert", body)
+		assert.NoError(err)
+		req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	var tests = []struct {
+		fileName     string
+		targetFormat string
+		wantCache    string
+		wantCode     int
+	}{
+		{"../../test/data/test_1000x625.png", "jpeg", "MISS", http.StatusOK},
+		{"../../test/data/test_1000x625.png", "jpeg", "HIT", http.StatusOK},
+		{"../../test/data/test_1000x625.png", " JPG", "HIT", http.StatusOK},
+		{"../../test/data/test_1000x625.png", "png", "MISS", http.StatusOK},
+		{"../../test/data/test_625x1000.png", "jpeg", "MISS", http.StatusOK},
+		{"../../test/data/test_1000x625.png", "webp", "MISS", http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", "webp", "MISS", http.StatusBadRequest},
+	}
+	var first *httptest.ResponseRecorder
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCache %d %s to %s",
+			i, tt.fileName, tt.targetFormat,
+		), func(t *testing.T) {
+			res := convert(tt.fileName, tt.targetFormat)
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			assert.Equal(tt.wantCache, res.Header().Get("X-Cache"))
+			assert.Len(res.Header().Get("X-Cache-Key"), 64)
+			if first == nil {
+				first = res
+			}
+			if tt.wantCache == "HIT" {
+				assert.Equal("memory", res.Header().Get("X-Cache-Tier"))
+				assert.Equal(first.Header().Get("X-Cache-Key"), res.Header().Get("X-Cache-Key"))
+				assert.Equal(first.Header().Get("Content-Type"), res.Header().Get("Content-Type"))
+				assert.Equal(first.Body.Bytes(), res.Body.Bytes())
+			}
+		})
+	}
+	assert.Equal(3, resultCache.Stats().MemoryEntries)
+
+	// Disk tier
+	resultCache, err = cache.New(0, t.TempDir(), 64<<20)
+	assert.NoError(err)
+	assert.Equal("MISS", convert("../../test/data/test_1000x625.png", "jpeg").Header().Get("X-Cache"))
+	res := convert("../../test/data/test_1000x625.png", "jpeg")
+	assert.Equal("HIT", res.Header().Get("X-Cache"))
+	assert.Equal("disk", res.Header().Get("X-Cache-Tier"))
+	assert.Equal(first.Body.Bytes(), res.Body.Bytes())
+	convert("../../test/data/test_625x1000.png", "jpeg")
+
+	var adminTests = []struct {
+		name       string
+		adminToken string
+		method     string
+		path       string
+		token      string
+		wantCode   int
+		wantBody   string
+	}{
+		{"not configured", "", http.MethodDelete, "/cache", "secret", http.StatusNotFound, ""},
+		{"missing token", "secret", http.MethodDelete, "/cache", "", http.StatusUnauthorized, ""},
+		{"invalid token", "secret", http.MethodDelete, "/cache", "wrong", http.StatusUnauthorized, ""},
+		{"stats", "secret", http.MethodGet, "/cache", "secret", http.StatusOK, `"disk_entries":2`},
+		{"purge key", "secret", http.MethodDelete, "/cache/" + res.Header().Get("X-Cache-Key"), "secret", http.StatusOK, `{"purged":1}`},
+		{"purged key", "secret", http.MethodDelete, "/cache/" + res.Header().Get("X-Cache-Key"), "secret", http.StatusNotFound, ""},
+		{"purge all", "secret", http.MethodDelete, "/cache", "secret", http.StatusOK, `{"purged":1}`},
+	}
+	for _, tt := range adminTests {
+		t.Run(fmt.Sprintf(
+			"TestCache admin %s",
+			tt.name,
+		), func(t *testing.T) {
+			config.AdminToken = tt.adminToken
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			assert.NoError(err)
+			if tt.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tt.token)
+			}
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			assert.Contains(res.Body.String(), tt.wantBody)
+		})
+	}
+	assert.Equal("MISS", convert("../../test/data/test_1000x625.png", "jpeg").Header().Get("X-Cache"))
+}
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	// Process the requests without ffmpeg, nor cache
+	root := t.TempDir()
+	backend, cached, objects, settings := processor, resultCache, objectStorage, config
+	processor, resultCache, objectStorage = utils.GoProcessor{}, nil, storage.NewLocal(root)
+	config.StorageBuckets = []string{"images", "outputs", "missing"}
+	config.DestinationToken, config.SigningSecret = "token", "secret"
+	defer func() { processor, resultCache, objectStorage, config = backend, cached, objects, settings }()
+
+	assert.NoError(os.MkdirAll(filepath.Join(root, "images", "products"), 0o755))
+	assert.NoError(os.MkdirAll(filepath.Join(root, "private"), 0o755))
+	assert.NoError(os.Mkdir(filepath.Join(root, "outputs"), 0o755))
+	source, err := os.ReadFile("../../test/data/test_1000x625.png")
+	assert.NoError(err)
+	assert.NoError(os.WriteFile(filepath.Join(root, "images", "products", "shoe.png"), source, 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(root, "private", "shoe.png"), source, 0o644))
+	signature := urlsign.Sign([]byte("secret"), urlsign.DestinationPath("outputs/signed.jpg"), 0)
+
+	var tests = []struct {
+		name            string
+		path            string
+		file            bool
+		multipart       bool
+		fields          map[string]string
+		token           string
+		wantCode        int
+		wantMimeType    string
+		wantDestination string
+	}{
+		{"source", "/convert", false, true, map[string]string{"source": "images/products/shoe.png", "target_format": "jpeg"}, "", http.StatusOK, "image/jpeg", ""},
+		{"urlencoded source", "/resize_image", false, false, map[string]string{"source": "images/products/shoe.png", "width": "100"}, "", http.StatusOK, "image/png", ""},
+		{"source to destination", "/convert", false, true, map[string]string{"source": "images/products/shoe.png", "target_format": "jpeg", "destination": "outputs/shoe.jpg"}, "token", http.StatusCreated, "image/jpeg", "outputs/shoe.jpg"},
+		{"file to destination", "/compress_image", true, true, map[string]string{"compression_level": "3", "destination": "outputs/2024/shoe.png"}, "token", http.StatusCreated, "image/png", "outputs/2024/shoe.png"},
+		{"signed destination", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "outputs/signed.jpg", "destination_signature": signature}, "", http.StatusCreated, "image/jpeg", "outputs/signed.jpg"},
+		{"missing source", "/convert", false, true, map[string]string{"source": "images/missing.png", "target_format": "jpeg"}, "", http.StatusNotFound, "", ""},
+		{"invalid source", "/convert", false, true, map[string]string{"source": "images/../secret.png", "target_format": "jpeg"}, "", http.StatusBadRequest, "", ""},
+		{"source bucket not allowed", "/convert", false, true, map[string]string{"source": "private/shoe.png", "target_format": "jpeg"}, "", http.StatusForbidden, "", ""},
+		{"file and source", "/convert", true, true, map[string]string{"source": "images/products/shoe.png", "target_format": "jpeg"}, "", http.StatusBadRequest, "", ""},
+		{"missing destination bucket", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "missing/shoe.jpg"}, "token", http.StatusNotFound, "", ""},
+		{"destination bucket not allowed", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "private/shoe.jpg"}, "token", http.StatusForbidden, "", ""},
+		{"invalid destination", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "outputs"}, "token", http.StatusBadRequest, "", ""},
+		{"destination without token", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "outputs/anonymous.jpg"}, "", http.StatusUnauthorized, "", ""},
+		{"destination with invalid token", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "outputs/anonymous.jpg"}, "other", http.StatusUnauthorized, "", ""},
+		{"destination signed for another key", "/convert", true, true, map[string]string{"target_format": "jpeg", "destination": "outputs/other.jpg", "destination_signature": signature}, "", http.StatusUnauthorized, "", ""},
+		{"error with destination", "/convert", true, true, map[string]string{"target_format": "webp", "destination": "outputs/shoe.webp"}, "token", http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestStorage %s",
+			tt.name,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			contentType := "application/x-www-form-urlencoded"
+			if tt.multipart {
+				multipartWriter := multipart.NewWriter(body)
+				if tt.file {
+					formFile, err := multipartWriter.CreateFormFile("file", "shoe.png")
+					assert.NoError(err)
+					formFile.Write(source)
+				}
+				for name, value := range tt.fields {
+					assert.NoError(multipartWriter.WriteField(name, value))
+				}
+				assert.NoError(multipartWriter.Close())
+				contentType = multipartWriter.FormDataContentType()
+			} else {
+				values := url.Values{}
+				for name, value := range tt.fields {
+					values.Set(name, value)
+				}
+				body.WriteString(values.Encode())
+			}
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", contentType)
+			if tt.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tt.token)
+			}
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			output := res.Body.Bytes()
+			switch res.Code {
+			case http.StatusOK:
+				assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+			case http.StatusCreated:
+				var response destinationResponse
+				assert.NoError(json.Unmarshal(res.Body.Bytes(), &response))
+				assert.Equal(tt.wantDestination, response.Destination)
+				assert.Equal(tt.wantMimeType, response.MimeType)
+				assert.Equal(response.Location, res.Header().Get("Location"))
+				assert.True(strings.HasPrefix(response.Location, "file://"), response.Location)
+				assert.True(strings.HasSuffix(response.Location, tt.wantDestination), response.Location)
+
+				output, err = os.ReadFile(filepath.Join(root, filepath.FromSlash(tt.wantDestination)))
+				assert.NoError(err)
+				assert.Equal(response.Size, len(output))
+			default:
+				return
+			}
+			probe, err := utils.GoProcessor{}.Probe(bytes.NewReader(output))
+			assert.NoError(err)
+			assert.Equal(utils.GetMimeType(probe.Format), tt.wantMimeType)
+		})
+	}
+	assert.NoFileExists(filepath.Join(root, "outputs", "shoe.webp"))
+	assert.NoFileExists(filepath.Join(root, "outputs", "anonymous.jpg"))
+	assert.NoFileExists(filepath.Join(root, "outputs", "other.jpg"))
+	assert.NoFileExists(filepath.Join(root, "private", "shoe.jpg"))
+
+	// Keys must start with the prefix
+	config.StorageKeyPrefix = "products/"
+	res := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/convert", strings.NewReader("source=images/shoe.png&target_format=png"))
+	assert.NoError(err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusForbidden, res.Code, res.Body.String())
+
+	// Sources are rejected without storage
+	objectStorage = nil
+	res = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/convert", strings.NewReader("source=images/products/shoe.png&target_format=png"))
+	assert.NoError(err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusBadRequest, res.Code, res.Body.String())
+}
+
+func TestImageURL(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	source, err := os.ReadFile("../../test/data/test_1000x625.png")
+	assert.NoError(err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shoe.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(source)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/shoe.png", http.StatusFound)
+	})
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Process the requests without ffmpeg, nor cache, the test server is allowlisted
+	root := t.TempDir()
+	backend, cached, objects, fetcher := processor, resultCache, objectStorage, imageFetcher
+	processor, resultCache, objectStorage = utils.GoProcessor{}, nil, storage.NewLocal(root)
+	imageFetcher = &fetch.Fetcher{
+		MaxBytes:     int64(len(source)),
+		MaxRedirects: 1,
+		Allowlist:    []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	}
+	defer func() { processor, resultCache, objectStorage, imageFetcher = backend, cached, objects, fetcher }()
+	assert.NoError(os.Mkdir(filepath.Join(root, "images"), 0o755))
+	assert.NoError(os.WriteFile(filepath.Join(root, "images", "shoe.png"), source, 0o644))
+
+	var tests = []struct {
+		name         string
+		path         string
+		file         bool
+		fields       map[string]string
+		wantCode     int
+		wantMimeType string
+	}{
+		{"image_url", "/convert", false, map[string]string{"image_url": server.URL + "/shoe.png", "target_format": "jpeg"}, http.StatusOK, "image/jpeg"},
+		{"redirect", "/resize_image", false, map[string]string{"image_url": server.URL + "/redirect", "width": "100"}, http.StatusOK, "image/png"},
+		{"file and image_url", "/convert", true, map[string]string{"image_url": server.URL + "/shoe.png", "target_format": "jpeg"}, http.StatusBadRequest, ""},
+		{"source and image_url", "/convert", false, map[string]string{"source": "images/shoe.png", "image_url": server.URL + "/shoe.png", "target_format": "jpeg"}, http.StatusBadRequest, ""},
+		{"invalid image_url", "/convert", false, map[string]string{"image_url": "file:///etc/passwd", "target_format": "jpeg"}, http.StatusBadRequest, ""},
+		{"blocked redirect", "/convert", false, map[string]string{"image_url": server.URL + "/metadata", "target_format": "jpeg"}, http.StatusForbidden, ""},
+		{"content type", "/convert", false, map[string]string{"image_url": server.URL + "/page.html", "target_format": "jpeg"}, http.StatusUnsupportedMediaType, ""},
+		{"missing image", "/convert", false, map[string]string{"image_url": server.URL + "/missing.png", "target_format": "jpeg"}, http.StatusBadGateway, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestImageURL %s",
+			tt.name,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+			if tt.file {
+				formFile, err := multipartWriter.CreateFormFile("file", "shoe.png")
+				assert.NoError(err)
+				formFile.Write(source)
+			}
+			for name, value := range tt.fields {
+				assert.NoError(multipartWriter.WriteField(name, value))
+			}
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+			probe, err := utils.GoProcessor{}.Probe(bytes.NewReader(res.Body.Bytes()))
+			assert.NoError(err)
+			assert.Equal(utils.GetMimeType(probe.Format), tt.wantMimeType)
+		})
+	}
+
+	// Larger images are rejected
+	imageFetcher = &fetch.Fetcher{MaxBytes: 100, Allowlist: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}}
+	res := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/convert", strings.NewReader(url.Values{"image_url": {server.URL + "/shoe.png"}, "target_format": {"jpeg"}}.Encode()))
+	assert.NoError(err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusRequestEntityTooLarge, res.Code, res.Body.String())
+
+	// Loopback is blocked without allowlist
+	imageFetcher = &fetch.Fetcher{}
+	res = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/convert", strings.NewReader(url.Values{"image_url": {server.URL + "/shoe.png"}, "target_format": {"jpeg"}}.Encode()))
+	assert.NoError(err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusForbidden, res.Code, res.Body.String())
+}
+
+func TestProcessImage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName     string
+		operations   string
+		wantWidth    uint16
+		wantHeight   uint16
+		wantFormat   string
+		wantMimeType string
+		wantCode     int
+	}{
+		{
+			"../../test/data/test_1000x625.png",
+			`[{"op":"resize","width":400,"height":400,"mode":"fit"},{"op":"compress","compression_level":3},{"op":"convert","format":"jpeg"}]`,
+			400, 250, "mjpeg", "image/jpeg", http.StatusOK,
+		},
+		{
+			"../../test/data/test_1000x1000.webp",
+			`[{"op":"crop","width":500,"height":300,"gravity":"south-east"},{"op":"rotate","angle":90}]`,
+			300, 500, "webp", "image/webp", http.StatusOK,
+		},
+		{
+			"../../test/data/test_1000x625_orientation_6.jpg",
+			`[{"op":"auto_orient"},{"op":"resize","height":500},{"op":"convert","format":"png"}]`,
+			313, 500, "png", "image/png", http.StatusOK,
+		},
+		{"../../test/data/test_1000x625.png", `[]`, 0, 0, "", "", http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", `{"op":"resize"}`, 0, 0, "", "", http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", `[{"op":"resize","widht":100}]`, 0, 0, "", "", http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", `[{"op":"blur"}]`, 0, 0, "", "", http.StatusBadRequest},
+		{"../../test/data/test_1000x625.png", `[{"op":"crop","width":2000,"height":10}]`, 0, 0, "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestProcessImage %s %s",
+			tt.fileName, tt.operations,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create operations field form
+			formOperations, err := multipartWriter.CreateFormField("operations")
+			assert.NoError(err)
+			formOperations.Write([]byte(tt.operations))
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/process", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestImageInfo(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName   string
+		wantCodec  string
+		wantWidth  int
+		wantHeight int
+		wantCode   int
+	}{
+		{"../../test/data/test_1000x625.png", "png", 1000, 625, http.StatusOK},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 1000, 1000, http.StatusOK},
+		{"../../test/data/test_1000x1000.webp", "webp", 1000, 1000, http.StatusOK},
+		{"../../README.md", "", 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestImageInfo %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/info", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				var info utils.ImageInfo
+				assert.NoError(json.Unmarshal(res.Body.Bytes(), &info))
+				assert.Equal(tt.wantCodec, info.Codec)
+				assert.Equal(tt.wantWidth, info.Width)
+				assert.Equal(tt.wantHeight, info.Height)
+			}
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName       string
+		operations     string
+		wantSubmitCode int
+		wantStatus     jobs.Status
+		wantWidth      uint16
+		wantHeight     uint16
+	}{
+		{"../../test/data/test_1000x625.png", `[{"op":"resize","width":400,"mode":"fit"},{"op":"convert","format":"jpeg"}]`, http.StatusAccepted, jobs.StatusSucceeded, 400, 250},
+		{"../../README.md", `[{"op":"resize","width":400}]`, http.StatusAccepted, jobs.StatusFailed, 0, 0},
+		{"../../test/data/test_1000x625.png", `[{"op":"blur"}]`, http.StatusBadRequest, "", 0, 0},
+		{"../../test/data/test_1000x625.png", `{}`, http.StatusBadRequest, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestJobs %s %s",
+			tt.fileName, tt.operations,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			formField, err := multipartWriter.CreateFormField("operations")
+			assert.NoError(err)
+			formField.Write([]byte(tt.operations))
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/jobs", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantSubmitCode, res.Code, res.Body.String())
+			if res.Code != http.StatusAccepted {
+				return
+			}
+			var job jobs.Job
+			assert.NoError(json.Unmarshal(res.Body.Bytes(), &job))
+			assert.Equal("/jobs/"+job.ID, res.Header().Get("Location"))
+
+			// Poll until the job is finished
+			for i := 0; i < 500 && job.Status != jobs.StatusSucceeded && job.Status != jobs.StatusFailed; i++ {
+				time.Sleep(10 * time.Millisecond)
+				res = httptest.NewRecorder()
+				req, _ = http.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil)
+				router.ServeHTTP(res, req)
+				assert.Equal(http.StatusOK, res.Code, res.Body.String())
+				assert.NoError(json.Unmarshal(res.Body.Bytes(), &job))
+			}
+			assert.Equal(tt.wantStatus, job.Status, job.Error)
+
+			res = httptest.NewRecorder()
+			req, _ = http.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil)
+			router.ServeHTTP(res, req)
+			if tt.wantStatus == jobs.StatusSucceeded {
+				assert.Equal(http.StatusOK, res.Code, res.Body.String())
+				AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantWidth, tt.wantHeight)
+
+				// Unchanged result
+				etag := res.Header().Get("ETag")
+				assert.Equal(fmt.Sprintf(`"%x"`, sha256.Sum256(res.Body.Bytes())), etag)
+				res = httptest.NewRecorder()
+				req, _ = http.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil)
+				req.Header.Add("If-None-Match", etag)
+				router.ServeHTTP(res, req)
+				assert.Equal(http.StatusNotModified, res.Code)
+				assert.Empty(res.Body.Bytes())
+			} else {
+				assert.Equal(http.StatusConflict, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	t.Run("TestJobs unknown job", func(t *testing.T) {
+		for _, path := range []string{"/jobs/unknown", "/jobs/unknown/result"} {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			router.ServeHTTP(res, req)
+			assert.Equal(http.StatusNotFound, res.Code, path)
+		}
+	})
+}
+
+func TestJobCallback(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	// The receivers listen on loopback
+	secret, backoff, client := callbackSender.Secret, callbackSender.Backoff, callbackSender.Client
+	defer func() { callbackSender.Secret, callbackSender.Backoff, callbackSender.Client = secret, backoff, client }()
+	callbackSender.Secret, callbackSender.Backoff = []byte("secret"), 10*time.Millisecond
+	callbackSender.Client = fetch.NewClient([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, 10*time.Second)
+
+	var tests = []struct {
+		fileName   string
+		wantStatus jobs.Status
+		wantMime   string
+		wantError  string
+	}{
+		{"../../test/data/test_1000x625.png", jobs.StatusSucceeded, "image/webp", ""},
+		{"../../README.md", jobs.StatusFailed, "", "Error while processing: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestJobCallback %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			// The receiver fail once to exercise the retries
+			callbacks := make(chan []byte, 1)
+			attempts := 0
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				assert.NoError(webhook.Verify(
+					[]byte("secret"), r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader),
+					body, time.Now(), time.Minute,
+				))
+				callbacks <- body
+			}))
+			defer receiver.Close()
+
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range map[string]string{
+				"operations":   `[{"op":"convert","format":"webp"}]`,
+				"callback_url": receiver.URL,
+			} {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/jobs", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+			assert.Equal(http.StatusAccepted, res.Code, res.Body.String())
+
+			var job jobs.Job
+			assert.NoError(json.Unmarshal(res.Body.Bytes(), &job))
+
+			select {
+			case callback := <-callbacks:
+				var payload jobCallbackPayload
+				require.NoError(t, json.Unmarshal(callback, &payload))
+				assert.Equal(job.ID, payload.JobID)
+				require.Equal(t, tt.wantStatus, payload.Status, string(callback))
+				if tt.wantStatus == jobs.StatusSucceeded {
+					require.NotNil(t, payload.Output)
+					assert.Equal(tt.wantMime, payload.Output.MimeType)
+					assert.Equal(fmt.Sprintf("/jobs/%s/result", job.ID), payload.Output.ResultPath)
+					assert.Nil(payload.Error)
+				} else {
+					require.NotNil(t, payload.Error)
+					assert.Nil(payload.Output)
+					assert.True(strings.HasPrefix(payload.Error.Detail, tt.wantError), payload.Error.Detail)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("job %s callback wasn't received", job.ID)
+			}
+		})
+	}
+
+	t.Run("TestJobCallback blocked address", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("callback to loopback was delivered")
+		}))
+		defer receiver.Close()
+
+		sender := &webhook.Sender{Client: client}
+		assert.ErrorIs(sender.Send(context.Background(), receiver.URL, jobCallbackPayload{}), fetch.ErrBlockedAddress)
+	})
+
+	t.Run("TestJobCallback invalid callback url", func(t *testing.T) {
+		for _, callbackURL := range []string{"ftp://example.com/hook", "/hook", "http://"} {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+			formFile, err := multipartWriter.CreateFormFile("file", "test.png")
+			assert.NoError(err)
+			formFile.Write([]byte("png"))
+			multipartWriter.WriteField("operations", `[{"op":"convert","format":"webp"}]`)
+			multipartWriter.WriteField("callback_url", callbackURL)
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/jobs", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+			assert.Equal(http.StatusBadRequest, res.Code, callbackURL)
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	// zip archive of the given files, stored under images/
+	archive := func(fileNames ...string) []byte {
+		buf := bytes.NewBuffer(nil)
+		writer := zip.NewWriter(buf)
+		for _, fileName := range fileNames {
+			data, err := os.ReadFile(fileName)
+			assert.NoError(err)
+			fileWriter, err := writer.Create("images/" + filepath.Base(fileName))
+			assert.NoError(err)
+			fileWriter.Write(data)
+		}
+		assert.NoError(writer.Close())
+		return buf.Bytes()
+	}
+
+	var tests = []struct {
+		name         string
+		files        []string
+		archive      []byte
+		operations   string
+		wantCode     int
+		wantOutputs  []string
+		wantFailures []string
+	}{
+		{
+			"files",
+			[]string{"../../test/data/test_1000x625.png", "../../test/data/test_1000x1000.jpg", "../../README.md"},
+			nil,
+			`[{"op":"resize","width":100,"mode":"fit"},{"op":"convert","format":"webp"}]`,
+			http.StatusOK,
+			[]string{"test_1000x625.webp", "test_1000x1000.webp"},
+			[]string{"README.md"},
+		},
+		{
+			"archive",
+			nil,
+			archive("../../test/data/test_1000x625.png", "../../test/data/test_1000x1000.webp"),
+			`[{"op":"convert","format":"jpeg"}]`,
+			http.StatusOK,
+			[]string{"images/test_1000x625.jpg", "images/test_1000x1000.jpg"},
+			[]string{},
+		},
+		{"no file", nil, nil, `[{"op":"convert","format":"jpeg"}]`, http.StatusBadRequest, nil, nil},
+		{"files and archive", []string{"../../test/data/test_1000x625.png"}, archive("../../test/data/test_1000x625.png"), `[{"op":"convert","format":"jpeg"}]`, http.StatusBadRequest, nil, nil},
+		{"invalid archive", nil, []byte("not a zip"), `[{"op":"convert","format":"jpeg"}]`, http.StatusBadRequest, nil, nil},
+		{"invalid operations", []string{"../../test/data/test_1000x625.png"}, nil, `[{"op":"blur"}]`, http.StatusBadRequest, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestBatch %s",
+			tt.name,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file forms
+			for _, fileName := range tt.files {
+				formFile, err := multipartWriter.CreateFormFile("files", fileName)
+				assert.NoError(err)
+				fileBuf, err := os.Open(fileName)
+				assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+				defer fileBuf.Close()
+				_, err = io.Copy(formFile, fileBuf)
+				assert.NoError(err)
+			}
+			if tt.archive != nil {
+				formFile, err := multipartWriter.CreateFormFile("archive", "images.zip")
+				assert.NoError(err)
+				formFile.Write(tt.archive)
+			}
+			assert.NoError(multipartWriter.WriteField("operations", tt.operations))
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/batch", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			assert.Equal("application/zip", res.Header().Get("Content-Type"))
+
+			reader, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			assert.NoError(err)
+			var names []string
+			var manifest batch.Manifest
+			for _, file := range reader.File {
+				if file.Name == batch.ManifestName {
+					rc, err := file.Open()
+					assert.NoError(err)
+					assert.NoError(json.NewDecoder(rc).Decode(&manifest))
+					rc.Close()
+					continue
+				}
+				names = append(names, file.Name)
+			}
+
+			var failures []string
+			for _, failure := range manifest.Failures {
+				failures = append(failures, failure.Source)
+			}
+			assert.Equal(len(tt.wantOutputs)+len(tt.wantFailures), manifest.Total)
+			assert.ElementsMatch(tt.wantFailures, failures, manifest.Failures)
+			assert.ElementsMatch(tt.wantOutputs, names)
+		})
+	}
+}
+
+func TestBatchImageURL(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	source, err := os.ReadFile("../../test/data/test_1000x625.png")
+	assert.NoError(err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shoe.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(source)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Process the requests without ffmpeg, the test server is allowlisted
+	backend, fetcher, settings := processor, imageFetcher, config
+	processor = utils.GoProcessor{}
+	imageFetcher = &fetch.Fetcher{MaxBytes: int64(len(source)), Allowlist: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}}
+	config.BatchMaxFiles = 3
+	defer func() { processor, imageFetcher, config = backend, fetcher, settings }()
+
+	var tests = []struct {
+		name         string
+		file         bool
+		imageURLs    []string
+		maxBytes     int64
+		wantCode     int
+		wantOutputs  []string
+		wantFailures []string
+	}{
+		{
+			"image_urls",
+			false,
+			[]string{server.URL + "/shoe.png", server.URL + "/missing.png", "file:///etc/passwd"},
+			16 << 20,
+			http.StatusOK,
+			[]string{"shoe.jpg"},
+			[]string{server.URL + "/missing.png", "file:///etc/passwd"},
+		},
+		{"files and image_urls", true, []string{server.URL + "/shoe.png"}, 16 << 20, http.StatusOK, []string{"test_1000x625.jpg", "shoe.jpg"}, nil},
+		{"larger than the batch", true, []string{server.URL + "/shoe.png"}, int64(len(source)) + 100, http.StatusOK, []string{"test_1000x625.jpg"}, []string{server.URL + "/shoe.png"}},
+		{"too many files", true, []string{server.URL + "/a.png", server.URL + "/b.png", server.URL + "/c.png"}, 16 << 20, http.StatusRequestEntityTooLarge, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestBatchImageURL %s",
+			tt.name,
+		), func(t *testing.T) {
+			config.BatchMaxBytes = tt.maxBytes
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+			if tt.file {
+				formFile, err := multipartWriter.CreateFormFile("files", "test_1000x625.png")
+				assert.NoError(err)
+				formFile.Write(source)
+			}
+			for _, imageURL := range tt.imageURLs {
+				assert.NoError(multipartWriter.WriteField("image_urls", imageURL))
+			}
+			assert.NoError(multipartWriter.WriteField("operations", `[{"op":"convert","format":"jpeg"}]`))
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/batch", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+
+			reader, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			assert.NoError(err)
+			var names []string
+			var manifest batch.Manifest
+			for _, file := range reader.File {
+				if file.Name == batch.ManifestName {
+					rc, err := file.Open()
+					assert.NoError(err)
+					assert.NoError(json.NewDecoder(rc).Decode(&manifest))
+					rc.Close()
+					continue
+				}
+				names = append(names, file.Name)
+			}
+
+			var failures []string
+			for _, failure := range manifest.Failures {
+				failures = append(failures, failure.Source)
+			}
+			assert.ElementsMatch(tt.wantFailures, failures, manifest.Failures)
+			assert.ElementsMatch(tt.wantOutputs, names)
+		})
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fields       map[string]string
+		wantCode     int
+		wantFiles    []string
+		wantMimeType string
+	}{
+		{map[string]string{"widths": "320,640", "formats": "webp,jpeg"}, http.StatusOK, []string{"test_1000x625-320.webp", "test_1000x625-640.webp", "test_1000x625-320.jpg", "test_1000x625-640.jpg"}, "application/zip"},
+		{map[string]string{"widths": "320,2000", "output": "multipart"}, http.StatusOK, []string{"test_1000x625-320.png"}, "multipart/mixed"},
+		{map[string]string{"widths": "320,abc"}, http.StatusBadRequest, nil, ""},
+		{map[string]string{"widths": "320", "formats": "tga"}, http.StatusBadRequest, nil, ""},
+		{map[string]string{"widths": "320", "output": "tar"}, http.StatusBadRequest, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSrcset %v",
+			tt.fields,
+		), func(t *testing.T) {
+			fileName := "../../test/data/test_1000x625.png"
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/srcset", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+
+			// Collect the parts of the response
+			files := map[string][]byte{}
+			mediaType, params, err := mime.ParseMediaType(res.Header().Get("Content-Type"))
+			assert.NoError(err)
+			assert.Equal(tt.wantMimeType, mediaType)
+			if mediaType == "application/zip" {
+				reader, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+				assert.NoError(err)
+				for _, file := range reader.File {
+					rc, err := file.Open()
+					assert.NoError(err)
+					files[file.Name], _ = io.ReadAll(rc)
+					rc.Close()
+				}
+			} else {
+				reader := multipart.NewReader(bytes.NewReader(res.Body.Bytes()), params["boundary"])
+				for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+					files[part.FileName()], _ = io.ReadAll(part)
+				}
+			}
+
+			var manifest srcsetManifest
+			assert.NoError(json.Unmarshal(files["manifest.json"], &manifest))
+			assert.Equal(manifest.HTML, string(files["picture.html"]))
+			assert.Len(manifest.Variants, len(tt.wantFiles))
+			for i, wantFile := range tt.wantFiles {
+				assert.Equal(wantFile, manifest.Variants[i].File)
+				assert.Equal(len(files[wantFile]), manifest.Variants[i].Size)
+				assert.Contains(manifest.HTML, wantFile)
+				AssertImageSizeEqual(t, bytes.NewReader(files[wantFile]), manifest.Variants[i].Width, manifest.Variants[i].Height)
+			}
+		})
+	}
+}
+
+func TestConvertImagePage(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName string
+		fields   map[string]string
+		wantCode int
+	}{
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "png", "page": "2"}, http.StatusOK},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "tiff", "page": "3", "tiff_compression": "lzw"}, http.StatusOK},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "png", "page": "4"}, http.StatusBadRequest},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "tiff", "tiff_compression": "jpeg"}, http.StatusBadRequest},
+		{"../../test/data/test_1000x1000.png", map[string]string{"target_format": "jpeg", "page": "1"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestConvertImagePage %s %v",
+			tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/convert", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), 100, 50)
+			}
+		})
+	}
+}
+
+func TestSplitPages(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName     string
+		fields       map[string]string
+		wantCode     int
+		wantFiles    []string
+		wantMimeType string
+	}{
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{}, http.StatusOK, []string{"test_100x50_3_pages-1.tiff", "test_100x50_3_pages-2.tiff", "test_100x50_3_pages-3.tiff"}, "application/zip"},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"output": "multipart"}, http.StatusOK, []string{"test_100x50_3_pages-1.tiff", "test_100x50_3_pages-2.tiff", "test_100x50_3_pages-3.tiff"}, "multipart/mixed"},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "png"}, http.StatusOK, []string{"test_100x50_3_pages-1.png", "test_100x50_3_pages-2.png", "test_100x50_3_pages-3.png"}, "application/zip"},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"target_format": "tga"}, http.StatusBadRequest, nil, ""},
+		{"../../test/data/test_100x50_3_pages.tiff", map[string]string{"output": "tar"}, http.StatusBadRequest, nil, ""},
+		{"../../test/data/test_1000x1000.png", map[string]string{}, http.StatusBadRequest, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSplitPages %s %v",
+			tt.fileName, tt.fields,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/split_pages", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			assert.Equal(strconv.Itoa(len(tt.wantFiles)), res.Header().Get("X-Page-Count"))
+
+			// Collect the parts of the response
+			var names []string
+			files := map[string][]byte{}
+			mediaType, params, err := mime.ParseMediaType(res.Header().Get("Content-Type"))
+			assert.NoError(err)
+			assert.Equal(tt.wantMimeType, mediaType)
+			if mediaType == "application/zip" {
+				reader, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+				assert.NoError(err)
+				for _, file := range reader.File {
+					rc, err := file.Open()
+					assert.NoError(err)
+					names = append(names, file.Name)
+					files[file.Name], _ = io.ReadAll(rc)
+					rc.Close()
+				}
+			} else {
+				reader := multipart.NewReader(bytes.NewReader(res.Body.Bytes()), params["boundary"])
+				for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+					names = append(names, part.FileName())
+					files[part.FileName()], _ = io.ReadAll(part)
+				}
+			}
+
+			assert.Equal(tt.wantFiles, names)
+			for _, name := range names {
+				if filepath.Ext(name) == ".tiff" {
+					pages, err := utils.TiffPageCount(files[name])
+					assert.NoError(err)
+					assert.Equal(1, pages)
+				}
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	var tests = []struct {
+		fileName   string
+		fields     map[string]string
+		accept     string
+		wantCode   int
+		wantFormat string
+		wantWidth  uint16
+		wantHeight uint16
+	}{
+		{"../../test/data/test_1000x625.png", map[string]string{"size": "small"}, "", http.StatusOK, "png", 128, 128},
+		{"../../test/data/test_1000x625.png", map[string]string{"size": "medium"}, "image/avif,image/webp,*/*", http.StatusOK, "webp", 256, 256},
+		{"../../test/data/test_1000x1000.jpg", map[string]string{"width": "200", "height": "100"}, "", http.StatusOK, "mjpeg", 200, 100},
+		{"../../test/data/test_1000x625_orientation_6.jpg", map[string]string{"width": "100", "height": "200", "format": "png"}, "image/webp", http.StatusOK, "png", 100, 200},
+		{"../../test/data/test_1000x625.png", map[string]string{"size": "huge"}, "", http.StatusBadRequest, "", 0, 0},
+		{"../../test/data/test_1000x625.png", map[string]string{"size": "small", "width": "100"}, "", http.StatusBadRequest, "", 0, 0},
+		{"../../test/data/test_1000x625.png", map[string]string{}, "", http.StatusBadRequest, "", 0, 0},
+		{"../../test/data/test_1000x625.png", map[string]string{"size": "small", "format": "bmp"}, "", http.StatusBadRequest, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestThumbnail %s %v %s",
+			tt.fileName, tt.fields, tt.accept,
+		), func(t *testing.T) {
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", tt.fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/thumbnail", body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			if tt.accept != "" {
+				req.Header.Add("Accept", tt.accept)
+			}
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			assert.Equal(utils.GetMimeType(tt.wantFormat), res.Header().Get("Content-Type"))
+			AssertImageFormatEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantWidth, tt.wantHeight)
+		})
+	}
+}
+
+func TestThumbnailSizes(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/thumbnail/sizes", nil)
+	assert.NoError(err)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(http.StatusOK, res.Code)
+	var sizes map[string]ThumbnailSize
+	assert.NoError(json.Unmarshal(res.Body.Bytes(), &sizes))
+	assert.Equal(map[string]ThumbnailSize{
+		"small":  {128, 128},
+		"medium": {256, 256},
+		"large":  {512, 512},
+	}, sizes)
+}
+
+func TestParseThumbnailSizes(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		value     string
+		wantSizes map[string]ThumbnailSize
+		wantErr   bool
+	}{
+		{"small=128x128, banner=1200x300", map[string]ThumbnailSize{"small": {128, 128}, "banner": {1200, 300}}, false},
+		{"small=128", nil, true},
+		{"=128x128", nil, true},
+		{"small=0x128", nil, true},
+		{"small=128x99999", nil, true},
+		{"small=axb", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestParseThumbnailSizes %s",
+			tt.value,
+		), func(t *testing.T) {
+			sizes, err := parseThumbnailSizes(tt.value)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tt.wantSizes, sizes)
+		})
+	}
+}
+
+func TestPresets(t *testing.T) {
+	assert := assert.New(t)
+	router := setupRouter()
+
+	configPresets := config.Presets
+	config.Presets = presets.Presets{
+		"avatar": {
+			Description: "Square profile picture",
+			Operations: utils.Pipeline{
+				{Op: utils.OperationResize, Width: 100, Height: 100, Mode: utils.ResizeModeCover},
+				{Op: utils.OperationConvert, Format: "webp"},
+			},
+		},
+	}
+	defer func() { config.Presets = configPresets }()
+
+	// Listing
+	res := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/presets", nil)
+	assert.NoError(err)
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+	var listed presets.Presets
+	assert.NoError(json.Unmarshal(res.Body.Bytes(), &listed))
+	assert.Equal(config.Presets, listed)
+
+	var tests = []struct {
+		path       string
+		fields     map[string]string
+		wantCode   int
+		wantFormat string
+	}{
+		{"/resize_image", map[string]string{"preset": "avatar"}, http.StatusOK, "webp"},
+		{"/crop_image", map[string]string{"preset": "avatar"}, http.StatusOK, "webp"},
+		{"/convert", map[string]string{"preset": "avatar", "target_format": "bmp"}, http.StatusOK, "webp"},
+		{"/process", map[string]string{"preset": "avatar"}, http.StatusOK, "webp"},
+		{"/thumbnail", map[string]string{"preset": "avatar"}, http.StatusOK, "webp"},
+		{"/thumbnail", map[string]string{"preset": "banner", "size": "small"}, http.StatusBadRequest, ""},
+		{"/srcset", map[string]string{"preset": "avatar", "widths": "100"}, http.StatusBadRequest, ""},
+		{"/split_pages", map[string]string{"preset": "avatar"}, http.StatusBadRequest, ""},
+		{"/convert_png_to_jpeg", map[string]string{"preset": "avatar"}, http.StatusBadRequest, ""},
+		{"/resize_image", map[string]string{"preset": "banner"}, http.StatusBadRequest, ""},
+		{"/process", map[string]string{"preset": "banner"}, http.StatusBadRequest, ""},
+		{"/process", map[string]string{"preset": "avatar", "operations": `[{"op":"auto_orient"}]`}, http.StatusBadRequest, ""},
+		{"/process", map[string]string{}, http.StatusBadRequest, ""},
+		{"/jobs", map[string]string{"preset": "banner"}, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestPresets %s %v",
+			tt.path, tt.fields,
+		), func(t *testing.T) {
+			fileName := "../../test/data/test_1000x625.png"
+			body := bytes.NewBuffer(nil)
+			multipartWriter := multipart.NewWriter(body)
+
+			// Create file form
+			formFile, err := multipartWriter.CreateFormFile("file", fileName)
+			assert.NoError(err)
+			fileBuf, err := os.Open(fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+			defer fileBuf.Close()
+			_, err = io.Copy(formFile, fileBuf)
+			assert.NoError(err)
+
+			// Create field forms
+			for name, value := range tt.fields {
+				formField, err := multipartWriter.CreateFormField(name)
+				assert.NoError(err)
+				formField.Write([]byte(value))
+			}
+
+			assert.NoError(multipartWriter.Close())
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tt.path, body)
+			assert.NoError(err)
+			req.Header.Add("Content-Type", multipartWriter.FormDataContentType())
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code != http.StatusOK {
+				return
+			}
+			AssertImageFormatEqual(t, bytes.NewReader(res.Body.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(res.Body.Bytes()), 100, 100)
+		})
+	}
+}
+
+func TestServeImage(t *testing.T) {
+	assert := assert.New(t)
+
+	objects, buckets := objectStorage, config.StorageBuckets
+	objectStorage, config.StorageBuckets = storage.NewLocal("../../test"), []string{"data"}
+	defer func() { objectStorage, config.StorageBuckets = objects, buckets }()
+	router := setupRouter()
+
+	var tests = []struct {
+		path         string
+		wantWidth    uint16
+		wantHeight   uint16
+		wantFormat   string
+		wantMimeType string
+		wantCode     int
+	}{
+		{"/img/rs:fit:400:400,q:3,f:webp/data/test_1000x625.png", 400, 250, "webp", "image/webp", http.StatusOK},
+		{"/img/w:500/data/test_625x1000.png", 500, 800, "png", "image/png", http.StatusOK},
+		{"/img/c:300:300:north-west,f:jpg/data/test_1000x1000.bmp", 300, 300, "mjpeg", "image/jpeg", http.StatusOK},
+		{"/img/-/data/test_1000x625_orientation_6.jpg", 625, 1000, "mjpeg", "image/jpeg", http.StatusOK},
+		{"/img/rs:stretch:400:400/data/test_1000x625.png", 0, 0, "", "", http.StatusBadRequest},
+		{"/img/blur:5/data/test_1000x625.png", 0, 0, "", "", http.StatusBadRequest},
+		{"/img/w:100/data/missing.png", 0, 0, "", "", http.StatusNotFound},
+		{"/img/w:100/test_1000x625.png", 0, 0, "", "", http.StatusBadRequest},
+		{"/img/w:100/golden/test_1000x625.png", 0, 0, "", "", http.StatusForbidden},
+		{"/img/w:100/%2e%2e/data/test_1000x625.png", 0, 0, "", "", http.StatusBadRequest},
+		{"/img/w:100/", 0, 0, "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestServeImage %s",
+			tt.path,
+		), func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			assert.NoError(err)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				assert.Equal(tt.wantMimeType, res.Header().Get("Content-Type"))
+				assert.Equal(config.CacheControl, res.Header().Get("Cache-Control"))
+				assert.Equal(fmt.Sprintf(`"%x"`, sha256.Sum256(res.Body.Bytes())), res.Header().Get("ETag"))
+
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			}
+		})
+	}
+
+	// Route is disabled without storage
+	objectStorage = nil
+	res := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/img/w:100/data/test_1000x625.png", nil)
+	assert.NoError(err)
+	router.ServeHTTP(res, req)
+	assert.Equal(http.StatusNotFound, res.Code, res.Body.String())
+}
+
+func TestServeImageConditional(t *testing.T) {
+	assert := assert.New(t)
+
+	objects, buckets, cacheControl, cached := objectStorage, config.StorageBuckets, config.CacheControl, resultCache
+	objectStorage, config.StorageBuckets, config.CacheControl = storage.NewLocal("../../test"), []string{"data"}, "public, max-age=60"
+	defer func() {
+		objectStorage, config.StorageBuckets, config.CacheControl, resultCache = objects, buckets, cacheControl, cached
+	}()
+	router := setupRouter()
+
+	// Response of a previous request, served without ffmpeg
+	var err error
+	resultCache, err = cache.New(64<<20, "", 0)
+	assert.NoError(err)
+	source, err := os.ReadFile("../../test/data/test_1000x625.png")
+	assert.NoError(err)
+	image := []byte("resized image")
+	assert.NoError(resultCache.Set(
+		cache.Key([][]byte{source}, "/img/:options/*source", cacheSettings(), "w:100"),
+		cache.Entry{Data: image, Header: map[string]string{"Content-Type": "image/png", "Cache-Control": config.CacheControl}},
+	))
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(image))
+
+	var tests = []struct {
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{"", http.StatusOK},
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+		{strings.Trim(etag, `"`), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestServeImageConditional %s",
+			tt.ifNoneMatch,
+		), func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/img/w:100/data/test_1000x625.png", nil)
+			assert.NoError(err)
+			if tt.ifNoneMatch != "" {
+				req.Header.Add("If-None-Match", tt.ifNoneMatch)
+			}
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			assert.Equal(etag, res.Header().Get("ETag"))
+			assert.Equal("public, max-age=60", res.Header().Get("Cache-Control"))
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(image, res.Body.Bytes())
+			} else {
+				assert.Empty(res.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestServeImageSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	objects, buckets, signingSecret := objectStorage, config.StorageBuckets, config.SigningSecret
+	objectStorage, config.StorageBuckets, config.SigningSecret = storage.NewLocal("../../test"), []string{"data"}, "secret"
+	defer func() { objectStorage, config.StorageBuckets, config.SigningSecret = objects, buckets, signingSecret }()
+	router := setupRouter()
+
+	secret := []byte(config.SigningSecret)
+	signedURL := func(options string, source string, expires time.Time) string {
+		return strings.TrimPrefix(urlsign.URL("http://localhost:8000/img", secret, options, source, expires), "http://localhost:8000")
+	}
+
+	var tests = []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"signed", signedURL("rs:fit:400:400", "data/test_1000x625.png", time.Time{}), http.StatusOK},
+		{"signed with expiry", signedURL("rs:fit:400:400", "data/test_1000x625.png", time.Now().Add(time.Hour)), http.StatusOK},
+		{"expired", signedURL("rs:fit:400:400", "data/test_1000x625.png", time.Now().Add(-time.Hour)), http.StatusForbidden},
+		{"unsigned", "/img/rs:fit:400:400/data/test_1000x625.png", http.StatusForbidden},
+		{"tampered options", strings.Replace(signedURL("rs:fit:400:400", "data/test_1000x625.png", time.Time{}), "400:400", "4000:4000", 1), http.StatusForbidden},
+		{"tampered source", strings.Replace(signedURL("rs:fit:400:400", "data/test_1000x625.png", time.Time{}), "1000x625", "1000x1000", 1), http.StatusForbidden},
+		{"other secret", strings.TrimPrefix(urlsign.URL("http://localhost:8000/img", []byte("other"), "rs:fit:400:400", "data/test_1000x625.png", time.Time{}), "http://localhost:8000"), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestServeImageSignature %s",
+			tt.name,
+		), func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			assert.NoError(err)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			if res.Code == http.StatusOK {
+				outBufReader := bytes.NewReader(res.Body.Bytes())
+				AssertImageSizeEqual(t, outBufReader, 400, 250)
+			}
+		})
+	}
+}
+
+// memoryStorage is a storage.Storage holding the objects in memory, keyed by "bucket/key"
+type memoryStorage map[string][]byte
+
+func (objects memoryStorage) Open(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	data, ok := objects[bucket+"/"+key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (objects memoryStorage) Put(ctx context.Context, bucket string, key string, data []byte, contentType string) (string, error) {
+	objects[bucket+"/"+key] = data
+	return "memory://" + bucket + "/" + key, nil
+}
+
+func TestServeImageStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	// The source is only in the configured storage, its response is cached by the content of the object
+	objects, buckets, cached := objectStorage, config.StorageBuckets, resultCache
+	objectStorage = memoryStorage{"images/shoe.png": []byte("source image"), "other/shoe.png": []byte("source image")}
+	config.StorageBuckets = []string{"images"}
+	defer func() { objectStorage, config.StorageBuckets, resultCache = objects, buckets, cached }()
+	router := setupRouter()
+
+	var err error
+	resultCache, err = cache.New(64<<20, "", 0)
+	assert.NoError(err)
+	image := []byte("resized image")
+	assert.NoError(resultCache.Set(
+		cache.Key([][]byte{[]byte("source image")}, "/img/:options/*source", cacheSettings(), "w:100"),
+		cache.Entry{Data: image, Header: map[string]string{"Content-Type": "image/png"}},
+	))
+
+	var tests = []struct {
+		path      string
+		wantCode  int
+		wantCache string
+	}{
+		{"/img/w:100/images/shoe.png", http.StatusOK, "HIT"},
+		{"/img/w:100/images/missing.png", http.StatusNotFound, ""},
+		{"/img/w:100/other/shoe.png", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestServeImageStorage %s", tt.path), func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			assert.NoError(err)
+			router.ServeHTTP(res, req)
+
+			assert.Equal(tt.wantCode, res.Code, res.Body.String())
+			assert.Equal(tt.wantCache, res.Header().Get("X-Cache"))
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(image, res.Body.Bytes())
+			}
+		})
+	}
+}
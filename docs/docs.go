@@ -15,9 +15,193 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/batch": {
+            "post": {
+                "description": "Apply the same operations as /process to many images, uploaded as repeated files fields or as a zip archive\nand/or downloaded from repeated image_urls fields (checked like image_url),\nand return a zip archive with the processed images and a manifest.json listing the outcome of every file\na failed file (or download) doesn't fail the request, it is reported in the failures of the manifest",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/zip"
+                ],
+                "summary": "Batch process images",
+                "operationId": "batch",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image files (repeat the field)",
+                        "name": "files",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "zip archive of images, instead of files",
+                        "name": "archive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "http or https URLs of images to download (repeat the field)",
+                        "name": "image_urls",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JSON array of operations (see /process)",
+                        "name": "operations",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name instead of operations (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/cache": {
+            "get": {
+                "description": "Number of responses and bytes held by the memory and disk tiers of the cache\nRequires the IMAGE_ADMIN_TOKEN bearer token",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Cache statistics",
+                "operationId": "cache_stats",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cIMAGE_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/cache.Stats"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove every cached response, or only the one whose key is given (X-Cache-Key response header)\nRequires the IMAGE_ADMIN_TOKEN bearer token",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Purge cache",
+                "operationId": "purge_cache",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cIMAGE_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.cachePurgeResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/cache/{key}": {
+            "delete": {
+                "description": "Remove every cached response, or only the one whose key is given (X-Cache-Key response header)\nRequires the IMAGE_ADMIN_TOKEN bearer token",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Purge cache",
+                "operationId": "purge_cache",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cIMAGE_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "cache key",
+                        "name": "key",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.cachePurgeResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/compress_image": {
             "post": {
-                "description": "Compress image with specified compression level (1-5)",
+                "description": "Compress image with specified compression level (1-5)\nor with the highest quality keeping the output under max_bytes, the chosen quality (1-100) is reported\nin the X-Image-Quality header (absent for PNG and TIFF, which are lossless), with downscale the image is also\ndownscaled when needed and its final size is reported in the X-Image-Width and X-Image-Height headers\nThe encoder options of the image format override compression_level, they can't be combined with max_bytes\nThe EXIF orientation is applied before compressing",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -29,25 +213,264 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "image file",
+                        "description": "image file, required unless source or image_url is given",
                         "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
                     },
                     {
                         "type": "integer",
-                        "description": "compression level (1-5)",
+                        "description": "compression level (1-5), required without max_bytes or encoder options",
                         "name": "compression_level",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum output size in bytes, instead of compression_level",
+                        "name": "max_bytes",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "downscale the image when max_bytes can't be reached otherwise",
+                        "name": "downscale",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "jpeg or webp quality (1-100)",
+                        "name": "quality",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "progressive jpeg, rejected as the mjpeg encoder only produce baseline jpeg",
+                        "name": "progressive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "jpeg chroma subsampling (444, 422, 420)",
+                        "name": "chroma_subsampling",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "png zlib compression level (0-9)",
+                        "name": "png_compression_level",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "reduce the png to a 256 colours palette",
+                        "name": "palette",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "lossless webp",
+                        "name": "lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "webp compression method (0-6)",
+                        "name": "method",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "near lossless webp, rejected as the libwebp encoder of ffmpeg doesn't expose it",
+                        "name": "near_lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "tiff compression (none, lzw, deflate)",
+                        "name": "tiff_compression",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/convert": {
+            "post": {
+                "description": "Convert image from any supported format to the target format (jpeg, png, webp, bmp, gif, avif, tiff)\nthe encoder of jpeg, png, webp and tiff targets can be tuned with the options of its format\nanimated GIF and WebP stay animated when converted to gif or webp, other targets keep the first frame",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Convert image",
+                "operationId": "convert_image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "target format (jpeg, png, webp, bmp, gif, avif, tiff)",
+                        "name": "target_format",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "page of a multi-page TIFF to convert, starting at 1",
+                        "name": "page",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "jpeg or webp quality (1-100)",
+                        "name": "quality",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "progressive jpeg, rejected as the mjpeg encoder only produce baseline jpeg",
+                        "name": "progressive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "jpeg chroma subsampling (444, 422, 420)",
+                        "name": "chroma_subsampling",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "png zlib compression level (0-9)",
+                        "name": "png_compression_level",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "reduce the png to a 256 colours palette",
+                        "name": "palette",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "lossless webp",
+                        "name": "lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "webp compression method (0-6)",
+                        "name": "method",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "near lossless webp, rejected as the libwebp encoder of ffmpeg doesn't expose it",
+                        "name": "near_lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "tiff compression (none, lzw, deflate), default packbits",
+                        "name": "tiff_compression",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
                     }
                 ],
-                "responses": {}
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
             }
         },
         "/convert_png_to_jpeg": {
             "post": {
-                "description": "Convert image from PNG format to JPEG format",
+                "description": "Alias of /convert with target_format=jpeg, kept for the existing clients, any supported input format is accepted\npresets are rejected as they could change the output format",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -59,33 +482,98 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "image file",
+                        "description": "image file, required unless source or image_url is given",
                         "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
                     }
                 ],
-                "responses": {}
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
             }
         },
-        "/resize_image": {
+        "/crop_image": {
             "post": {
-                "description": "Resize image to the specified width and height",
+                "description": "Crop image to the rectangle given by x, y, width and height, or to width and height anchored with gravity\nthe EXIF orientation is applied first, the rectangle is relative to the oriented image",
                 "consumes": [
                     "multipart/form-data"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Resize image",
-                "operationId": "resize_image",
+                "summary": "Crop image",
+                "operationId": "crop_image",
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "image file",
+                        "description": "image file, required unless source or image_url is given",
                         "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
                     },
                     {
                         "type": "integer",
@@ -100,10 +588,1145 @@ const docTemplate = `{
                         "name": "height",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "left offset, required with y when gravity is not set",
+                        "name": "x",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "top offset, required with x when gravity is not set",
+                        "name": "y",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "gravity (center, north, south, east, west, north-east, north-west, south-east, south-west), default center",
+                        "name": "gravity",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/img/{options}/{source}": {
+            "get": {
+                "description": "Serve an image from the configured storage (IMAGE_STORAGE_BACKEND) transformed according to the options segment\noptions are separated by \",\" e.g. rs:fit:300:200,q:3,f:webp (\"-\" serve the source untouched)\nrs:\u003cmode\u003e:\u003cwidth\u003e:\u003cheight\u003e, w:\u003cwidth\u003e, h:\u003cheight\u003e, m:\u003cmode\u003e, bg:\u003ccolour\u003e, c:\u003cwidth\u003e:\u003cheight\u003e[:\u003cgravity\u003e], q:\u003clevel\u003e, f:\u003cformat\u003e\nResponses carry a strong ETag and the configured Cache-Control, If-None-Match is answered with 304 Not Modified",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp",
+                    "image/bmp",
+                    "image/gif",
+                    "image/avif"
+                ],
+                "summary": "Serve transformed image",
+                "operationId": "serve_image",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "transformation options",
+                        "name": "options",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage",
+                        "name": "source",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of the signature",
+                        "name": "expires",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL signature, required when a signing secret is configured",
+                        "name": "signature",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response, answered with 304 when unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {}
             }
+        },
+        "/info": {
+            "post": {
+                "description": "Return the codec, container, size, pixel format, bit depth, alpha, colour space, frame count,\nduration (animations only), file size and EXIF/XMP/ICC presence of the image",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Image information",
+                "operationId": "image_info",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ImageInfo"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "post": {
+                "description": "Enqueue the same operations as /process and return immediately with the job ID,\npoll GET /jobs/{id} until the status is succeeded or failed then download GET /jobs/{id}/result\nwhen callback_url is set, a JSON payload (job_id, status, output or error) is POSTed to it once the job is finished,\nsigned with the X-Webhook-Signature and X-Webhook-Timestamp headers (see pkg/webhook)\nlike image_url, the callback can't reach private addresses unless they are in IMAGE_FETCH_ALLOWLIST",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Submit job",
+                "operationId": "submit_job",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JSON array of operations (see /process)",
+                        "name": "operations",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name instead of operations (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL notified when the job is finished",
+                        "name": "callback_url",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}": {
+            "get": {
+                "description": "Return the status, progress (share of the pipeline steps done, 100 once finished) and error of a job",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get job",
+                "operationId": "get_job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/jobs.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}/result": {
+            "get": {
+                "description": "Return the output image of a succeeded job, with a strong ETag honoured by If-None-Match",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp",
+                    "image/bmp",
+                    "image/gif",
+                    "image/avif"
+                ],
+                "summary": "Get job result",
+                "operationId": "get_job_result",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response, answered with 304 when unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/presets": {
+            "get": {
+                "description": "List the presets configured server-side, each is a named operation chain (see /process)\naccepted as the preset form field of every processing endpoint and as preset:\u003cname\u003e options of /img",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Presets",
+                "operationId": "presets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/presets.Preset"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/process": {
+            "post": {
+                "description": "Apply an ordered list of operations to the image with a single ffmpeg invocation\noperations is a JSON array, e.g. [{\"op\":\"resize\",\"width\":400,\"mode\":\"fit\"},{\"op\":\"compress\",\"compression_level\":3},{\"op\":\"convert\",\"format\":\"webp\"}]\nSupported operations: resize (width, height, mode, background), crop (width, height, x, y, gravity),\nrotate (angle, background), flip (direction), auto_orient, compress (compression_level and/or the encoder options of /convert), convert (format)",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Process image",
+                "operationId": "process_image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JSON array of operations",
+                        "name": "operations",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name instead of operations (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/resize_image": {
+            "post": {
+                "description": "Resize image to the specified width and height, when only one of them is given the other is derived from the aspect ratio\nThe EXIF orientation is applied before resizing, every frame of animated GIF and WebP is resized",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Resize image",
+                "operationId": "resize_image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "width",
+                        "name": "width",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "height",
+                        "name": "height",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "resize mode (fill, fit, cover, pad), default fill",
+                        "name": "mode",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "background colour used by pad mode, default black",
+                        "name": "background",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/split_pages": {
+            "post": {
+                "description": "Explode every page of a multi-page TIFF into separate images named \u003cname\u003e-\u003cpage\u003e.\u003cext\u003e,\nreturned as a zip archive or multipart/mixed body, the pages are single page TIFFs unless target_format is given\npresets are rejected",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/zip",
+                    "multipart/mixed"
+                ],
+                "summary": "Split pages",
+                "operationId": "split_pages",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "TIFF file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "format of the pages (jpeg, png, webp, bmp, gif, avif, tiff), default tiff",
+                        "name": "target_format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "tiff compression (none, lzw, deflate), the pages are re-encoded when set",
+                        "name": "tiff_compression",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "zip (default) or multipart",
+                        "name": "output",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/srcset": {
+            "post": {
+                "description": "Resize the image to every width in every format with a single ffmpeg invocation,\nheights follow the source aspect ratio and widths larger than the source are dropped\nthe response (zip archive or multipart/mixed) holds the variants named \u003cname\u003e-\u003cwidth\u003e.\u003cext\u003e,\na picture.html \u003cpicture\u003e snippet and a manifest.json describing the variants, presets are rejected",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/zip",
+                    "multipart/mixed"
+                ],
+                "summary": "Responsive image set",
+                "operationId": "srcset",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "comma separated widths, e.g. 320,640,1280",
+                        "name": "widths",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "comma separated formats, the last one is the \u003cimg\u003e fallback, e.g. webp,jpeg (default: source format)",
+                        "name": "formats",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "alt text of the \u003cimg\u003e",
+                        "name": "alt",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "sizes attribute (default: 100vw)",
+                        "name": "sizes",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "prefix of the variant URLs in the snippet",
+                        "name": "base_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "zip (default) or multipart",
+                        "name": "output",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/thumbnail": {
+            "post": {
+                "description": "Produce a thumbnail filling the box of a named size (configured server-side, see GET /thumbnail/sizes)\nor of width x height, the image is auto oriented, cover cropped and its metadata is stripped\nthe format default to webp when the Accept header allow it, otherwise png for transparent images or jpeg",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/webp"
+                ],
+                "summary": "Thumbnail",
+                "operationId": "thumbnail",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "named size, e.g. small, medium or large",
+                        "name": "size",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "thumbnail width, instead of size",
+                        "name": "width",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "thumbnail height, default to width",
+                        "name": "height",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "jpeg, png or webp (default: automatic)",
+                        "name": "format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/thumbnail/sizes": {
+            "get": {
+                "description": "List the named sizes accepted by /thumbnail",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Thumbnail sizes",
+                "operationId": "thumbnail_sizes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/main.ThumbnailSize"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/transform_image": {
+            "post": {
+                "description": "Rotate and/or flip image, auto_orient apply the EXIF orientation first",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Transform image",
+                "operationId": "transform_image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "image file, required unless source or image_url is given",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key of the source image in the storage, instead of file",
+                        "name": "source",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "http or https URL of the image to download, instead of file",
+                        "name": "image_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "bucket/key the output is written to, answered with its location instead of the output, requires the IMAGE_DESTINATION_TOKEN bearer token or destination_signature",
+                        "name": "destination",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "signature of the destination made with the signing secret",
+                        "name": "destination_signature",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "expiry unix timestamp of destination_signature",
+                        "name": "destination_expires",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "clockwise rotation in degrees, multiples of 90 are lossless",
+                        "name": "rotate",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "flip direction (horizontal, vertical, both)",
+                        "name": "flip",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "apply the EXIF orientation",
+                        "name": "auto_orient",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "colour of the uncovered area when rotating by an arbitrary angle, default black",
+                        "name": "background",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "preset name, replace the other parameters (see /presets)",
+                        "name": "preset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.destinationResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "cache.Stats": {
+            "type": "object",
+            "properties": {
+                "disk_bytes": {
+                    "type": "integer"
+                },
+                "disk_entries": {
+                    "type": "integer"
+                },
+                "memory_bytes": {
+                    "type": "integer"
+                },
+                "memory_entries": {
+                    "type": "integer"
+                }
+            }
+        },
+        "jobs.Job": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "the job and its result are dropped after this time",
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "progress": {
+                    "description": "percentage, 100 once the job is finished",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "result size in bytes",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/jobs.Status"
+                }
+            }
+        },
+        "jobs.Status": {
+            "type": "string",
+            "enum": [
+                "queued",
+                "running",
+                "succeeded",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "StatusQueued",
+                "StatusRunning",
+                "StatusSucceeded",
+                "StatusFailed"
+            ]
+        },
+        "main.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ThumbnailSize": {
+            "type": "object",
+            "properties": {
+                "height": {
+                    "type": "integer"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.cachePurgeResponse": {
+            "type": "object",
+            "properties": {
+                "purged": {
+                    "description": "number of removed entries",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.destinationResponse": {
+            "type": "object",
+            "properties": {
+                "destination": {
+                    "description": "bucket/key",
+                    "type": "string"
+                },
+                "location": {
+                    "description": "URL of the written object",
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "presets.Preset": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "operations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/utils.Operation"
+                    }
+                }
+            }
+        },
+        "utils.ImageInfo": {
+            "type": "object",
+            "properties": {
+                "bit_depth": {
+                    "description": "bits per component",
+                    "type": "integer"
+                },
+                "codec": {
+                    "description": "ffmpeg codec name, e.g. \"mjpeg\"",
+                    "type": "string"
+                },
+                "color_space": {
+                    "description": "e.g. \"bt470bg\", empty when unknown",
+                    "type": "string"
+                },
+                "container": {
+                    "description": "ffmpeg demuxer name, e.g. \"png_pipe\"",
+                    "type": "string"
+                },
+                "duration": {
+                    "description": "seconds, 0 for still images",
+                    "type": "number"
+                },
+                "file_size": {
+                    "description": "bytes",
+                    "type": "integer"
+                },
+                "frame_count": {
+                    "description": "1 for still images",
+                    "type": "integer"
+                },
+                "has_alpha": {
+                    "description": "whether the pixel format has an alpha channel",
+                    "type": "boolean"
+                },
+                "has_exif": {
+                    "type": "boolean"
+                },
+                "has_icc": {
+                    "type": "boolean"
+                },
+                "has_xmp": {
+                    "type": "boolean"
+                },
+                "height": {
+                    "description": "height in pixels",
+                    "type": "integer"
+                },
+                "loop_count": {
+                    "description": "number of plays of animations, 0 means forever or still image",
+                    "type": "integer"
+                },
+                "mime_type": {
+                    "description": "mimetype returned by the processing endpoints",
+                    "type": "string"
+                },
+                "orientation": {
+                    "description": "EXIF orientation (1-8)",
+                    "type": "integer"
+                },
+                "page_count": {
+                    "description": "number of pages of multi-page TIFF, 1 for other formats",
+                    "type": "integer"
+                },
+                "pixel_format": {
+                    "description": "ffmpeg pixel format, e.g. \"rgba\"",
+                    "type": "string"
+                },
+                "width": {
+                    "description": "width in pixels",
+                    "type": "integer"
+                }
+            }
+        },
+        "utils.Operation": {
+            "type": "object",
+            "properties": {
+                "angle": {
+                    "type": "number"
+                },
+                "background": {
+                    "type": "string"
+                },
+                "chroma_subsampling": {
+                    "description": "ChromaSubsampling is the jpeg chroma subsampling (\"444\", \"422\" or \"420\")",
+                    "type": "string"
+                },
+                "compression_level": {
+                    "type": "integer"
+                },
+                "direction": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "gravity": {
+                    "type": "string"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "lossless": {
+                    "description": "Lossless encode the webp losslessly, Quality is then the compression effort",
+                    "type": "boolean"
+                },
+                "method": {
+                    "description": "Method is the webp compression method from 0 (fastest) to 6 (smallest)",
+                    "type": "integer"
+                },
+                "mode": {
+                    "type": "string"
+                },
+                "near_lossless": {
+                    "description": "NearLossless is the webp near lossless level, the ffmpeg libwebp encoder doesn't expose it so it is rejected",
+                    "type": "integer"
+                },
+                "op": {
+                    "type": "string"
+                },
+                "palette": {
+                    "description": "Palette reduce the png to a 256 colours palette",
+                    "type": "boolean"
+                },
+                "png_compression_level": {
+                    "description": "PngCompressionLevel is the png zlib level from 0 (fastest) to 9 (smallest)",
+                    "type": "integer"
+                },
+                "progressive": {
+                    "description": "Progressive request a progressive jpeg, the ffmpeg mjpeg encoder only produce baseline jpeg so it is rejected",
+                    "type": "boolean"
+                },
+                "quality": {
+                    "description": "Quality is the jpeg, webp or avif quality from 1 (worst) to 100 (best)",
+                    "type": "integer"
+                },
+                "tiff_compression": {
+                    "description": "TiffCompression is the tiff compression (\"none\", \"lzw\" or \"deflate\"), ffmpeg default to packbits",
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                },
+                "x": {
+                    "type": "integer"
+                },
+                "y": {
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
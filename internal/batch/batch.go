@@ -0,0 +1,226 @@
+// Package batch apply the same processing to many files with a bounded number of workers
+// and pack the results in a zip archive together with a JSON manifest
+package batch
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ManifestName is the name of the manifest in the archive written by WriteZip
+const ManifestName = "manifest.json"
+
+var (
+	// ErrTooManyFiles is returned when the input contains more files than allowed
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrTooLarge is returned when the uncompressed input is larger than allowed
+	ErrTooLarge = errors.New("files are too large")
+	// ErrNoFiles is returned when the input doesn't contain any file
+	ErrNoFiles = errors.New("no file to process")
+)
+
+// File is an input or output file, Name is a slash separated relative path
+// URL is the address of the input files downloaded by the ProcessFunc, their Data is then empty
+type File struct {
+	Name string
+	Data []byte
+	URL  string
+}
+
+// ProcessFunc process one input file and return the output data and its file extension
+type ProcessFunc func(file File) (data []byte, extension string, err error)
+
+// Entry report the outcome of one input file
+type Entry struct {
+	Source string `json:"source"`           // name of the input file, or its URL
+	Output string `json:"output,omitempty"` // name of the output file in the archive
+	Error  string `json:"error,omitempty"`
+}
+
+// Manifest list the outcome of every input file, in input order
+type Manifest struct {
+	Total     int     `json:"total"`
+	Succeeded int     `json:"succeeded"`
+	Failed    int     `json:"failed"`
+	Files     []Entry `json:"files"`
+	Failures  []Entry `json:"failures"`
+}
+
+// ReadZip return the regular files of the zip archive stored in data
+// directories, hidden files and non-local paths are skipped,
+// at most maxFiles files and maxBytes uncompressed bytes are accepted
+func ReadZip(data []byte, maxFiles int, maxBytes int64) ([]File, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %s", err.Error())
+	}
+
+	var files []File
+	var total int64
+	for _, entry := range reader.File {
+		name := path.Clean(strings.ReplaceAll(entry.Name, "\\", "/"))
+		if entry.FileInfo().IsDir() || !isLocal(name) || isHidden(name) {
+			continue
+		}
+		if len(files) >= maxFiles {
+			return nil, ErrTooManyFiles
+		}
+
+		// Don't trust the sizes declared in the archive
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		total += int64(len(content))
+		if total > maxBytes {
+			return nil, ErrTooLarge
+		}
+		files = append(files, File{Name: name, Data: content})
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFiles
+	}
+	return files, nil
+}
+
+// Process run process on every file with at most workers concurrent calls
+// it return the outputs of the succeeded files, in input order, and the manifest
+// output names are the source names with the returned extension, made unique
+func Process(files []File, workers int, process ProcessFunc) ([]File, Manifest) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type result struct {
+		data      []byte
+		extension string
+		err       error
+	}
+	results := make([]result, len(files))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				data, extension, err := runProcess(process, files[index])
+				results[index] = result{data, extension, err}
+			}
+		}()
+	}
+	for index := range files {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	manifest := Manifest{
+		Total:    len(files),
+		Files:    []Entry{},
+		Failures: []Entry{},
+	}
+	var outputs []File
+	names := map[string]bool{ManifestName: true}
+	for i, file := range files {
+		entry := Entry{Source: file.Name}
+		if file.URL != "" {
+			entry.Source = file.URL
+		}
+		if err := results[i].err; err != nil {
+			entry.Error = err.Error()
+			manifest.Failed++
+			manifest.Failures = append(manifest.Failures, entry)
+		} else {
+			entry.Output = uniqueName(names, outputName(file.Name, results[i].extension))
+			manifest.Succeeded++
+			outputs = append(outputs, File{Name: entry.Output, Data: results[i].data})
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	return outputs, manifest
+}
+
+// WriteZip write the outputs and the manifest to w as a zip archive
+func WriteZip(w io.Writer, outputs []File, manifest Manifest) error {
+	writer := zip.NewWriter(w)
+	for _, output := range outputs {
+		// Images are already compressed
+		fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: output.Name, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fileWriter.Write(output.Data); err != nil {
+			return err
+		}
+	}
+
+	fileWriter, err := writer.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fileWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// runProcess call process, a panic is reported as an error so the other files are still processed
+func runProcess(process ProcessFunc, file File) (data []byte, extension string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("internal error while processing")
+		}
+	}()
+	return process(file)
+}
+
+// outputName replace the extension of name
+func outputName(name string, extension string) string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if extension == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", name, extension)
+}
+
+// uniqueName suffix name with a counter when it is already used
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	extension := path.Ext(name)
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, extension), i, extension)
+	}
+	names[unique] = true
+	return unique
+}
+
+// isLocal report whether the cleaned slash separated name stay inside the archive
+func isLocal(name string) bool {
+	return name != "." && name != ".." && !strings.HasPrefix(name, "../") && !path.IsAbs(name) && !strings.Contains(name, ":")
+}
+
+// isHidden report whether one of the path elements start with a dot or is a macOS resource fork directory
+func isHidden(name string) bool {
+	for _, element := range strings.Split(name, "/") {
+		if strings.HasPrefix(element, ".") || element == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package batch
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipArchive build a zip archive holding the given name -> content entries, in order
+func zipArchive(t *testing.T, entries ...[2]string) []byte {
+	buf := bytes.NewBuffer(nil)
+	writer := zip.NewWriter(buf)
+	for _, entry := range entries {
+		fileWriter, err := writer.Create(entry[0])
+		assert.NoError(t, err)
+		fileWriter.Write([]byte(entry[1]))
+	}
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestReadZip(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name      string
+		data      []byte
+		maxFiles  int
+		maxBytes  int64
+		wantFiles []File
+		wantError error
+	}{
+		{
+			"files",
+			zipArchive(t, [2]string{"a.png", "aa"}, [2]string{"shoes/b.jpg", "bbb"}),
+			10, 100,
+			[]File{{Name: "a.png", Data: []byte("aa")}, {Name: "shoes/b.jpg", Data: []byte("bbb")}},
+			nil,
+		},
+		{
+			"skipped entries",
+			zipArchive(t,
+				[2]string{"dir/", ""},
+				[2]string{"../evil.png", "x"},
+				[2]string{"/abs.png", "x"},
+				[2]string{".DS_Store", "x"},
+				[2]string{"__MACOSX/._a.png", "x"},
+				[2]string{"a.png", "aa"},
+			),
+			10, 100,
+			[]File{{Name: "a.png", Data: []byte("aa")}},
+			nil,
+		},
+		{"too many files", zipArchive(t, [2]string{"a.png", "a"}, [2]string{"b.png", "b"}), 1, 100, nil, ErrTooManyFiles},
+		{"too large", zipArchive(t, [2]string{"a.png", "aaaa"}, [2]string{"b.png", "bbbb"}), 10, 7, nil, ErrTooLarge},
+		{"empty", zipArchive(t), 10, 100, nil, ErrNoFiles},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestReadZip %s",
+			tt.name,
+		), func(t *testing.T) {
+			files, err := ReadZip(tt.data, tt.maxFiles, tt.maxBytes)
+			assert.Equal(tt.wantError, err)
+			assert.Equal(tt.wantFiles, files)
+		})
+	}
+
+	_, err := ReadZip([]byte("not a zip"), 10, 100)
+	assert.Error(err)
+}
+
+func TestProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	files := []File{
+		{Name: "a.png", Data: []byte("a")},
+		{Name: "broken.png", Data: []byte("broken")},
+		{Name: "shoes/b.jpeg", Data: []byte("b")},
+		{Name: "a.bmp", Data: []byte("c")},
+		{Name: "d", Data: []byte("d")},
+	}
+
+	var running, maxRunning int32
+	outputs, manifest := Process(files, 2, func(file File) ([]byte, string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if string(file.Data) == "broken" {
+			return nil, "", errors.New("can't probe file")
+		}
+		return bytes.ToUpper(file.Data), "webp", nil
+	})
+
+	assert.LessOrEqual(maxRunning, int32(2))
+	assert.Equal([]File{
+		{Name: "a.webp", Data: []byte("A")},
+		{Name: "shoes/b.webp", Data: []byte("B")},
+		{Name: "a-2.webp", Data: []byte("C")},
+		{Name: "d.webp", Data: []byte("D")},
+	}, outputs)
+	assert.Equal(Manifest{
+		Total:     5,
+		Succeeded: 4,
+		Failed:    1,
+		Files: []Entry{
+			{Source: "a.png", Output: "a.webp"},
+			{Source: "broken.png", Error: "can't probe file"},
+			{Source: "shoes/b.jpeg", Output: "shoes/b.webp"},
+			{Source: "a.bmp", Output: "a-2.webp"},
+			{Source: "d", Output: "d.webp"},
+		},
+		Failures: []Entry{{Source: "broken.png", Error: "can't probe file"}},
+	}, manifest)
+}
+
+func TestProcessPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	outputs, manifest := Process([]File{{Name: "a.png", Data: nil}}, 4, func(file File) ([]byte, string, error) {
+		panic("boom")
+	})
+	assert.Empty(outputs)
+	assert.Equal(1, manifest.Failed)
+	assert.Equal("internal error while processing", manifest.Failures[0].Error)
+}
+
+func TestProcessURL(t *testing.T) {
+	assert := assert.New(t)
+
+	files := []File{
+		{Name: "a.png", URL: "https://example.com/a.png"},
+		{Name: "b.png", URL: "https://example.com/missing/b.png"},
+	}
+	outputs, manifest := Process(files, 2, func(file File) ([]byte, string, error) {
+		if strings.Contains(file.URL, "missing") {
+			return nil, "", errors.New("not found")
+		}
+		return []byte(file.URL), "webp", nil
+	})
+
+	assert.Equal([]File{{Name: "a.webp", Data: []byte("https://example.com/a.png")}}, outputs)
+	assert.Equal([]Entry{
+		{Source: "https://example.com/a.png", Output: "a.webp"},
+		{Source: "https://example.com/missing/b.png", Error: "not found"},
+	}, manifest.Files)
+}
+
+func TestWriteZip(t *testing.T) {
+	assert := assert.New(t)
+
+	outputs := []File{{Name: "a.webp", Data: []byte("A")}, {Name: "shoes/b.webp", Data: []byte("B")}}
+	manifest := Manifest{
+		Total:     3,
+		Succeeded: 2,
+		Failed:    1,
+		Files:     []Entry{{Source: "a.png", Output: "a.webp"}, {Source: "shoes/b.png", Output: "shoes/b.webp"}, {Source: "c.png", Error: "failed"}},
+		Failures:  []Entry{{Source: "c.png", Error: "failed"}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(WriteZip(buf, outputs, manifest))
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	contents := map[string][]byte{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		assert.NoError(err)
+		contents[file.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	assert.Len(contents, 3)
+	assert.Equal([]byte("A"), contents["a.webp"])
+	assert.Equal([]byte("B"), contents["shoes/b.webp"])
+
+	var decoded Manifest
+	assert.NoError(json.Unmarshal(contents[ManifestName], &decoded))
+	assert.Equal(manifest, decoded)
+}
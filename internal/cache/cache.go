@@ -0,0 +1,364 @@
+// Package cache keep processed images keyed by a hash of their input and parameters
+// in a memory LRU tier and an optional disk tier, both bounded by their total size
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tier holding a cache entry
+type Tier string
+
+const (
+	TierMemory Tier = "memory"
+	TierDisk   Tier = "disk"
+)
+
+// ErrTooLarge is returned by Set for entries larger than every tier
+var ErrTooLarge = errors.New("cache entry is too large")
+
+// Entry is a cached response
+type Entry struct {
+	Data   []byte
+	Header map[string]string // response headers, e.g. Content-Type
+}
+
+// size return the number of bytes accounted for the entry
+func (entry Entry) size() int64 {
+	size := int64(len(entry.Data))
+	for name, value := range entry.Header {
+		size += int64(len(name) + len(value))
+	}
+	return size
+}
+
+// Key return the hex SHA-256 of inputs and params, params must be normalised by the caller
+// so that equivalent requests share the same key
+func Key(inputs [][]byte, params ...string) string {
+	hash := sha256.New()
+	// Length prefixes, so that moving bytes between parts change the key
+	binary.Write(hash, binary.BigEndian, uint64(len(inputs)))
+	for _, input := range inputs {
+		binary.Write(hash, binary.BigEndian, uint64(len(input)))
+		hash.Write(input)
+	}
+	for _, param := range params {
+		binary.Write(hash, binary.BigEndian, uint64(len(param)))
+		hash.Write([]byte(param))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Cache is safe for concurrent use, entries are looked up in memory then on disk
+// and evicted least recently used first
+type Cache struct {
+	mu     sync.Mutex
+	memory *lru
+	disk   *lru
+	dir    string
+}
+
+type item struct {
+	key   string
+	size  int64
+	entry Entry // empty for the disk tier
+}
+
+// lru track the entries of a tier, most recently used first
+type lru struct {
+	maxBytes int64
+	size     int64
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func newLru(maxBytes int64) *lru {
+	return &lru{maxBytes: maxBytes, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// add insert or refresh item and return the evicted items
+func (tier *lru) add(added item) []item {
+	tier.remove(added.key)
+	tier.items[added.key] = tier.order.PushFront(added)
+	tier.size += added.size
+
+	var evicted []item
+	for tier.size > tier.maxBytes {
+		oldest := tier.order.Back()
+		evicted = append(evicted, oldest.Value.(item))
+		tier.remove(oldest.Value.(item).key)
+	}
+	return evicted
+}
+
+func (tier *lru) get(key string) (item, bool) {
+	element, ok := tier.items[key]
+	if !ok {
+		return item{}, false
+	}
+	tier.order.MoveToFront(element)
+	return element.Value.(item), true
+}
+
+func (tier *lru) remove(key string) bool {
+	element, ok := tier.items[key]
+	if !ok {
+		return false
+	}
+	tier.order.Remove(element)
+	delete(tier.items, key)
+	tier.size -= element.Value.(item).size
+	return true
+}
+
+// New return a cache keeping up to memoryBytes in memory, 0 disable the memory tier
+// when dir is not empty, up to diskBytes are also kept in dir, the entries already there are reused
+func New(memoryBytes int64, dir string, diskBytes int64) (*Cache, error) {
+	cache := &Cache{memory: newLru(memoryBytes)}
+	if dir == "" {
+		return cache, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cache.dir = dir
+	cache.disk = newLru(diskBytes)
+
+	// Reload the entries of a previous run, the last modification is the last use
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type stored struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var entries []stored
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() || !isKey(file.Name()) {
+			continue
+		}
+		entries = append(entries, stored{file.Name(), info.Size(), info.ModTime()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, stored := range entries {
+		for _, evicted := range cache.disk.add(item{key: stored.key, size: stored.size}) {
+			os.Remove(cache.path(evicted.key))
+		}
+	}
+	return cache, nil
+}
+
+// Get return the entry stored for key and the tier it was found in,
+// entries found on disk are copied back in memory
+func (cache *Cache) Get(key string) (Entry, Tier, bool) {
+	cache.mu.Lock()
+	if cached, ok := cache.memory.get(key); ok {
+		cache.mu.Unlock()
+		return cached.entry, TierMemory, true
+	}
+	var element *list.Element
+	if cache.disk != nil {
+		element = cache.disk.items[key]
+	}
+	cache.mu.Unlock()
+	if element == nil {
+		return Entry{}, "", false
+	}
+
+	// The disk tier file is read without holding the lock, the entry may be replaced or evicted meanwhile
+	// so the tiers are only updated when it is still the one looked up
+	entry, err := cache.read(key)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	current := cache.disk.items[key] == element
+	if err != nil {
+		// Removed or corrupted file
+		if current {
+			cache.disk.remove(key)
+			os.Remove(cache.path(key))
+		}
+		return Entry{}, "", false
+	}
+	if current {
+		cache.disk.get(key)
+		now := time.Now()
+		os.Chtimes(cache.path(key), now, now)
+		cache.addMemory(key, entry)
+	}
+	return entry, TierDisk, true
+}
+
+// Set store entry for key in memory and, when enabled, on disk
+func (cache *Cache) Set(key string, entry Entry) error {
+	if !isKey(key) {
+		return fmt.Errorf("invalid cache key %q", key)
+	}
+
+	// The disk tier file is written without holding the lock, it is only renamed to key while holding it
+	var temp string
+	var size int64
+	if cache.dir != "" {
+		var err error
+		if temp, size, err = cache.write(entry); err != nil {
+			return err
+		}
+		defer os.Remove(temp)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stored := cache.addMemory(key, entry)
+	if cache.disk == nil {
+		if !stored {
+			return ErrTooLarge
+		}
+		return nil
+	}
+
+	if size > cache.disk.maxBytes {
+		// Drop the previous entry stored for key, it is outdated
+		if cache.disk.remove(key) {
+			os.Remove(cache.path(key))
+		}
+		if !stored {
+			return ErrTooLarge
+		}
+		return nil
+	}
+	if err := os.Rename(temp, cache.path(key)); err != nil {
+		return err
+	}
+	for _, evicted := range cache.disk.add(item{key: key, size: size}) {
+		os.Remove(cache.path(evicted.key))
+	}
+	return nil
+}
+
+// Delete remove the entry stored for key from every tier and report whether it was found
+func (cache *Cache) Delete(key string) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	found := cache.memory.remove(key)
+	if cache.disk != nil && cache.disk.remove(key) {
+		os.Remove(cache.path(key))
+		found = true
+	}
+	return found
+}
+
+// Purge remove every entry and return how many were removed
+func (cache *Cache) Purge() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	keys := map[string]bool{}
+	for key := range cache.memory.items {
+		keys[key] = true
+	}
+	cache.memory = newLru(cache.memory.maxBytes)
+	if cache.disk != nil {
+		for key := range cache.disk.items {
+			keys[key] = true
+			os.Remove(cache.path(key))
+		}
+		cache.disk = newLru(cache.disk.maxBytes)
+	}
+	return len(keys)
+}
+
+// Stats is the occupancy of the cache tiers
+type Stats struct {
+	MemoryEntries int   `json:"memory_entries"`
+	MemoryBytes   int64 `json:"memory_bytes"`
+	DiskEntries   int   `json:"disk_entries"`
+	DiskBytes     int64 `json:"disk_bytes"`
+}
+
+// Stats return the number of entries and bytes held by each tier
+func (cache *Cache) Stats() Stats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stats := Stats{MemoryEntries: len(cache.memory.items), MemoryBytes: cache.memory.size}
+	if cache.disk != nil {
+		stats.DiskEntries, stats.DiskBytes = len(cache.disk.items), cache.disk.size
+	}
+	return stats
+}
+
+// addMemory store entry in the memory tier when it fits
+func (cache *Cache) addMemory(key string, entry Entry) bool {
+	size := entry.size()
+	if size > cache.memory.maxBytes {
+		cache.memory.remove(key)
+		return false
+	}
+	cache.memory.add(item{key: key, size: size, entry: entry})
+	return true
+}
+
+func (cache *Cache) path(key string) string {
+	return filepath.Join(cache.dir, key)
+}
+
+func (cache *Cache) read(key string) (Entry, error) {
+	file, err := os.Open(cache.path(key))
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+
+	var entry Entry
+	err = gob.NewDecoder(file).Decode(&entry)
+	return entry, err
+}
+
+// write store entry in a temporary file of the cache directory and return its path and size,
+// the caller rename it once the entry is published or remove it
+func (cache *Cache) write(entry Entry) (string, int64, error) {
+	file, err := os.CreateTemp(cache.dir, ".tmp-*")
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := gob.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", 0, err
+	}
+	return file.Name(), info.Size(), nil
+}
+
+// isKey report whether key is a hex SHA-256 as returned by Key
+func isKey(key string) bool {
+	decoded, err := hex.DecodeString(key)
+	return err == nil && len(decoded) == sha256.Size && hex.EncodeToString(decoded) == key
+}
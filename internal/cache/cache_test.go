@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// entryOf return an entry whose data is size bytes filled with fill
+func entryOf(fill byte, size int) Entry {
+	return Entry{Data: bytes.Repeat([]byte{fill}, size), Header: map[string]string{}}
+}
+
+func TestKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key := Key([][]byte{[]byte("image")}, "/resize_image", "width=100")
+	assert.Len(key, 64)
+	assert.True(isKey(key))
+
+	var tests = []struct {
+		name   string
+		inputs [][]byte
+		params []string
+	}{
+		{"other input", [][]byte{[]byte("imagf")}, []string{"/resize_image", "width=100"}},
+		{"other params", [][]byte{[]byte("image")}, []string{"/resize_image", "width=200"}},
+		{"moved bytes", [][]byte{[]byte("image/resize_image")}, []string{"width=100"}},
+		{"split params", [][]byte{[]byte("image")}, []string{"/resize_image", "width=", "100"}},
+		{"no input", nil, []string{"image", "/resize_image", "width=100"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestKey %s",
+			tt.name,
+		), func(t *testing.T) {
+			assert.NotEqual(key, Key(tt.inputs, tt.params...))
+		})
+	}
+	assert.Equal(key, Key([][]byte{[]byte("image")}, "/resize_image", "width=100"))
+}
+
+func TestMemory(t *testing.T) {
+	assert := assert.New(t)
+	cache, err := New(100, "", 0)
+	assert.NoError(err)
+
+	keys := []string{Key(nil, "a"), Key(nil, "b"), Key(nil, "c")}
+	assert.NoError(cache.Set(keys[0], entryOf('a', 40)))
+	assert.NoError(cache.Set(keys[1], entryOf('b', 40)))
+
+	entry, tier, ok := cache.Get(keys[0])
+	assert.True(ok)
+	assert.Equal(TierMemory, tier)
+	assert.Equal(entryOf('a', 40), entry)
+
+	// b is the least recently used
+	assert.NoError(cache.Set(keys[2], entryOf('c', 40)))
+	_, _, ok = cache.Get(keys[1])
+	assert.False(ok)
+	_, _, ok = cache.Get(keys[0])
+	assert.True(ok)
+	assert.Equal(Stats{MemoryEntries: 2, MemoryBytes: 80}, cache.Stats())
+
+	assert.ErrorIs(cache.Set(keys[1], entryOf('b', 101)), ErrTooLarge)
+	assert.Error(cache.Set("../key", entryOf('b', 1)))
+
+	assert.True(cache.Delete(keys[0]))
+	assert.False(cache.Delete(keys[0]))
+	assert.Equal(1, cache.Purge())
+	assert.Equal(Stats{}, cache.Stats())
+}
+
+func TestDisk(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	cache, err := New(0, dir, 500)
+	assert.NoError(err)
+
+	keys := []string{Key(nil, "a"), Key(nil, "b"), Key(nil, "c")}
+	entry := Entry{Data: []byte("image"), Header: map[string]string{"Content-Type": "image/png"}}
+	assert.NoError(cache.Set(keys[0], entry))
+
+	got, tier, ok := cache.Get(keys[0])
+	assert.True(ok)
+	assert.Equal(TierDisk, tier)
+	assert.Equal(entry, got)
+
+	// The oldest entry is evicted once the files exceed 500 bytes
+	assert.NoError(cache.Set(keys[1], entryOf('b', 120)))
+	assert.NoError(cache.Set(keys[2], entryOf('c', 120)))
+	stats := cache.Stats()
+	assert.Equal(2, stats.DiskEntries)
+	assert.LessOrEqual(stats.DiskBytes, int64(500))
+	_, _, ok = cache.Get(keys[0])
+	assert.False(ok)
+	assert.NoFileExists(filepath.Join(dir, keys[0]))
+
+	assert.ErrorIs(cache.Set(keys[0], entryOf('a', 600)), ErrTooLarge)
+	assert.NoFileExists(filepath.Join(dir, keys[0]))
+
+	// A new cache reuse the files, evicting the least recently used first
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(os.Chtimes(filepath.Join(dir, keys[2]), old, old))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "unrelated"), []byte("file"), 0o644))
+	reloaded, err := New(0, dir, 300)
+	assert.NoError(err)
+	assert.Equal(1, reloaded.Stats().DiskEntries)
+	got, _, ok = reloaded.Get(keys[1])
+	assert.True(ok)
+	assert.Equal(entryOf('b', 120), got)
+	assert.NoFileExists(filepath.Join(dir, keys[2]))
+	assert.FileExists(filepath.Join(dir, "unrelated"))
+
+	// Corrupted files are dropped
+	assert.NoError(os.WriteFile(filepath.Join(dir, keys[1]), []byte("corrupted"), 0o644))
+	_, _, ok = reloaded.Get(keys[1])
+	assert.False(ok)
+	assert.NoFileExists(filepath.Join(dir, keys[1]))
+
+	assert.NoError(reloaded.Set(keys[0], entry))
+	assert.Equal(1, reloaded.Purge())
+	assert.NoFileExists(filepath.Join(dir, keys[0]))
+}
+
+func TestTiers(t *testing.T) {
+	assert := assert.New(t)
+	cache, err := New(100, t.TempDir(), 1000)
+	assert.NoError(err)
+
+	keys := []string{Key(nil, "a"), Key(nil, "b")}
+	assert.NoError(cache.Set(keys[0], entryOf('a', 60)))
+	assert.NoError(cache.Set(keys[1], entryOf('b', 60)))
+
+	// a was evicted from memory but is still on disk, then copied back in memory
+	_, tier, ok := cache.Get(keys[0])
+	assert.True(ok)
+	assert.Equal(TierDisk, tier)
+	_, tier, ok = cache.Get(keys[0])
+	assert.True(ok)
+	assert.Equal(TierMemory, tier)
+
+	// Too large for memory but stored on disk
+	assert.NoError(cache.Set(keys[1], entryOf('b', 200)))
+	_, tier, ok = cache.Get(keys[1])
+	assert.True(ok)
+	assert.Equal(TierDisk, tier)
+
+	assert.True(cache.Delete(keys[0]))
+	_, _, ok = cache.Get(keys[0])
+	assert.False(ok)
+}
+
+func TestConcurrentSet(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	cache, err := New(0, dir, 1000)
+	assert.NoError(err)
+
+	keys := []string{Key(nil, "a"), Key(nil, "b")}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(cache.Set(keys[i%2], entryOf(byte('a'+i%2), 100)))
+			cache.Get(keys[i%2])
+		}(i)
+	}
+	wg.Wait()
+
+	// Every temporary file was renamed or removed
+	files, err := os.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 2)
+	for i, key := range keys {
+		got, _, ok := cache.Get(key)
+		assert.True(ok)
+		assert.Equal(entryOf(byte('a'+i), 100), got)
+	}
+
+	// An entry too large for the disk tier drop the outdated one
+	assert.ErrorIs(cache.Set(keys[0], entryOf('a', 2000)), ErrTooLarge)
+	_, _, ok := cache.Get(keys[0])
+	assert.False(ok)
+	assert.NoFileExists(filepath.Join(dir, keys[0]))
+}
+
+func TestConcurrentGet(t *testing.T) {
+	assert := assert.New(t)
+	cache, err := New(0, t.TempDir(), 1000)
+	assert.NoError(err)
+
+	// Twice the entries the disk tier can hold, so the reads race with the evictions
+	var keys []string
+	for i := 0; i < 20; i++ {
+		keys = append(keys, Key(nil, fmt.Sprintf("%d", i)))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := keys[i%len(keys)]
+			if i%3 == 0 {
+				assert.NoError(cache.Set(key, entryOf(byte(i%len(keys)), 100)))
+				return
+			}
+			if got, tier, ok := cache.Get(key); ok {
+				assert.Equal(TierDisk, tier)
+				assert.Equal(entryOf(byte(i%len(keys)), 100), got)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	assert.LessOrEqual(stats.DiskBytes, int64(1000))
+	assert.Equal(0, stats.MemoryEntries)
+}
@@ -0,0 +1,282 @@
+// Package fetch download source images from remote URLs
+//
+// The addresses are checked when connecting, after DNS resolution and for every redirect, so that
+// the private, loopback and link-local networks can't be reached unless they are allowlisted.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultContentTypes are the media types accepted when Fetcher.ContentTypes is empty
+var DefaultContentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"image/gif",
+	"image/bmp",
+	"image/avif",
+	"image/tiff",
+}
+
+var (
+	// ErrInvalidURL is returned for URLs which are not absolute http or https URLs
+	ErrInvalidURL = errors.New("url must be an absolute http or https url")
+	// ErrBlockedAddress is returned when the host resolve to a blocked address
+	ErrBlockedAddress = errors.New("address is not allowed")
+	// ErrTooManyRedirects is returned when the redirects exceed Fetcher.MaxRedirects
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrTooLarge is returned when the body exceeds Fetcher.MaxBytes
+	ErrTooLarge = errors.New("image is too large")
+	// ErrContentType is returned for the content types which are not allowed
+	ErrContentType = errors.New("content type is not allowed")
+)
+
+// StatusError is returned when the server doesn't answer 200
+type StatusError struct {
+	StatusCode int
+}
+
+func (err StatusError) Error() string {
+	return fmt.Sprintf("server answered %d", err.StatusCode)
+}
+
+// blockedPrefixes are the networks which can't be reached unless allowlisted, on top of the loopback, private,
+// link-local, unspecified and multicast ones reported by netip.Addr (IPv4-mapped addresses are checked as IPv4)
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may embed a private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/32"),       // Teredo, may embed a private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, may embed a private IPv4
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// Image is a downloaded image
+type Image struct {
+	Data        []byte
+	ContentType string
+	FileName    string // last element of the URL path, "image" when empty
+}
+
+// Fetcher download images with limits, its zero value use the defaults
+type Fetcher struct {
+	// MaxBytes is the maximum size of the images, 64 MiB when < 1
+	MaxBytes int64
+	// Timeout bound the whole download, redirects included, 30s when < 1
+	Timeout time.Duration
+	// MaxRedirects is the number of redirects followed, none when < 1
+	MaxRedirects int
+	// ContentTypes are the media types accepted, DefaultContentTypes when empty
+	ContentTypes []string
+	// Allowlist are the networks reachable despite being blocked, e.g. an internal image server
+	Allowlist []netip.Prefix
+
+	once   sync.Once
+	client *http.Client
+}
+
+// Fetch download the image at rawURL
+func (fetcher *Fetcher) Fetch(ctx context.Context, rawURL string) (Image, error) {
+	imageURL, err := url.Parse(rawURL)
+	if err != nil || !isHTTP(imageURL) {
+		return Image{}, ErrInvalidURL
+	}
+
+	fetcher.once.Do(fetcher.init)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL.String(), nil)
+	if err != nil {
+		return Image{}, ErrInvalidURL
+	}
+	request.Header.Set("Accept", strings.Join(fetcher.contentTypes(), ", "))
+	response, err := fetcher.client.Do(request)
+	if err != nil {
+		// Report the errors of the dialer and of CheckRedirect as is
+		for _, target := range []error{ErrBlockedAddress, ErrTooManyRedirects, ErrInvalidURL} {
+			if errors.Is(err, target) {
+				return Image{}, target
+			}
+		}
+		return Image{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Image{}, StatusError{StatusCode: response.StatusCode}
+	}
+	contentType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || !fetcher.allowedContentType(contentType) {
+		return Image{}, fmt.Errorf("%w: %q", ErrContentType, response.Header.Get("Content-Type"))
+	}
+
+	maxBytes := fetcher.maxBytes()
+	if response.ContentLength > maxBytes {
+		return Image{}, ErrTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxBytes+1))
+	if err != nil {
+		return Image{}, err
+	}
+	if int64(len(data)) > maxBytes {
+		return Image{}, ErrTooLarge
+	}
+
+	fileName := path.Base(response.Request.URL.Path)
+	if fileName == "/" || fileName == "." {
+		fileName = "image"
+	}
+	return Image{Data: data, ContentType: contentType, FileName: fileName}, nil
+}
+
+// init build the HTTP client, the dialer check every address it connects to
+func (fetcher *Fetcher) init() {
+	timeout := fetcher.Timeout
+	if timeout < 1 {
+		timeout = 30 * time.Second
+	}
+	fetcher.client = &http.Client{
+		Timeout:   timeout,
+		Transport: newTransport(fetcher.Allowlist, timeout),
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > fetcher.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if !isHTTP(request.URL) {
+				return ErrInvalidURL
+			}
+			return nil
+		},
+	}
+}
+
+// NewClient return an HTTP client checking the addresses it connects to like Fetcher: the blocked ones which are not
+// in allowlist are refused with ErrBlockedAddress, redirects are not followed (the 3xx response is returned)
+func NewClient(allowlist []netip.Prefix, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: newTransport(allowlist, timeout),
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// newTransport return a transport whose dialer refuse the addresses not allowed by allowlist
+func newTransport(allowlist []netip.Prefix, timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allowed(addrPort.Addr(), allowlist) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		// No proxy, it would be the only address checked
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+	}
+}
+
+// Allowed report whether addr can be reached: it is public or allowlisted
+func (fetcher *Fetcher) Allowed(addr netip.Addr) bool {
+	return allowed(addr, fetcher.Allowlist)
+}
+
+// allowed report whether addr is public or in allowlist
+func allowed(addr netip.Addr, allowlist []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (fetcher *Fetcher) maxBytes() int64 {
+	if fetcher.MaxBytes < 1 {
+		return 64 << 20
+	}
+	return fetcher.MaxBytes
+}
+
+func (fetcher *Fetcher) contentTypes() []string {
+	if len(fetcher.ContentTypes) == 0 {
+		return DefaultContentTypes
+	}
+	return fetcher.ContentTypes
+}
+
+func (fetcher *Fetcher) allowedContentType(contentType string) bool {
+	for _, allowed := range fetcher.contentTypes() {
+		if strings.EqualFold(allowed, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAllowlist parse a comma separated list of networks ("10.0.0.0/8") and addresses ("10.1.2.3")
+func ParseAllowlist(value string) ([]netip.Prefix, error) {
+	var allowlist []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			allowlist = append(allowlist, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a network nor an address", entry)
+		}
+		allowlist = append(allowlist, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return allowlist, nil
+}
+
+func isHTTP(target *url.URL) bool {
+	return (target.Scheme == "http" || target.Scheme == "https") && target.Host != "" && target.User == nil
+}
@@ -0,0 +1,263 @@
+// Package jobs run image processing tasks in the background with a bounded pool of workers
+// and keep their results in memory until they expire
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Status of a Job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the maximum number of pending jobs is reached
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrQueueClosed is returned by Submit after Close
+	ErrQueueClosed = errors.New("job queue is closed")
+	// ErrNotFound is returned for unknown or expired jobs
+	ErrNotFound = errors.New("job not found")
+	// ErrNotFinished is returned by Result while the job is queued or running
+	ErrNotFinished = errors.New("job is not finished")
+	// ErrFailed is returned by Result for failed jobs
+	ErrFailed = errors.New("job failed")
+)
+
+// Result is the output of a successful Task
+type Result struct {
+	Data     []byte
+	MimeType string
+}
+
+// Task is the work executed by a job, it may call progress with a percentage (0-100)
+type Task func(progress func(percent int)) (Result, error)
+
+// Job is a snapshot of the state of a submitted Task
+type Job struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Progress   int        `json:"progress"` // percentage, 100 once the job is finished
+	Error      string     `json:"error,omitempty"`
+	MimeType   string     `json:"mime_type,omitempty"`
+	Size       int        `json:"size,omitempty"` // result size in bytes
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // the job and its result are dropped after this time
+}
+
+type job struct {
+	Job
+	task   Task
+	notify func(Job)
+	result Result
+}
+
+// Queue execute submitted tasks with a fixed number of workers
+// finished jobs are kept for the retention duration then dropped
+type Queue struct {
+	mu        sync.Mutex
+	jobs      map[string]*job
+	pending   chan *job
+	retention time.Duration
+	closed    bool
+	wg        sync.WaitGroup
+
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// NewQueue start workers goroutines executing the submitted tasks
+// at most capacity jobs may wait for a worker, finished jobs are kept for retention
+func NewQueue(workers int, capacity int, retention time.Duration) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 0 {
+		capacity = 0
+	}
+	queue := &Queue{
+		jobs:      map[string]*job{},
+		pending:   make(chan *job, capacity),
+		retention: retention,
+		now:       time.Now,
+	}
+	queue.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+// Submit enqueue task and return the queued job
+func (queue *Queue) Submit(task Task) (Job, error) {
+	return queue.SubmitNotify(task, nil)
+}
+
+// SubmitNotify enqueue task like Submit, notify is called with the final state of the job once it is finished
+// notify is called from the worker goroutine so it must not block
+func (queue *Queue) SubmitNotify(task Task, notify func(Job)) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if queue.closed {
+		return Job{}, ErrQueueClosed
+	}
+	queue.purge()
+
+	j := &job{
+		Job: Job{
+			ID:        id,
+			Status:    StatusQueued,
+			CreatedAt: queue.now(),
+		},
+		task:   task,
+		notify: notify,
+	}
+	select {
+	case queue.pending <- j:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	queue.jobs[id] = j
+	return j.Job, nil
+}
+
+// Get return the current state of the job
+func (queue *Queue) Get(id string) (Job, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	queue.purge()
+
+	j, ok := queue.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.Job, nil
+}
+
+// Result return the output of a succeeded job
+func (queue *Queue) Result(id string) (Result, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	queue.purge()
+
+	j, ok := queue.jobs[id]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+	switch j.Status {
+	case StatusSucceeded:
+		return j.result, nil
+	case StatusFailed:
+		return Result{}, ErrFailed
+	}
+	return Result{}, ErrNotFinished
+}
+
+// Close stop accepting jobs and wait for the queued ones to finish
+func (queue *Queue) Close() {
+	queue.mu.Lock()
+	if queue.closed {
+		queue.mu.Unlock()
+		return
+	}
+	queue.closed = true
+	close(queue.pending)
+	queue.mu.Unlock()
+
+	queue.wg.Wait()
+}
+
+func (queue *Queue) work() {
+	defer queue.wg.Done()
+	for j := range queue.pending {
+		queue.run(j)
+	}
+}
+
+func (queue *Queue) run(j *job) {
+	queue.mu.Lock()
+	startedAt := queue.now()
+	j.Status = StatusRunning
+	j.StartedAt = &startedAt
+	task := j.task
+	queue.mu.Unlock()
+
+	result, err := runTask(task, func(percent int) {
+		if percent < 0 {
+			percent = 0
+		} else if percent > 99 {
+			percent = 99 // 100 is reserved to finished jobs
+		}
+		queue.mu.Lock()
+		j.Progress = percent
+		queue.mu.Unlock()
+	})
+
+	queue.mu.Lock()
+	finishedAt := queue.now()
+	expiresAt := finishedAt.Add(queue.retention)
+	j.FinishedAt = &finishedAt
+	j.ExpiresAt = &expiresAt
+	j.Progress = 100
+	j.task = nil
+	if err != nil {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+	} else {
+		j.Status = StatusSucceeded
+		j.result = result
+		j.MimeType = result.MimeType
+		j.Size = len(result.Data)
+	}
+	snapshot, notify := j.Job, j.notify
+	j.notify = nil
+	queue.mu.Unlock()
+
+	if notify != nil {
+		notify(snapshot)
+	}
+}
+
+// runTask execute task, a panic is reported as an error so it doesn't kill the worker
+func runTask(task Task, progress func(percent int)) (result Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("internal error while processing")
+		}
+	}()
+	return task(progress)
+}
+
+// purge drop the expired jobs, queue.mu must be held
+func (queue *Queue) purge() {
+	now := queue.now()
+	for id, j := range queue.jobs {
+		if j.ExpiresAt != nil && !now.Before(*j.ExpiresAt) {
+			delete(queue.jobs, id)
+		}
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitFinished poll the queue until the job is finished
+func waitFinished(t *testing.T, queue *Queue, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := queue.Get(id)
+		assert.NoError(t, err)
+		if job.Status == StatusSucceeded || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return Job{}
+}
+
+func TestQueue(t *testing.T) {
+	assert := assert.New(t)
+	queue := NewQueue(2, 10, time.Hour)
+	defer queue.Close()
+
+	var tests = []struct {
+		name       string
+		task       Task
+		wantStatus Status
+		wantError  string
+		wantResult Result
+	}{
+		{
+			"succeeded",
+			func(progress func(int)) (Result, error) {
+				progress(50)
+				return Result{Data: []byte("image"), MimeType: "image/png"}, nil
+			},
+			StatusSucceeded, "", Result{Data: []byte("image"), MimeType: "image/png"},
+		},
+		{
+			"failed",
+			func(progress func(int)) (Result, error) {
+				return Result{}, errors.New("error while processing")
+			},
+			StatusFailed, "error while processing", Result{},
+		},
+		{
+			"panic",
+			func(progress func(int)) (Result, error) {
+				panic("boom")
+			},
+			StatusFailed, "internal error while processing", Result{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestQueue %s",
+			tt.name,
+		), func(t *testing.T) {
+			job, err := queue.Submit(tt.task)
+			assert.NoError(err)
+			assert.Len(job.ID, 32)
+			assert.Equal(StatusQueued, job.Status)
+
+			job = waitFinished(t, queue, job.ID)
+			assert.Equal(tt.wantStatus, job.Status)
+			assert.Equal(tt.wantError, job.Error)
+			assert.Equal(100, job.Progress)
+			assert.NotNil(job.StartedAt)
+			assert.NotNil(job.FinishedAt)
+			assert.Equal(job.FinishedAt.Add(time.Hour), *job.ExpiresAt)
+
+			result, err := queue.Result(job.ID)
+			if tt.wantStatus == StatusSucceeded {
+				assert.NoError(err)
+				assert.Equal(tt.wantResult, result)
+				assert.Equal(tt.wantResult.MimeType, job.MimeType)
+				assert.Equal(len(tt.wantResult.Data), job.Size)
+			} else {
+				assert.ErrorIs(err, ErrFailed)
+			}
+		})
+	}
+
+	_, err := queue.Get("unknown")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = queue.Result("unknown")
+	assert.ErrorIs(err, ErrNotFound)
+}
+
+func TestQueueProgress(t *testing.T) {
+	assert := assert.New(t)
+	queue := NewQueue(1, 1, time.Hour)
+	defer queue.Close()
+
+	reported, release := make(chan struct{}), make(chan struct{})
+	job, err := queue.Submit(func(progress func(int)) (Result, error) {
+		progress(150)
+		close(reported)
+		<-release
+		return Result{}, nil
+	})
+	assert.NoError(err)
+
+	<-reported
+	running, err := queue.Get(job.ID)
+	assert.NoError(err)
+	assert.Equal(StatusRunning, running.Status)
+	assert.Equal(99, running.Progress)
+
+	_, err = queue.Result(job.ID)
+	assert.ErrorIs(err, ErrNotFinished)
+
+	close(release)
+	assert.Equal(StatusSucceeded, waitFinished(t, queue, job.ID).Status)
+}
+
+func TestQueueFull(t *testing.T) {
+	assert := assert.New(t)
+	queue := NewQueue(1, 1, time.Hour)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	blocking := func(progress func(int)) (Result, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return Result{}, nil
+	}
+
+	// The first job occupy the worker, the second one the queue
+	_, err := queue.Submit(blocking)
+	assert.NoError(err)
+	<-started
+	_, err = queue.Submit(blocking)
+	assert.NoError(err)
+	_, err = queue.Submit(blocking)
+	assert.ErrorIs(err, ErrQueueFull)
+
+	close(release)
+	queue.Close()
+	_, err = queue.Submit(blocking)
+	assert.ErrorIs(err, ErrQueueClosed)
+}
+
+func TestQueueRetention(t *testing.T) {
+	assert := assert.New(t)
+	queue := NewQueue(1, 1, time.Minute)
+	defer queue.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	queue.mu.Lock()
+	queue.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	queue.mu.Unlock()
+
+	job, err := queue.Submit(func(progress func(int)) (Result, error) {
+		return Result{Data: []byte("image")}, nil
+	})
+	assert.NoError(err)
+	waitFinished(t, queue, job.ID)
+
+	mu.Lock()
+	now = now.Add(59 * time.Second)
+	mu.Unlock()
+	_, err = queue.Result(job.ID)
+	assert.NoError(err)
+
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	_, err = queue.Get(job.ID)
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = queue.Result(job.ID)
+	assert.ErrorIs(err, ErrNotFound)
+}
+
+func TestQueueNotify(t *testing.T) {
+	assert := assert.New(t)
+	queue := NewQueue(1, 2, time.Hour)
+	defer queue.Close()
+
+	var tests = []struct {
+		name       string
+		task       Task
+		wantStatus Status
+		wantError  string
+	}{
+		{
+			"succeeded",
+			func(progress func(int)) (Result, error) {
+				return Result{Data: []byte("image"), MimeType: "image/png"}, nil
+			},
+			StatusSucceeded, "",
+		},
+		{
+			"failed",
+			func(progress func(int)) (Result, error) {
+				return Result{}, errors.New("error while processing")
+			},
+			StatusFailed, "error while processing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestQueueNotify %s",
+			tt.name,
+		), func(t *testing.T) {
+			notified := make(chan Job, 1)
+			job, err := queue.SubmitNotify(tt.task, func(job Job) {
+				notified <- job
+			})
+			assert.NoError(err)
+
+			select {
+			case finished := <-notified:
+				assert.Equal(job.ID, finished.ID)
+				assert.Equal(tt.wantStatus, finished.Status)
+				assert.Equal(tt.wantError, finished.Error)
+				assert.Equal(100, finished.Progress)
+				assert.NotNil(finished.FinishedAt)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("job %s wasn't notified", job.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package presets load named operation chains from a YAML or JSON file so clients
+// can request e.g. preset=avatar instead of passing raw parameters
+package presets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rudcode/go_image_converter_api/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Preset is a named operation chain run with utils.RunPipeline
+type Preset struct {
+	Description string         `json:"description,omitempty"`
+	Operations  utils.Pipeline `json:"operations"`
+}
+
+// Presets map the preset names to their definition
+type Presets map[string]Preset
+
+var nameRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Load read the presets of the file stored at path
+// files ending in .yaml or .yml are decoded as YAML, any other file as JSON,
+// both have the same structure: a mapping of preset names to description and operations
+func Load(path string) (Presets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	}
+	return ParseJSON(data)
+}
+
+// ParseJSON decode and validate presets, unknown fields are rejected so typos don't go unnoticed
+func ParseJSON(data []byte) (Presets, error) {
+	var presets Presets
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&presets); err != nil {
+		return nil, fmt.Errorf("invalid presets: %s", err.Error())
+	}
+	if err := presets.Validate(); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+// ParseYAML decode and validate presets written in YAML
+// the document is converted to JSON so the field names are the same as in the /process operations
+func ParseYAML(data []byte) (Presets, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid presets: %s", err.Error())
+	}
+	if document == nil {
+		return Presets{}, nil
+	}
+
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid presets: %s", err.Error())
+	}
+	return ParseJSON(jsonData)
+}
+
+// Validate check the name and the operations of every preset, crop sizes are also checked
+// against utils.ResizeMaxWidth and utils.ResizeMaxHeight as they don't depend on the source image
+func (presets Presets) Validate() error {
+	for _, name := range presets.Names() {
+		if !nameRegexp.MatchString(name) {
+			return fmt.Errorf("preset %q: name must only contain lowercase letters, digits, _ and -", name)
+		}
+
+		pipeline := presets[name].Operations
+		if err := pipeline.Validate(); err != nil {
+			return fmt.Errorf("preset %s: %s", name, err.Error())
+		}
+		for i, operation := range pipeline {
+			if operation.Op != utils.OperationCrop {
+				continue
+			}
+			if operation.Width > utils.ResizeMaxWidth || operation.Height > utils.ResizeMaxHeight {
+				return fmt.Errorf(
+					"preset %s: operation %d (crop): crop size must be <= %dx%d",
+					name, i, utils.ResizeMaxWidth, utils.ResizeMaxHeight,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// Names return the sorted preset names
+func (presets Presets) Names() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,111 @@
+package presets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rudcode/go_image_converter_api/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	want := Presets{
+		"avatar": {
+			Description: "Square profile picture",
+			Operations: utils.Pipeline{
+				{Op: utils.OperationAutoOrient},
+				{Op: utils.OperationResize, Width: 256, Height: 256, Mode: utils.ResizeModeCover},
+				{Op: utils.OperationConvert, Format: "webp"},
+			},
+		},
+		"og_image": {
+			Operations: utils.Pipeline{
+				{Op: utils.OperationResize, Width: 1200, Height: 630, Mode: utils.ResizeModeCover},
+				{Op: utils.OperationCompress, CompressionLevel: 3},
+			},
+		},
+	}
+
+	var tests = []struct {
+		fileName string
+		content  string
+	}{
+		{
+			"presets.yaml",
+			"avatar:\n" +
+				"  description: Square profile picture\n" +
+				"  operations:\n" +
+				"    - op: auto_orient\n" +
+				"    - {op: resize, width: 256, height: 256, mode: cover}\n" +
+				"    - {op: convert, format: webp}\n" +
+				"og_image:\n" +
+				"  operations:\n" +
+				"    - {op: resize, width: 1200, height: 630, mode: cover}\n" +
+				"    - {op: compress, compression_level: 3}\n",
+		},
+		{
+			"presets.json",
+			`{
+				"avatar": {"description": "Square profile picture", "operations": [
+					{"op": "auto_orient"}, {"op": "resize", "width": 256, "height": 256, "mode": "cover"}, {"op": "convert", "format": "webp"}
+				]},
+				"og_image": {"operations": [{"op": "resize", "width": 1200, "height": 630, "mode": "cover"}, {"op": "compress", "compression_level": 3}]}
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestLoad %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.fileName)
+			assert.NoError(os.WriteFile(path, []byte(tt.content), 0o644))
+
+			presets, err := Load(path)
+			assert.NoError(err)
+			assert.Equal(want, presets)
+			assert.Equal([]string{"avatar", "og_image"}, presets.Names())
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(err)
+}
+
+func TestParseYAML(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"valid", "thumb:\n  operations: [{op: resize, width: 100}]\n", false},
+		{"invalid yaml", "thumb: [", true},
+		{"unknown field", "thumb:\n  operations: [{op: resize, widht: 100}]\n", true},
+		{"invalid name", "Thumb Small:\n  operations: [{op: resize, width: 100}]\n", true},
+		{"no operation", "thumb:\n  description: nothing\n", true},
+		{"width too large", "thumb:\n  operations: [{op: resize, width: 5000}]\n", true},
+		{"crop too large", "thumb:\n  operations: [{op: crop, width: 100, height: 5000}]\n", true},
+		{"unsupported format", "thumb:\n  operations: [{op: convert, format: tga}]\n", true},
+		{"unknown operation", "thumb:\n  operations: [{op: sharpen}]\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestParseYAML %s",
+			tt.name,
+		), func(t *testing.T) {
+			_, err := ParseYAML([]byte(tt.content))
+			if tt.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Local store the objects in a directory, buckets are its sub-directories
+type Local struct {
+	Root string
+}
+
+// NewLocal return a Local storage rooted at root
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+func (local *Local) Open(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	filePath, err := local.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := file.Stat(); err != nil || stat.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+	return file, nil
+}
+
+// Put write data in a temporary file renamed once complete, the bucket directory must exist
+// the location is a file URL
+func (local *Local) Put(ctx context.Context, bucket string, key string, data []byte, contentType string) (string, error) {
+	filePath, err := local.path(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if stat, err := os.Stat(filepath.Join(local.Root, bucket)); err != nil || !stat.IsDir() {
+		return "", ErrNotFound
+	}
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return "", err
+	}
+
+	absolute, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String(), nil
+}
+
+// path return the file of key in bucket, inside the root
+func (local *Local) path(bucket string, key string) (string, error) {
+	if _, _, err := ParseReference(bucket + "/" + key); err != nil {
+		return "", err
+	}
+	relative := filepath.Join(bucket, filepath.FromSlash(key))
+	if !filepath.IsLocal(relative) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(local.Root, relative), nil
+}
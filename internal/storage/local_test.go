@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	storage := NewLocal(root)
+	ctx := context.Background()
+
+	assert.NoError(os.Mkdir(filepath.Join(root, "images"), 0o755))
+	location, err := storage.Put(ctx, "images", "products/shoe.png", []byte("image"), "image/png")
+	assert.NoError(err)
+	absolute, err := filepath.Abs(filepath.Join(root, "images", "products", "shoe.png"))
+	assert.NoError(err)
+	assert.Equal("file://"+filepath.ToSlash(absolute), location)
+
+	object, err := storage.Open(ctx, "images", "products/shoe.png")
+	assert.NoError(err)
+	data, err := io.ReadAll(object)
+	assert.NoError(err)
+	assert.NoError(object.Close())
+	assert.Equal([]byte("image"), data)
+
+	// Overwrite
+	_, err = storage.Put(ctx, "images", "products/shoe.png", []byte("other image"), "image/png")
+	assert.NoError(err)
+	data, err = Read(ctx, storage, "images", "products/shoe.png", 100)
+	assert.NoError(err)
+	assert.Equal([]byte("other image"), data)
+
+	_, err = storage.Open(ctx, "images", "missing.png")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Open(ctx, "images", "products")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Open(ctx, "missing", "shoe.png")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Put(ctx, "missing", "shoe.png", []byte("image"), "image/png")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Open(ctx, "..", "shoe.png")
+	assert.Error(err)
+	_, err = storage.Put(ctx, "images", "../shoe.png", []byte("image"), "image/png")
+	assert.Error(err)
+	assert.NoFileExists(filepath.Join(root, "shoe.png"))
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3Config configure the S3 storage, Endpoint is only needed by S3 compatible services such as MinIO
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	AccessKeyID     string // the default AWS credential chain is used when empty
+	SecretAccessKey string
+	PathStyle       bool // address the buckets as http://endpoint/bucket instead of http://bucket.endpoint
+}
+
+// S3 store the objects in an S3 compatible object storage
+type S3 struct {
+	client *s3.Client
+}
+
+// NewS3 return an S3 storage configured by config
+func NewS3(config S3Config) (*S3, error) {
+	options := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(config.Region)}
+	if config.AccessKeyID != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, ""),
+		))
+	}
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsConfig, func(options *s3.Options) {
+		options.UsePathStyle = config.PathStyle
+		if config.Endpoint != "" {
+			options.BaseEndpoint = aws.String(config.Endpoint)
+		}
+		// S3 compatible services don't all support the default checksums of the uploads
+		options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		options.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	})
+	return &S3{client: client}, nil
+}
+
+func (storage *S3) Open(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	output, err := storage.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return output.Body, nil
+}
+
+// Put upload data with a single PutObject request, the location is the URL of the object
+func (storage *S3) Put(ctx context.Context, bucket string, key string, data []byte, contentType string) (string, error) {
+	var location string
+	_, err := storage.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	}, s3.WithAPIOptions(func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(recordLocation(&location), middleware.After)
+	}))
+	if err != nil {
+		return "", s3Error(err)
+	}
+	return location, nil
+}
+
+// recordLocation keep the URL of the object sent by the request in location, without its query
+func recordLocation(location *string) middleware.FinalizeMiddleware {
+	return middleware.FinalizeMiddlewareFunc("RecordLocation", func(
+		ctx context.Context, input middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if request, ok := input.Request.(*smithyhttp.Request); ok {
+			url := *request.URL
+			url.RawQuery = ""
+			*location = url.String()
+		}
+		return next.HandleFinalize(ctx, input)
+	})
+}
+
+// s3Error map the missing bucket and key errors to ErrNotFound
+func s3Error(err error) error {
+	var apiError smithy.APIError
+	var responseError *smithyhttp.ResponseError
+	switch {
+	case errors.As(err, &apiError) && (apiError.ErrorCode() == "NoSuchKey" || apiError.ErrorCode() == "NoSuchBucket"),
+		errors.As(err, &responseError) && responseError.HTTPStatusCode() == http.StatusNotFound:
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a path style S3 stand-in holding the objects of buckets in memory
+type fakeS3 struct {
+	mu           sync.Mutex
+	objects      map[string][]byte // "bucket/key"
+	contentTypes map[string]string
+	buckets      map[string]bool
+}
+
+func newFakeS3(buckets ...string) *fakeS3 {
+	fake := &fakeS3{objects: map[string][]byte{}, contentTypes: map[string]string{}, buckets: map[string]bool{}}
+	for _, bucket := range buckets {
+		fake.buckets[bucket] = true
+	}
+	return fake
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		fake.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	reference := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, _, _ := strings.Cut(reference, "/")
+	if !fake.buckets[bucket] {
+		fake.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := fake.objects[reference]
+		if !ok {
+			fake.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", fake.contentTypes[reference])
+		w.Write(data)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			fake.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		fake.objects[reference] = data
+		fake.contentTypes[reference] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	default:
+		fake.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (fake *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+}
+
+func TestS3(t *testing.T) {
+	assert := assert.New(t)
+	fake := newFakeS3("images")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	storage, err := NewS3(S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	assert.NoError(err)
+	ctx := context.Background()
+
+	location, err := storage.Put(ctx, "images", "products/shoe.png", []byte("image"), "image/png")
+	assert.NoError(err)
+	assert.Equal(server.URL+"/images/products/shoe.png", location)
+	assert.Equal([]byte("image"), fake.objects["images/products/shoe.png"])
+	assert.Equal("image/png", fake.contentTypes["images/products/shoe.png"])
+
+	data, err := Read(ctx, storage, "images", "products/shoe.png", 100)
+	assert.NoError(err)
+	assert.Equal([]byte("image"), data)
+
+	_, err = storage.Open(ctx, "images", "missing.png")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Open(ctx, "missing", "shoe.png")
+	assert.ErrorIs(err, ErrNotFound)
+	_, err = storage.Put(ctx, "missing", "shoe.png", []byte("image"), "image/png")
+	assert.ErrorIs(err, ErrNotFound)
+
+	// Wrong credentials
+	storage, err = NewS3(S3Config{Endpoint: server.URL, Region: "us-east-1", AccessKeyID: "other", SecretAccessKey: "secret", PathStyle: true})
+	assert.NoError(err)
+	_, err = storage.Open(ctx, "images", "products/shoe.png")
+	assert.Error(err)
+	assert.NotErrorIs(err, ErrNotFound)
+}
@@ -0,0 +1,66 @@
+// Package storage read source images and write processed images by bucket and key,
+// in a local directory (Local) or in an S3 compatible object storage (S3)
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Storage backends accepted by the IMAGE_STORAGE_BACKEND setting
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var (
+	// ErrNotFound is returned for missing buckets and keys
+	ErrNotFound = errors.New("object not found")
+	// ErrTooLarge is returned by Read for objects larger than the limit
+	ErrTooLarge = errors.New("object is too large")
+)
+
+// Storage hold objects identified by a bucket and a key
+type Storage interface {
+	// Open return the content of key in bucket, ErrNotFound when missing
+	Open(ctx context.Context, bucket string, key string) (io.ReadCloser, error)
+	// Put write data to key in bucket, overwriting it, and return the location of the object
+	Put(ctx context.Context, bucket string, key string, data []byte, contentType string) (string, error)
+}
+
+// ParseReference split a "bucket/key" reference, the key may contain "/" but no "." or ".." element
+func ParseReference(reference string) (string, string, error) {
+	bucket, key, ok := strings.Cut(reference, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("reference %q must be bucket/key", reference)
+	}
+	if bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `\`) {
+		return "", "", fmt.Errorf("invalid bucket %q", bucket)
+	}
+	if path.Clean(key) != key || strings.HasPrefix(key, "/") || key == ".." || strings.HasPrefix(key, "../") || strings.Contains(key, `\`) {
+		return "", "", fmt.Errorf("invalid key %q", key)
+	}
+	return bucket, key, nil
+}
+
+// Read return the content of key in bucket, ErrTooLarge when it exceeds maxBytes
+func Read(ctx context.Context, storage Storage, bucket string, key string, maxBytes int64) ([]byte, error) {
+	object, err := storage.Open(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		reference  string
+		wantBucket string
+		wantKey    string
+		wantError  bool
+	}{
+		{"images/shoe.png", "images", "shoe.png", false},
+		{"images/products/2024/shoe.png", "images", "products/2024/shoe.png", false},
+		{"images", "", "", true},
+		{"images/", "", "", true},
+		{"/shoe.png", "", "", true},
+		{"../shoe.png", "", "", true},
+		{"images/../shoe.png", "", "", true},
+		{"images/products/../../shoe.png", "", "", true},
+		{"images/./shoe.png", "", "", true},
+		{"images//shoe.png", "", "", true},
+		{`images/products\shoe.png`, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestParseReference %s",
+			tt.reference,
+		), func(t *testing.T) {
+			bucket, key, err := ParseReference(tt.reference)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.wantBucket, bucket)
+			assert.Equal(tt.wantKey, key)
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	assert := assert.New(t)
+	storage := NewLocal(t.TempDir())
+	ctx := context.Background()
+
+	assert.NoError(os.Mkdir(filepath.Join(storage.Root, "images"), 0o755))
+	_, err := storage.Put(ctx, "images", "shoe.png", []byte("image"), "image/png")
+	assert.NoError(err)
+
+	data, err := Read(ctx, storage, "images", "shoe.png", 5)
+	assert.NoError(err)
+	assert.Equal([]byte("image"), data)
+
+	_, err = Read(ctx, storage, "images", "shoe.png", 4)
+	assert.ErrorIs(err, ErrTooLarge)
+
+	_, err = Read(ctx, storage, "images", "missing.png", 5)
+	assert.ErrorIs(err, ErrNotFound)
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// AnimatedWebpEncoder is the ffmpeg encoder of animated WebP, the "webp" encoder only write still images
+const AnimatedWebpEncoder = "libwebp_anim"
+
+// Animation describe an animated GIF or WebP
+type Animation struct {
+	Frames int // number of frames
+	Loop   int // number of times the animation is played, 0 means forever
+}
+
+var (
+	gifHeaders      = [][]byte{[]byte("GIF87a"), []byte("GIF89a")}
+	netscapeAppName = []byte("NETSCAPE2.0")
+)
+
+// GetAnimation return the animation of the GIF or WebP stored in inBuf, ok is false for still images
+func GetAnimation(inBuf io.ReadSeeker) (Animation, bool, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return Animation{}, false, err
+	}
+	inBuf.Seek(0, 0)
+
+	animation, ok := FindAnimation(data)
+	return animation, ok, nil
+}
+
+// FindAnimation read the frame count and loop count of the GIF or WebP stored in data,
+// ok is false for still images and other formats
+func FindAnimation(data []byte) (Animation, bool) {
+	var animation Animation
+	if isWebp(data) {
+		animation = findWebpAnimation(data)
+	} else if len(data) >= 6 && (bytes.Equal(data[:6], gifHeaders[0]) || bytes.Equal(data[:6], gifHeaders[1])) {
+		animation = findGifAnimation(data)
+	}
+	return animation, animation.Frames > 1
+}
+
+// findGifAnimation walk the GIF blocks counting the image descriptors and reading the NETSCAPE2.0 loop count
+func findGifAnimation(data []byte) Animation {
+	// Without NETSCAPE2.0 extension the animation is played once
+	animation := Animation{Loop: 1}
+
+	// Header and logical screen descriptor, then the optional global color table
+	offset := 13
+	if len(data) < offset {
+		return Animation{}
+	}
+	if packed := data[10]; packed&0x80 != 0 {
+		offset += 3 << ((packed & 0x07) + 1)
+	}
+
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x21: // extension
+			if offset+1 >= len(data) {
+				return animation
+			}
+			label := data[offset+1]
+			offset += 2
+			first := true
+			for offset < len(data) && data[offset] != 0 {
+				size := int(data[offset])
+				block := data[offset+1 : min(offset+1+size, len(data))]
+				if label == 0xFF && first && !bytes.Equal(block, netscapeAppName) {
+					label = 0 // other application extension
+				} else if label == 0xFF && !first && len(block) == 3 && block[0] == 1 {
+					// NETSCAPE2.0 count the repetitions after the first play, 0 means forever
+					if repeat := int(binary.LittleEndian.Uint16(block[1:3])); repeat == 0 {
+						animation.Loop = 0
+					} else {
+						animation.Loop = repeat + 1
+					}
+				}
+				first = false
+				offset += 1 + size
+			}
+			offset++ // block terminator
+		case 0x2C: // image descriptor
+			if offset+10 > len(data) {
+				return animation
+			}
+			animation.Frames++
+			packed := data[offset+9]
+			offset += 10
+			if packed&0x80 != 0 {
+				offset += 3 << ((packed & 0x07) + 1)
+			}
+			offset++ // LZW minimum code size
+			for offset < len(data) && data[offset] != 0 {
+				offset += 1 + int(data[offset])
+			}
+			offset++ // block terminator
+		default: // trailer or corrupted data
+			return animation
+		}
+	}
+	return animation
+}
+
+// findWebpAnimation count the ANMF chunks and read the loop count of the ANIM chunk
+func findWebpAnimation(data []byte) Animation {
+	anim := findWebpChunk(data, "ANIM")
+	if len(anim) < 6 {
+		return Animation{}
+	}
+
+	animation := Animation{Loop: int(binary.LittleEndian.Uint16(anim[4:6]))}
+	offset := 12
+	for offset+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		if string(data[offset:offset+4]) == "ANMF" {
+			animation.Frames++
+		}
+		offset += 8 + length + length%2 // chunks are padded to even size
+	}
+	return animation
+}
+
+// setAnimationKwargs configure outKwargs, whose "vcodec" is the output codec, to write every frame of animation:
+// gif and webp get their animated encoder and muxer with the loop count and the frame timing is kept as is,
+// still formats and outputs already limited with "frames:v" only keep the first frame
+func setAnimationKwargs(outKwargs ffmpeg.KwArgs, animation Animation) {
+	if _, ok := outKwargs["frames:v"]; ok {
+		return
+	}
+
+	switch outKwargs["vcodec"] {
+	case "gif":
+		outKwargs["f"] = "gif"
+		// The gif muxer count the repetitions after the first play, 0 means forever and -1 played once
+		switch animation.Loop {
+		case 0:
+			outKwargs["loop"] = 0
+		case 1:
+			outKwargs["loop"] = -1
+		default:
+			outKwargs["loop"] = animation.Loop - 1
+		}
+		// Build the palette from every frame rather than using the fixed default one
+		filter, _ := outKwargs["vf"].(string)
+		outKwargs["vf"] = joinFilters(filter, paletteFilter)
+	case "webp":
+		outKwargs["vcodec"] = AnimatedWebpEncoder
+		outKwargs["f"] = "webp"
+		outKwargs["loop"] = animation.Loop
+	default:
+		outKwargs["frames:v"] = 1
+		return
+	}
+	// Don't duplicate or drop frames, their delays come from the source timestamps
+	outKwargs["fps_mode"] = "passthrough"
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func animatedGif(frames int, loopCount int) []byte {
+	anim := &gif.GIF{LoopCount: loopCount}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette.WebSafe))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf := bytes.NewBuffer(nil)
+	gif.EncodeAll(buf, anim)
+	return buf.Bytes()
+}
+
+func animatedWebp(frames int, loop uint16) []byte {
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:6], loop)
+
+	chunks := bytes.NewBuffer(nil)
+	writeChunk := func(fourCC string, data []byte) {
+		chunks.WriteString(fourCC)
+		binary.Write(chunks, binary.LittleEndian, uint32(len(data)))
+		chunks.Write(data)
+		if len(data)%2 == 1 {
+			chunks.WriteByte(0)
+		}
+	}
+	writeChunk("VP8X", []byte{0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	writeChunk("ANIM", anim)
+	for i := 0; i < frames; i++ {
+		writeChunk("ANMF", make([]byte, 17))
+	}
+
+	buf := bytes.NewBufferString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(chunks.Len()+4))
+	buf.WriteString("WEBP")
+	buf.Write(chunks.Bytes())
+	return buf.Bytes()
+}
+
+func TestFindAnimation(t *testing.T) {
+	assert := assert.New(t)
+
+	fixture, err := os.ReadFile("../../test/data/test_200x100_animated.gif")
+	assert.NoError(err)
+
+	var tests = []struct {
+		name          string
+		data          []byte
+		wantAnimation Animation
+		wantOk        bool
+	}{
+		{"gif fixture", fixture, Animation{Frames: 4, Loop: 0}, true},
+		{"gif forever", animatedGif(3, 0), Animation{Frames: 3, Loop: 0}, true},
+		{"gif played once", animatedGif(3, -1), Animation{Frames: 3, Loop: 1}, true},
+		{"gif repeated", animatedGif(2, 2), Animation{Frames: 2, Loop: 3}, true},
+		{"gif still", animatedGif(1, 0), Animation{Frames: 1, Loop: 1}, false},
+		{"gif truncated", fixture[:200], Animation{Frames: 1, Loop: 0}, false},
+		{"webp forever", animatedWebp(3, 0), Animation{Frames: 3, Loop: 0}, true},
+		{"webp repeated", animatedWebp(5, 2), Animation{Frames: 5, Loop: 2}, true},
+		{"webp still", webpWithChunk("VP8L", make([]byte, 5)), Animation{}, false},
+		{"png", pngWithChunk("IDAT", nil), Animation{}, false},
+		{"empty", nil, Animation{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestFindAnimation %s",
+			tt.name,
+		), func(t *testing.T) {
+			animation, ok := FindAnimation(tt.data)
+			assert.Equal(tt.wantOk, ok)
+			assert.Equal(tt.wantAnimation, animation)
+		})
+	}
+}
+
+func TestSetAnimationKwargs(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name       string
+		outKwargs  ffmpeg.KwArgs
+		animation  Animation
+		wantKwargs ffmpeg.KwArgs
+	}{
+		{
+			"gif forever",
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "gif", "vf": "scale=100:50"},
+			Animation{Frames: 4, Loop: 0},
+			ffmpeg.KwArgs{"f": "gif", "vcodec": "gif", "vf": "scale=100:50," + paletteFilter, "loop": 0, "fps_mode": "passthrough"},
+		},
+		{
+			"gif played once",
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "gif"},
+			Animation{Frames: 4, Loop: 1},
+			ffmpeg.KwArgs{"f": "gif", "vcodec": "gif", "vf": paletteFilter, "loop": -1, "fps_mode": "passthrough"},
+		},
+		{
+			"webp",
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "webp", "quality": 80},
+			Animation{Frames: 4, Loop: 3},
+			ffmpeg.KwArgs{"f": "webp", "vcodec": AnimatedWebpEncoder, "quality": 80, "loop": 3, "fps_mode": "passthrough"},
+		},
+		{
+			"still format",
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "mjpeg"},
+			Animation{Frames: 4, Loop: 0},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "mjpeg", "frames:v": 1},
+		},
+		{
+			"first frame only",
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "webp", "frames:v": "1"},
+			Animation{Frames: 4, Loop: 0},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "webp", "frames:v": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSetAnimationKwargs %s",
+			tt.name,
+		), func(t *testing.T) {
+			setAnimationKwargs(tt.outKwargs, tt.animation)
+			assert.Equal(tt.wantKwargs, tt.outKwargs)
+		})
+	}
+}
+
+func TestAnimatedImage(t *testing.T) {
+	assert := assert.New(t)
+
+	fileName := "../../test/data/test_200x100_animated.gif"
+	var tests = []struct {
+		name       string
+		run        func(inBuf *os.File, outBuf *bytes.Buffer) error
+		wantFormat string
+		wantWidth  uint16
+		wantHeight uint16
+		wantFrames int
+	}{
+		{"resize", func(inBuf *os.File, outBuf *bytes.Buffer) error {
+			return ResizeImage(inBuf, "gif", 100, 50, outBuf)
+		}, "gif", 100, 50, 4},
+		{"crop", func(inBuf *os.File, outBuf *bytes.Buffer) error {
+			return CropImage(inBuf, "gif", CropOptions{X: 50, Y: 0, Width: 100, Height: 100}, outBuf)
+		}, "gif", 100, 100, 4},
+		{"convert to webp", func(inBuf *os.File, outBuf *bytes.Buffer) error {
+			return ConvertImage(inBuf, "webp", outBuf)
+		}, "webp", 200, 100, 4},
+		{"convert to png", func(inBuf *os.File, outBuf *bytes.Buffer) error {
+			return ConvertImage(inBuf, "png", outBuf)
+		}, "png", 200, 100, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestAnimatedImage %s",
+			tt.name,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			assert.NoError(tt.run(inBuf, outBuf))
+
+			animation, _ := FindAnimation(outBuf.Bytes())
+			if tt.wantFrames > 1 {
+				assert.Equal(Animation{Frames: tt.wantFrames, Loop: 0}, animation)
+			}
+			AssertImageFormatEqual(t, bytes.NewReader(outBuf.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(outBuf.Bytes()), tt.wantWidth, tt.wantHeight)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+)
+
+// Gravities accepted by CropOptions.Gravity
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "north-east"
+	GravityNorthWest = "north-west"
+	GravitySouthEast = "south-east"
+	GravitySouthWest = "south-west"
+)
+
+var Gravities = [...]string{
+	GravityCenter,
+	GravityNorth,
+	GravitySouth,
+	GravityEast,
+	GravityWest,
+	GravityNorthEast,
+	GravityNorthWest,
+	GravitySouthEast,
+	GravitySouthWest,
+}
+
+// CropOptions describe the area kept by CropImage
+// when Gravity is empty the area is the rectangle starting at X, Y
+// otherwise X and Y are ignored and the Width x Height area is anchored to Gravity
+type CropOptions struct {
+	X       uint16
+	Y       uint16
+	Width   uint16
+	Height  uint16
+	Gravity string
+}
+
+// CropRectangle resolve options against an image of srcWidth x srcHeight
+// and return the x, y offset of the cropped area
+func CropRectangle(srcWidth uint16, srcHeight uint16, options CropOptions) (uint16, uint16, error) {
+	if options.Width < 1 || options.Height < 1 {
+		return 0, 0, fmt.Errorf("crop width and height must be positive")
+	}
+
+	if options.Width > srcWidth || options.Height > srcHeight {
+		return 0, 0, fmt.Errorf(
+			"crop size %dx%d exceeds image size %dx%d",
+			options.Width, options.Height, srcWidth, srcHeight,
+		)
+	}
+
+	if options.Gravity == "" {
+		if uint32(options.X)+uint32(options.Width) > uint32(srcWidth) ||
+			uint32(options.Y)+uint32(options.Height) > uint32(srcHeight) {
+			return 0, 0, fmt.Errorf(
+				"crop rectangle %dx%d+%d+%d exceeds image size %dx%d",
+				options.Width, options.Height, options.X, options.Y, srcWidth, srcHeight,
+			)
+		}
+		return options.X, options.Y, nil
+	}
+
+	// Offsets for the gravity anchor
+	left := uint16(0)
+	center := (srcWidth - options.Width) / 2
+	right := srcWidth - options.Width
+	top := uint16(0)
+	middle := (srcHeight - options.Height) / 2
+	bottom := srcHeight - options.Height
+
+	switch options.Gravity {
+	case GravityCenter:
+		return center, middle, nil
+	case GravityNorth:
+		return center, top, nil
+	case GravitySouth:
+		return center, bottom, nil
+	case GravityEast:
+		return right, middle, nil
+	case GravityWest:
+		return left, middle, nil
+	case GravityNorthEast:
+		return right, top, nil
+	case GravityNorthWest:
+		return left, top, nil
+	case GravitySouthEast:
+		return right, bottom, nil
+	case GravitySouthWest:
+		return left, bottom, nil
+	}
+	return 0, 0, fmt.Errorf("gravity %s is not supported", options.Gravity)
+}
+
+// CropFilter build the ffmpeg filter cropping an image of srcWidth x srcHeight according to options
+func CropFilter(srcWidth uint16, srcHeight uint16, options CropOptions) (string, error) {
+	x, y, err := CropRectangle(srcWidth, srcHeight, options)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("crop=%d:%d:%d:%d", options.Width, options.Height, x, y), nil
+}
+
+// CropImage function crop the image stored in inBuf and write the output to outBuf
+// format is one of the following ("mjpeg", "png", "webp", "bmp", "av1", "gif", "tiff")
+// the EXIF orientation is applied first and the cropped area must be within the oriented image
+func CropImage(inBuf io.ReadSeeker, format string, options CropOptions, outBuf io.Writer) error {
+	// Check format
+	if !isResizeFormat(format) {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+
+	// Get source size
+	srcWidth, srcHeight, err := GetImageSize(inBuf)
+	if err != nil {
+		return fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	orientFilter, swap, err := autoOrientFilter(inBuf)
+	if err != nil {
+		return err
+	}
+	if swap {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
+
+	filter, err := CropFilter(srcWidth, srcHeight, options)
+	if err != nil {
+		return err
+	}
+
+	// Crop
+	return runImageFilter(inBuf, format, joinFilters(orientFilter, filter), outBuf)
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCropFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		srcWidth   uint16
+		srcHeight  uint16
+		options    CropOptions
+		wantFilter string
+		wantError  bool
+	}{
+		{1000, 625, CropOptions{X: 10, Y: 20, Width: 100, Height: 200}, "crop=100:200:10:20", false},
+		{1000, 625, CropOptions{X: 900, Y: 425, Width: 100, Height: 200}, "crop=100:200:900:425", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityCenter}, "crop=100:200:450:212", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityNorth}, "crop=100:200:450:0", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravitySouth}, "crop=100:200:450:425", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityEast}, "crop=100:200:900:212", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityWest}, "crop=100:200:0:212", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityNorthEast}, "crop=100:200:900:0", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravityNorthWest}, "crop=100:200:0:0", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravitySouthEast}, "crop=100:200:900:425", false},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: GravitySouthWest}, "crop=100:200:0:425", false},
+		{1000, 625, CropOptions{X: 10, Y: 20, Width: 100, Height: 200, Gravity: GravityNorthWest}, "crop=100:200:0:0", false},
+		{1000, 625, CropOptions{X: 901, Y: 0, Width: 100, Height: 200}, "", true},
+		{1000, 625, CropOptions{X: 0, Y: 426, Width: 100, Height: 200}, "", true},
+		{1000, 625, CropOptions{Width: 1001, Height: 200, Gravity: GravityCenter}, "", true},
+		{1000, 625, CropOptions{Width: 0, Height: 200}, "", true},
+		{1000, 625, CropOptions{Width: 100, Height: 200, Gravity: "middle"}, "", true},
+		{1000, 625, CropOptions{X: 65535, Y: 0, Width: 100, Height: 200}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCropFilter %+v",
+			tt.options,
+		), func(t *testing.T) {
+			filter, err := CropFilter(tt.srcWidth, tt.srcHeight, tt.options)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.wantFilter, filter)
+		})
+	}
+}
+
+func TestCropImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName  string
+		format    string
+		options   CropOptions
+		wantError bool
+	}{
+		{"../../test/data/test_1000x1000.bmp", "bmp", CropOptions{X: 100, Y: 100, Width: 300, Height: 200}, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", CropOptions{Width: 300, Height: 200, Gravity: GravitySouthEast}, false},
+		{"../../test/data/test_1000x625.png", "png", CropOptions{Width: 625, Height: 625, Gravity: GravityCenter}, false},
+		{"../../test/data/test_1000x1000.webp", "webp", CropOptions{X: 0, Y: 0, Width: 1000, Height: 1000}, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", CropOptions{X: 0, Y: 500, Width: 600, Height: 400}, false},
+		{"../../test/data/test_1000x625.png", "png", CropOptions{Width: 1000, Height: 1000, Gravity: GravityCenter}, true},
+		{"../../test/data/test_1000x1000.png", "png", CropOptions{X: 500, Y: 500, Width: 600, Height: 100}, true},
+		{"../../test/data/test_1000x1000.png", "gif", CropOptions{Width: 100, Height: 100, Gravity: GravityCenter}, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCropImage %s %+v",
+			tt.fileName, tt.options,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = CropImage(inBuf, tt.format, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				outBufReader := bytes.NewReader(outBuf.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.options.Width, tt.options.Height)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.format)
+			}
+		})
+	}
+}
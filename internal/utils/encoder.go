@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// ChromaSubsamplings maps the JPEG chroma subsamplings accepted by EncoderOptions to the ffmpeg pixel format
+var ChromaSubsamplings = map[string]string{
+	"444": "yuvj444p",
+	"422": "yuvj422p",
+	"420": "yuvj420p",
+}
+
+// paletteFilter reduce the image to a 256 colours palette computed from the image itself
+const paletteFilter = "split[p0][p1];[p0]palettegen[p];[p1][p]paletteuse"
+
+// EncoderOptions are the optional settings of the jpeg ("mjpeg"), png, webp, avif ("av1") and tiff encoders,
+// a nil or false field keep the encoder default
+type EncoderOptions struct {
+	// Quality is the jpeg, webp or avif quality from 1 (worst) to 100 (best)
+	Quality *int `json:"quality,omitempty"`
+	// Progressive request a progressive jpeg, the ffmpeg mjpeg encoder only produce baseline jpeg so it is rejected
+	Progressive bool `json:"progressive,omitempty"`
+	// ChromaSubsampling is the jpeg chroma subsampling ("444", "422" or "420")
+	ChromaSubsampling string `json:"chroma_subsampling,omitempty"`
+	// PngCompressionLevel is the png zlib level from 0 (fastest) to 9 (smallest)
+	PngCompressionLevel *int `json:"png_compression_level,omitempty"`
+	// Palette reduce the png to a 256 colours palette
+	Palette bool `json:"palette,omitempty"`
+	// Lossless encode the webp losslessly, Quality is then the compression effort
+	Lossless bool `json:"lossless,omitempty"`
+	// Method is the webp compression method from 0 (fastest) to 6 (smallest)
+	Method *int `json:"method,omitempty"`
+	// NearLossless is the webp near lossless level, the ffmpeg libwebp encoder doesn't expose it so it is rejected
+	NearLossless *int `json:"near_lossless,omitempty"`
+	// TiffCompression is the tiff compression ("none", "lzw" or "deflate"), ffmpeg default to packbits
+	TiffCompression string `json:"tiff_compression,omitempty"`
+}
+
+// IsZero report whether no option is set
+func (options EncoderOptions) IsZero() bool {
+	return options == EncoderOptions{}
+}
+
+// Validate check the option values, independently of the output format
+func (options EncoderOptions) Validate() error {
+	if options.Quality != nil && (*options.Quality < 1 || *options.Quality > 100) {
+		return fmt.Errorf("quality must between 1 <= quality <= 100")
+	}
+	if options.Progressive {
+		return fmt.Errorf("progressive jpeg is not supported by the mjpeg encoder, only baseline jpeg can be produced")
+	}
+	if _, ok := ChromaSubsamplings[options.ChromaSubsampling]; options.ChromaSubsampling != "" && !ok {
+		return fmt.Errorf("chroma subsampling %s is not supported, use 444, 422 or 420", options.ChromaSubsampling)
+	}
+	if options.PngCompressionLevel != nil && (*options.PngCompressionLevel < 0 || *options.PngCompressionLevel > 9) {
+		return fmt.Errorf("png compression level must between 0 <= level <= 9")
+	}
+	if options.Method != nil && (*options.Method < 0 || *options.Method > 6) {
+		return fmt.Errorf("webp method must between 0 <= method <= 6")
+	}
+	if options.NearLossless != nil {
+		return fmt.Errorf("near lossless webp is not supported by the libwebp encoder of ffmpeg")
+	}
+	if _, ok := TiffCompressions[options.TiffCompression]; options.TiffCompression != "" && !ok {
+		return fmt.Errorf("tiff compression %s is not supported, use none, lzw or deflate", options.TiffCompression)
+	}
+	return nil
+}
+
+// Apply validate the options against format (ffmpeg codec) and add the matching encoder arguments to outKwargs
+// the palette filter is appended to the "vf" filter of outKwargs
+func (options EncoderOptions) Apply(outKwargs ffmpeg.KwArgs, format string) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	// Reject the options of other formats rather than silently ignoring them
+	jpeg, png, webp, avif, tiff := format == "mjpeg", format == "png", format == "webp", format == "av1", format == "tiff"
+	for _, option := range []struct {
+		name string
+		set  bool
+		ok   bool
+	}{
+		{"quality", options.Quality != nil, jpeg || webp || avif},
+		{"chroma_subsampling", options.ChromaSubsampling != "", jpeg},
+		{"png_compression_level", options.PngCompressionLevel != nil, png},
+		{"palette", options.Palette, png},
+		{"lossless", options.Lossless, webp},
+		{"method", options.Method != nil, webp},
+		{"tiff_compression", options.TiffCompression != "", tiff},
+	} {
+		if option.set && !option.ok {
+			return fmt.Errorf("%s is not supported for format %s", option.name, format)
+		}
+	}
+
+	if options.Quality != nil {
+		switch {
+		case jpeg:
+			outKwargs["q"] = jpegQScale(*options.Quality)
+		case avif:
+			outKwargs["crf"] = avifCrf(*options.Quality)
+		default:
+			outKwargs["quality"] = *options.Quality
+		}
+	}
+	if options.ChromaSubsampling != "" {
+		outKwargs["pix_fmt"] = ChromaSubsamplings[options.ChromaSubsampling]
+	}
+	if options.PngCompressionLevel != nil {
+		outKwargs["compression_level"] = *options.PngCompressionLevel
+	}
+	if options.Palette {
+		filter, _ := outKwargs["vf"].(string)
+		outKwargs["vf"] = joinFilters(filter, paletteFilter)
+	}
+	if options.Lossless {
+		outKwargs["lossless"] = 1
+	}
+	if options.Method != nil {
+		// The libwebp method is exposed as compression_level
+		outKwargs["compression_level"] = *options.Method
+	}
+	if options.TiffCompression != "" {
+		outKwargs["compression_algo"] = TiffCompressions[options.TiffCompression]
+	}
+	return nil
+}
+
+// jpegQScale map a quality from 1 (worst) to 100 (best) to the mjpeg qscale from 31 (worst) to 1 (best)
+func jpegQScale(quality int) float64 {
+	return math.Round(Mapfloat64(float64(quality), 1, 100, 31, 1))
+}
+
+// avifCrf map a quality from 1 (worst) to 100 (best) to the libaom crf from 63 (worst) to 0 (best)
+func avifCrf(quality int) float64 {
+	return math.Round(Mapfloat64(float64(quality), 1, 100, 63, 0))
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func TestEncoderOptionsApply(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name          string
+		format        string
+		options       EncoderOptions
+		wantOutKwargs ffmpeg.KwArgs
+		wantError     bool
+	}{
+		{"none", "mjpeg", EncoderOptions{}, ffmpeg.KwArgs{}, false},
+		{"jpeg quality best", "mjpeg", EncoderOptions{Quality: intPointer(100)}, ffmpeg.KwArgs{"q": float64(1)}, false},
+		{"jpeg quality worst", "mjpeg", EncoderOptions{Quality: intPointer(1)}, ffmpeg.KwArgs{"q": float64(31)}, false},
+		{"jpeg chroma", "mjpeg", EncoderOptions{ChromaSubsampling: "420"}, ffmpeg.KwArgs{"pix_fmt": "yuvj420p"}, false},
+		{"jpeg progressive", "mjpeg", EncoderOptions{Progressive: true}, nil, true},
+		{"jpeg invalid chroma", "mjpeg", EncoderOptions{ChromaSubsampling: "411"}, nil, true},
+		{"jpeg lossless", "mjpeg", EncoderOptions{Lossless: true}, nil, true},
+		{"png level", "png", EncoderOptions{PngCompressionLevel: intPointer(0)}, ffmpeg.KwArgs{"compression_level": 0}, false},
+		{"png palette", "png", EncoderOptions{Palette: true}, ffmpeg.KwArgs{"vf": "scale=10:10,split[p0][p1];[p0]palettegen[p];[p1][p]paletteuse"}, false},
+		{"png invalid level", "png", EncoderOptions{PngCompressionLevel: intPointer(10)}, nil, true},
+		{"png quality", "png", EncoderOptions{Quality: intPointer(80)}, nil, true},
+		{"webp lossy", "webp", EncoderOptions{Quality: intPointer(75), Method: intPointer(6)}, ffmpeg.KwArgs{"quality": 75, "compression_level": 6}, false},
+		{"webp lossless", "webp", EncoderOptions{Lossless: true}, ffmpeg.KwArgs{"lossless": 1}, false},
+		{"webp near lossless", "webp", EncoderOptions{NearLossless: intPointer(60)}, nil, true},
+		{"webp invalid quality", "webp", EncoderOptions{Quality: intPointer(0)}, nil, true},
+		{"webp invalid method", "webp", EncoderOptions{Method: intPointer(7)}, nil, true},
+		{"webp palette", "webp", EncoderOptions{Palette: true}, nil, true},
+		{"avif quality", "av1", EncoderOptions{Quality: intPointer(100)}, ffmpeg.KwArgs{"crf": float64(0)}, false},
+		{"avif lossless", "av1", EncoderOptions{Lossless: true}, nil, true},
+		{"bmp quality", "bmp", EncoderOptions{Quality: intPointer(80)}, nil, true},
+		{"tiff lzw", "tiff", EncoderOptions{TiffCompression: "lzw"}, ffmpeg.KwArgs{"compression_algo": "lzw"}, false},
+		{"tiff none", "tiff", EncoderOptions{TiffCompression: "none"}, ffmpeg.KwArgs{"compression_algo": "raw"}, false},
+		{"tiff invalid compression", "tiff", EncoderOptions{TiffCompression: "jpeg"}, nil, true},
+		{"tiff quality", "tiff", EncoderOptions{Quality: intPointer(80)}, nil, true},
+		{"png tiff compression", "png", EncoderOptions{TiffCompression: "deflate"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestEncoderOptionsApply %s",
+			tt.name,
+		), func(t *testing.T) {
+			outKwargs := ffmpeg.KwArgs{}
+			if tt.options.Palette {
+				outKwargs["vf"] = "scale=10:10"
+			}
+			err := tt.options.Apply(outKwargs, tt.format)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal(tt.wantOutKwargs, outKwargs)
+			}
+		})
+	}
+}
+
+func TestConvertImageWithOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName     string
+		targetFormat string
+		options      EncoderOptions
+		wantFormat   string
+		wantError    bool
+	}{
+		{"../../test/data/test_1000x1000.png", "jpeg", EncoderOptions{Quality: intPointer(90), ChromaSubsampling: "444"}, "mjpeg", false},
+		{"../../test/data/test_1000x1000.jpg", "png", EncoderOptions{Palette: true, PngCompressionLevel: intPointer(9)}, "png", false},
+		{"../../test/data/test_1000x1000.jpg", "webp", EncoderOptions{Lossless: true, Method: intPointer(0)}, "webp", false},
+		{"../../test/data/test_1000x1000.jpg", "jpeg", EncoderOptions{Progressive: true}, "", true},
+		{"../../test/data/test_1000x1000.jpg", "webp", EncoderOptions{NearLossless: intPointer(60)}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestConvertImageWithOptions %s %s %+v",
+			tt.fileName, tt.targetFormat, tt.options,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = ConvertImageWithOptions(inBuf, tt.targetFormat, tt.options, outBuf)
+			if tt.wantError {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			AssertImageFormatEqual(t, bytes.NewReader(outBuf.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(outBuf.Bytes()), 1000, 1000)
+		})
+	}
+}
+
+func TestEncoderKwargs(t *testing.T) {
+	assert := assert.New(t)
+
+	outKwargs := ffmpeg.KwArgs{"f": "image2", "vcodec": "av1", "crf": float64(30)}
+	assert.Equal(
+		ffmpeg.KwArgs{"f": "avif", "vcodec": AvifEncoder, "crf": float64(30), "cpu-used": AvifDefaultSpeed},
+		encoderKwargs(outKwargs),
+	)
+	assert.Equal("av1", outKwargs["vcodec"], "the kwargs of the caller must not be modified")
+
+	outKwargs = ffmpeg.KwArgs{"f": "image2", "vcodec": "av1", "cpu-used": float64(8)}
+	assert.Equal(ffmpeg.KwArgs{"f": "avif", "vcodec": AvifEncoder, "cpu-used": float64(8)}, encoderKwargs(outKwargs))
+
+	outKwargs = ffmpeg.KwArgs{"f": "image2", "vcodec": "webp"}
+	assert.Equal(outKwargs, encoderKwargs(outKwargs))
+
+	assert.Equal("image/avif", GetMimeType("av1"))
+	assert.Equal("avif", GetExtension("av1"))
+}
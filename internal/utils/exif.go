@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const exifOrientationTag = 0x0112
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+	// keyword of the PNG iTXt chunk holding XMP
+	xmpPngKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+// ImageMetadata report which metadata blocks are embedded in an image
+type ImageMetadata struct {
+	HasExif bool
+	HasXmp  bool
+	HasIcc  bool
+}
+
+// GetExifOrientation return the EXIF Orientation tag (1-8) of the JPEG, PNG, WebP or TIFF image stored in inBuf
+// 1 is returned when the image has no EXIF data or no orientation tag
+func GetExifOrientation(inBuf io.ReadSeeker) (uint16, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return 0, err
+	}
+	inBuf.Seek(0, 0)
+
+	orientation := readExifOrientation(findExif(data))
+	if orientation < 1 || orientation > 8 {
+		return 1, nil
+	}
+	return orientation, nil
+}
+
+// FindImageMetadata report the EXIF, XMP and ICC profile blocks embedded in a JPEG, PNG or WebP file
+// other formats report no metadata
+func FindImageMetadata(data []byte) ImageMetadata {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return ImageMetadata{
+			HasExif: findJpegSegment(data, 0xe1, exifHeader) != nil,
+			HasXmp:  findJpegSegment(data, 0xe1, xmpHeader) != nil,
+			HasIcc:  findJpegSegment(data, 0xe2, iccHeader) != nil,
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ImageMetadata{
+			HasExif: findPngChunk(data, "eXIf", nil) != nil,
+			HasXmp:  findPngChunk(data, "iTXt", xmpPngKeyword) != nil,
+			HasIcc:  findPngChunk(data, "iCCP", nil) != nil,
+		}
+	case isWebp(data):
+		return ImageMetadata{
+			HasExif: findWebpChunk(data, "EXIF") != nil,
+			HasXmp:  findWebpChunk(data, "XMP ") != nil,
+			HasIcc:  findWebpChunk(data, "ICCP") != nil,
+		}
+	}
+	return ImageMetadata{}
+}
+
+// findExif return the TIFF structured EXIF payload embedded in a JPEG, PNG or WebP file,
+// TIFF files are their own payload
+func findExif(data []byte) []byte {
+	switch {
+	case isTiff(data):
+		return data
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return findJpegSegment(data, 0xe1, exifHeader)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return findPngChunk(data, "eXIf", nil)
+	case isWebp(data):
+		// Some encoders keep the JPEG APP1 header inside the chunk
+		return bytes.TrimPrefix(findWebpChunk(data, "EXIF"), exifHeader)
+	}
+	return nil
+}
+
+// findJpegSegment return the payload (without prefix) of the first marker segment starting with prefix
+func findJpegSegment(data []byte, marker byte, prefix []byte) []byte {
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xff {
+			return nil
+		}
+		segmentMarker := data[offset+1]
+		// Standalone markers without length
+		if segmentMarker == 0xff {
+			offset++
+			continue
+		}
+		if segmentMarker == 0x01 || (segmentMarker >= 0xd0 && segmentMarker <= 0xd7) {
+			offset += 2
+			continue
+		}
+		// Start of scan or end of image, no more metadata
+		if segmentMarker == 0xda || segmentMarker == 0xd9 {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		end := offset + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		payload := data[offset+4 : end]
+		if segmentMarker == marker && bytes.HasPrefix(payload, prefix) {
+			return payload[len(prefix):]
+		}
+		offset = end
+	}
+	return nil
+}
+
+func isWebp(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// findPngChunk return the data of the first chunk with chunkType whose data start with prefix
+func findPngChunk(data []byte, chunkType string, prefix []byte) []byte {
+	offset := 8
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		currentType := string(data[offset+4 : offset+8])
+		end := offset + 8 + length
+		if length < 0 || end+4 > len(data) {
+			return nil
+		}
+		if currentType == chunkType && bytes.HasPrefix(data[offset+8:end], prefix) {
+			return data[offset+8 : end]
+		}
+		if currentType == "IEND" {
+			return nil
+		}
+		offset = end + 4 // skip CRC
+	}
+	return nil
+}
+
+// findWebpChunk return the data of the first RIFF chunk with fourCC
+func findWebpChunk(data []byte, fourCC string) []byte {
+	offset := 12
+	for offset+8 <= len(data) {
+		currentFourCC := string(data[offset : offset+4])
+		length := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		end := offset + 8 + length
+		if length < 0 || end > len(data) {
+			return nil
+		}
+		if currentFourCC == fourCC {
+			return data[offset+8 : end]
+		}
+		offset = end + length%2 // chunks are padded to even size
+	}
+	return nil
+}
+
+// readExifOrientation read the Orientation tag from IFD0 of a TIFF structured EXIF payload
+// 0 is returned when it can't be found
+func readExifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return 0
+	}
+	if byteOrder.Uint16(tiff[2:4]) != 42 {
+		return 0
+	}
+
+	ifdOffset := int(byteOrder.Uint32(tiff[4:8]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(byteOrder.Uint16(tiff[ifdOffset : ifdOffset+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if byteOrder.Uint16(tiff[entry:entry+2]) == exifOrientationTag {
+			return byteOrder.Uint16(tiff[entry+8 : entry+10])
+		}
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifPayload build a TIFF structured EXIF payload holding only the orientation tag
+func exifPayload(byteOrder binary.ByteOrder, orientation uint16) []byte {
+	buf := bytes.NewBuffer(nil)
+	if byteOrder == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, byteOrder, uint16(42))
+	binary.Write(buf, byteOrder, uint32(8))
+	binary.Write(buf, byteOrder, uint16(1))
+	binary.Write(buf, byteOrder, uint16(exifOrientationTag))
+	binary.Write(buf, byteOrder, uint16(3))
+	binary.Write(buf, byteOrder, uint32(1))
+	binary.Write(buf, byteOrder, orientation)
+	binary.Write(buf, byteOrder, uint16(0))
+	binary.Write(buf, byteOrder, uint32(0))
+	return buf.Bytes()
+}
+
+func pngWithChunk(chunkType string, data []byte) []byte {
+	buf := bytes.NewBufferString("\x89PNG\r\n\x1a\n")
+	for _, chunk := range []struct {
+		chunkType string
+		data      []byte
+	}{
+		{"IHDR", make([]byte, 13)},
+		{chunkType, data},
+		{"IEND", nil},
+	} {
+		binary.Write(buf, binary.BigEndian, uint32(len(chunk.data)))
+		buf.WriteString(chunk.chunkType)
+		buf.Write(chunk.data)
+		binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(chunk.chunkType), chunk.data...)))
+	}
+	return buf.Bytes()
+}
+
+func webpWithChunk(fourCC string, data []byte) []byte {
+	chunks := bytes.NewBuffer(nil)
+	for _, chunk := range []struct {
+		fourCC string
+		data   []byte
+	}{
+		{"VP8X", make([]byte, 10)},
+		{"ICCP", []byte{1, 2, 3}},
+		{fourCC, data},
+	} {
+		chunks.WriteString(chunk.fourCC)
+		binary.Write(chunks, binary.LittleEndian, uint32(len(chunk.data)))
+		chunks.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			chunks.WriteByte(0)
+		}
+	}
+	buf := bytes.NewBufferString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(chunks.Len()+4))
+	buf.WriteString("WEBP")
+	buf.Write(chunks.Bytes())
+	return buf.Bytes()
+}
+
+func TestGetExifOrientationFile(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName        string
+		wantOrientation uint16
+	}{
+		{"../../test/data/test_1000x625_orientation_6.jpg", 6},
+		{"../../test/data/test_1000x1000.jpg", 1},
+		{"../../test/data/test_1000x1000.png", 1},
+		{"../../test/data/test_1000x1000.webp", 1},
+		{"../../test/data/test_1000x1000.bmp", 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGetExifOrientationFile %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			orientation, err := GetExifOrientation(inBuf)
+			assert.NoError(err)
+			assert.Equal(tt.wantOrientation, orientation)
+
+			// inBuf must be rewound for the next reader
+			offset, _ := inBuf.Seek(0, 1)
+			assert.Equal(int64(0), offset)
+		})
+	}
+}
+
+func TestGetExifOrientation(t *testing.T) {
+	assert := assert.New(t)
+
+	jpegSegment := func(payload []byte) []byte {
+		data := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00, 0xff, 0xe1}
+		data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+		data = append(data, payload...)
+		return append(data, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9)
+	}
+
+	var tests = []struct {
+		name            string
+		data            []byte
+		wantOrientation uint16
+	}{
+		{"jpeg little endian", jpegSegment(append(append([]byte{}, exifHeader...), exifPayload(binary.LittleEndian, 6)...)), 6},
+		{"jpeg big endian", jpegSegment(append(append([]byte{}, exifHeader...), exifPayload(binary.BigEndian, 8)...)), 8},
+		{"jpeg xmp only", jpegSegment([]byte("http://ns.adobe.com/xap/1.0/\x00<x/>")), 1},
+		{"png", pngWithChunk("eXIf", exifPayload(binary.BigEndian, 3)), 3},
+		{"png without exif", pngWithChunk("tEXt", []byte("a\x00b")), 1},
+		{"webp", webpWithChunk("EXIF", exifPayload(binary.LittleEndian, 5)), 5},
+		{"webp with exif header", webpWithChunk("EXIF", append(append([]byte{}, exifHeader...), exifPayload(binary.LittleEndian, 7)...)), 7},
+		{"invalid orientation", pngWithChunk("eXIf", exifPayload(binary.BigEndian, 9)), 1},
+		{"truncated", jpegSegment(append(append([]byte{}, exifHeader...), exifPayload(binary.LittleEndian, 6)...))[:20], 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGetExifOrientation %s",
+			tt.name,
+		), func(t *testing.T) {
+			orientation, err := GetExifOrientation(bytes.NewReader(tt.data))
+			assert.NoError(err)
+			assert.Equal(tt.wantOrientation, orientation)
+		})
+	}
+}
+
+func TestFindImageMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	jpegSegments := func(segments ...[]byte) []byte {
+		data := []byte{0xff, 0xd8}
+		for _, segment := range segments {
+			data = append(data, segment[0], segment[1])
+			data = binary.BigEndian.AppendUint16(data, uint16(len(segment)))
+			data = append(data, segment[2:]...)
+		}
+		return append(data, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9)
+	}
+	segment := func(marker byte, header []byte, payload string) []byte {
+		return append(append([]byte{0xff, marker}, header...), payload...)
+	}
+
+	var tests = []struct {
+		name string
+		data []byte
+		want ImageMetadata
+	}{
+		{"jpeg exif", jpegSegments(segment(0xe1, exifHeader, "MM")), ImageMetadata{HasExif: true}},
+		{"jpeg exif xmp icc", jpegSegments(
+			segment(0xe1, exifHeader, "MM"),
+			segment(0xe1, xmpHeader, "<x/>"),
+			segment(0xe2, iccHeader, "\x01\x01"),
+		), ImageMetadata{HasExif: true, HasXmp: true, HasIcc: true}},
+		{"jpeg none", jpegSegments(segment(0xe0, []byte("JFIF\x00"), "")), ImageMetadata{}},
+		{"png exif", pngWithChunk("eXIf", exifPayload(binary.BigEndian, 1)), ImageMetadata{HasExif: true}},
+		{"png xmp", pngWithChunk("iTXt", append(append([]byte{}, xmpPngKeyword...), "<x/>"...)), ImageMetadata{HasXmp: true}},
+		{"png other itxt", pngWithChunk("iTXt", []byte("Comment\x00abc")), ImageMetadata{}},
+		{"png icc", pngWithChunk("iCCP", []byte("icc\x00\x00")), ImageMetadata{HasIcc: true}},
+		// webpWithChunk always add an ICCP chunk
+		{"webp exif", webpWithChunk("EXIF", exifPayload(binary.LittleEndian, 1)), ImageMetadata{HasExif: true, HasIcc: true}},
+		{"webp xmp", webpWithChunk("XMP ", []byte("<x/>")), ImageMetadata{HasXmp: true, HasIcc: true}},
+		{"bmp", []byte("BM\x00\x00"), ImageMetadata{}},
+		{"empty", nil, ImageMetadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestFindImageMetadata %s",
+			tt.name,
+		), func(t *testing.T) {
+			assert.Equal(tt.want, FindImageMetadata(tt.data))
+		})
+	}
+}
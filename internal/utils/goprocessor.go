@@ -0,0 +1,718 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// GoEncodeFormats are the formats (ffmpeg codec names) encoded by GoProcessor,
+// it decode webp too but golang.org/x/image has no webp encoder
+var GoEncodeFormats = [...]string{
+	"mjpeg",
+	"png",
+	"gif",
+	"bmp",
+}
+
+// GoMaxPixels is the largest image (width × height) decoded by GoProcessor, decoding allocate the whole image
+// so larger images are refused with ErrImageTooLarge before being decoded
+const GoMaxPixels = 8192 * 8192
+
+// goBackgrounds are the colour names accepted by the pad mode of GoProcessor, hex colours are accepted too
+var goBackgrounds = map[string]color.Color{
+	"black":       color.Black,
+	"white":       color.White,
+	"transparent": color.Transparent,
+}
+
+// GoProcessor process the images with the Go standard library and golang.org/x/image
+// animations are reduced to their first frame
+type GoProcessor struct{}
+
+func (GoProcessor) Name() string {
+	return BackendGo
+}
+
+// Probe return the format and size of the image stored in inBuf, the pixel format is derived from the Go colour model
+func (GoProcessor) Probe(inBuf io.ReadSeeker) (ProbeResult, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	inBuf.Seek(0, 0)
+
+	config, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("can't decode image: %s", err.Error())
+	}
+
+	result := ProbeResult{
+		Format:      goCodec(name),
+		Container:   name,
+		Width:       config.Width,
+		Height:      config.Height,
+		PixelFormat: goPixelFormat(config.ColorModel),
+		FrameCount:  1,
+		Streams:     1,
+	}
+	result.BitDepth = PixelFormatBitDepth(result.PixelFormat)
+	if animation, ok := FindAnimation(data); ok {
+		result.FrameCount = animation.Frames
+	}
+	return result, nil
+}
+
+func (GoProcessor) Convert(inBuf io.ReadSeeker, targetFormat string, options EncoderOptions, outBuf io.Writer) error {
+	targetFormat = NormalizeFormat(targetFormat)
+	codec, ok := ConvertImageFormats[targetFormat]
+	if !ok {
+		return fmt.Errorf("target format %s is not supported", targetFormat)
+	}
+	if !isGoEncodeFormat(codec) {
+		return fmt.Errorf("target format %s is not supported by the go backend", targetFormat)
+	}
+
+	img, format, _, err := goDecode(inBuf)
+	if err != nil {
+		return err
+	}
+	if !CanConvert(format, targetFormat) {
+		return fmt.Errorf("converting %s to %s is not supported", format, targetFormat)
+	}
+	return goEncode(img, codec, 0, options, outBuf)
+}
+
+// Resize the image like ResizeImageWithMode, the EXIF orientation is applied before resizing
+func (GoProcessor) Resize(inBuf io.ReadSeeker, format string, width uint16, height uint16, mode string, background string, outBuf io.Writer) error {
+	// Check width and height
+	if width == 0 && height == 0 {
+		return fmt.Errorf("width or height must be specified")
+	}
+
+	if width > ResizeMaxWidth {
+		return fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+	}
+
+	if height > ResizeMaxHeight {
+		return fmt.Errorf("height must be positive and < %d", ResizeMaxHeight)
+	}
+
+	// Check format
+	if !isResizeFormat(format) || !isGoEncodeFormat(format) {
+		return fmt.Errorf("file format %s is not supported by the go backend", format)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return err
+	}
+	img = goOrient(img, orientation)
+
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return err
+	}
+	geometry, err := resizeGeometryOf(srcWidth, srcHeight, width, height, mode, background)
+	if err != nil {
+		return err
+	}
+	img, err = goResize(img, geometry)
+	if err != nil {
+		return err
+	}
+	return goEncode(img, format, 0, EncoderOptions{}, outBuf)
+}
+
+// Compress the image like CompressImageWithOptions, the EXIF orientation is applied before compressing
+func (GoProcessor) Compress(inBuf io.ReadSeeker, format string, compressionLevel uint8, options EncoderOptions, outBuf io.Writer) error {
+	if compressionLevel != 0 || options.IsZero() {
+		if compressionLevel < 1 || compressionLevel > 5 {
+			return fmt.Errorf("compression level must between 1 <= level <= 5")
+		}
+	}
+	if !isCompressFormat(format) || !isGoEncodeFormat(format) {
+		return fmt.Errorf("file format %s is not supported by the go backend", format)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return err
+	}
+	return goEncode(goOrient(img, orientation), format, compressionLevel, options, outBuf)
+}
+
+// CompressToSize compress the image like CompressToSize, only jpeg and png are supported
+func (GoProcessor) CompressToSize(inBuf io.ReadSeeker, format string, maxBytes int, downscale bool, outBuf io.Writer) (TargetSizeResult, error) {
+	if maxBytes < 1 {
+		return TargetSizeResult{}, fmt.Errorf("max bytes must be positive")
+	}
+	if format != "mjpeg" && format != "png" {
+		return TargetSizeResult{}, fmt.Errorf("file format %s is not supported by the go backend", format)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+	img = goOrient(img, orientation)
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+
+	heights := map[uint16]uint16{srcWidth: srcHeight}
+	encode := func(quality int, width uint16) ([]byte, error) {
+		scaled := img
+		if width != srcWidth {
+			geometry, err := resizeGeometryOf(srcWidth, srcHeight, width, 0, ResizeModeFill, "")
+			if err != nil {
+				return nil, err
+			}
+			if scaled, err = goResize(img, geometry); err != nil {
+				return nil, err
+			}
+			heights[width] = geometry.height
+		}
+
+		// PNG is lossless, only the compression level can be chosen
+		var options EncoderOptions
+		if format == "mjpeg" {
+			options.Quality = &quality
+		} else {
+			level := 9
+			options.PngCompressionLevel = &level
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := goEncode(scaled, format, 0, options, buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	quality, width, data, err := fitSize(maxBytes, srcWidth, format == "mjpeg", downscale, encode)
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+	if _, err := outBuf.Write(data); err != nil {
+		return TargetSizeResult{}, err
+	}
+	return TargetSizeResult{Quality: quality, Width: width, Height: heights[width], Size: len(data)}, nil
+}
+
+// Crop the image like CropImage, the EXIF orientation is applied before cropping
+func (GoProcessor) Crop(inBuf io.ReadSeeker, format string, options CropOptions, outBuf io.Writer) error {
+	if !isResizeFormat(format) || !isGoEncodeFormat(format) {
+		return fmt.Errorf("file format %s is not supported by the go backend", format)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return err
+	}
+	img = goOrient(img, orientation)
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return err
+	}
+	img, err = goCrop(img, srcWidth, srcHeight, options)
+	if err != nil {
+		return err
+	}
+	return goEncode(img, format, 0, EncoderOptions{}, outBuf)
+}
+
+// Transform the image like TransformImage, only the multiples of 90 degrees can be rotated
+func (GoProcessor) Transform(inBuf io.ReadSeeker, format string, options TransformOptions, outBuf io.Writer) error {
+	if !isResizeFormat(format) || !isGoEncodeFormat(format) {
+		return fmt.Errorf("file format %s is not supported by the go backend", format)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return err
+	}
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return err
+	}
+	// Validate the options like the ffmpeg backend
+	if _, _, _, err := TransformFilter(srcWidth, srcHeight, orientation, options); err != nil {
+		return err
+	}
+
+	// Rotations and flips are the orientations undone by goOrient, see OrientationFilter
+	if options.AutoOrient {
+		img = goOrient(img, orientation)
+	}
+	if img, err = goRotate(img, options.Rotate); err != nil {
+		return err
+	}
+	return goEncode(goFlip(img, options.Flip), format, 0, EncoderOptions{}, outBuf)
+}
+
+// Thumbnail of the image like ThumbnailImage, webp is never picked as it can't be encoded
+func (GoProcessor) Thumbnail(inBuf io.ReadSeeker, options ThumbnailOptions, outBuf io.Writer) (string, error) {
+	// Check width and height
+	if options.Width < 1 || options.Width > ResizeMaxWidth {
+		return "", fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+	}
+
+	if options.Height < 1 || options.Height > ResizeMaxHeight {
+		return "", fmt.Errorf("height must be positive and < %d", ResizeMaxHeight)
+	}
+
+	img, _, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return "", err
+	}
+
+	// Check format
+	format := NormalizeFormat(options.Format)
+	if format == "" {
+		format = ThumbnailFormat(goPixelFormat(img.ColorModel()), false)
+	}
+	if !isThumbnailFormat(format) {
+		return "", fmt.Errorf("thumbnail format %s is not supported", options.Format)
+	}
+	codec := ConvertImageFormats[format]
+	if !isGoEncodeFormat(codec) {
+		return "", fmt.Errorf("thumbnail format %s is not supported by the go backend", format)
+	}
+
+	img = goOrient(img, orientation)
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return "", err
+	}
+	geometry, err := resizeGeometryOf(srcWidth, srcHeight, options.Width, options.Height, ResizeModeCover, "")
+	if err != nil {
+		return "", err
+	}
+	if img, err = goResize(img, geometry); err != nil {
+		return "", err
+	}
+	if err := goEncode(img, codec, ThumbnailCompressionLevel(options.Width, options.Height), EncoderOptions{}, outBuf); err != nil {
+		return "", err
+	}
+	return codec, nil
+}
+
+// Info return the details of the image like GetImageInfo, the colour space isn't reported
+func (processor GoProcessor) Info(inBuf io.ReadSeeker) (ImageInfo, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	inBuf.Seek(0, 0)
+
+	probe, err := processor.Probe(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return imageInfo(data, probe), nil
+}
+
+// Pipeline apply the operations one by one like RunPipelineProgress, the pipeline is planned first
+// so both backends accept the same pipelines, only the rotations by multiples of 90 degrees are supported
+func (GoProcessor) Pipeline(inBuf io.ReadSeeker, pipeline Pipeline, outBuf io.Writer, progress func(percent int)) (string, error) {
+	if progress == nil {
+		progress = func(int) {}
+	}
+	if err := pipeline.Validate(); err != nil {
+		return "", err
+	}
+
+	img, format, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return "", err
+	}
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return "", err
+	}
+	progress(25)
+
+	plan, err := pipeline.Plan(format, srcWidth, srcHeight, orientation)
+	if err != nil {
+		return "", err
+	}
+	if !isGoEncodeFormat(plan.Format) {
+		return "", fmt.Errorf("file format %s is not supported by the go backend", plan.Format)
+	}
+	progress(50)
+
+	var compressionLevel uint8
+	var encoderOptions EncoderOptions
+	for i, operation := range pipeline {
+		switch operation.Op {
+		case OperationResize:
+			var geometry resizeGeometry
+			width, height, _ := goSize(img)
+			geometry, err = resizeGeometryOf(width, height, operation.Width, operation.Height, operation.Mode, operation.Background)
+			if err == nil {
+				img, err = goResize(img, geometry)
+			}
+		case OperationCrop:
+			options := CropOptions{
+				Width:   operation.Width,
+				Height:  operation.Height,
+				Gravity: operation.Gravity,
+			}
+			if operation.X != nil {
+				options.X, options.Y = *operation.X, *operation.Y
+			} else if options.Gravity == "" {
+				options.Gravity = GravityCenter
+			}
+			width, height, _ := goSize(img)
+			img, err = goCrop(img, width, height, options)
+		case OperationRotate:
+			img, err = goRotate(img, operation.Angle)
+		case OperationFlip:
+			img = goFlip(img, operation.Direction)
+		case OperationAutoOrient:
+			img = goOrient(img, orientation)
+		case OperationCompress:
+			compressionLevel = operation.CompressionLevel
+			encoderOptions = operation.EncoderOptions
+		}
+		if err != nil {
+			return "", fmt.Errorf("operation %d (%s): %w", i, operation.Op, err)
+		}
+	}
+
+	if err := goEncode(img, plan.Format, compressionLevel, encoderOptions, outBuf); err != nil {
+		return "", fmt.Errorf("operation compress: %w", err)
+	}
+	progress(90)
+	return plan.Format, nil
+}
+
+// Variants resize then encode the image for every width and format like GenerateVariants,
+// webp and avif variants can't be encoded
+func (GoProcessor) Variants(inBuf io.ReadSeeker, widths []uint16, formats []string) ([]Variant, error) {
+	if err := checkSrcsetWidths(widths); err != nil {
+		return nil, err
+	}
+
+	img, format, orientation, err := goDecode(inBuf)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ConvertFormatMatrix[format]; !ok {
+		return nil, fmt.Errorf("file format %s is not supported", format)
+	}
+	codecs, err := srcsetCodecs(format, formats)
+	if err != nil {
+		return nil, err
+	}
+	for _, codec := range codecs {
+		if !isGoEncodeFormat(codec) {
+			return nil, fmt.Errorf("target format %s is not supported by the go backend", codec)
+		}
+	}
+
+	img = goOrient(img, orientation)
+	srcWidth, srcHeight, err := goSize(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []Variant
+	for _, codec := range codecs {
+		for _, width := range SrcsetWidths(srcWidth, widths) {
+			geometry, err := resizeGeometryOf(srcWidth, srcHeight, width, 0, ResizeModeFill, "")
+			if err != nil {
+				return nil, err
+			}
+			scaled, err := goResize(img, geometry)
+			if err != nil {
+				return nil, err
+			}
+			buf := bytes.NewBuffer(nil)
+			if err := goEncode(scaled, codec, 0, EncoderOptions{}, buf); err != nil {
+				return nil, err
+			}
+			variants = append(variants, Variant{Width: geometry.width, Height: geometry.height, Format: codec, Data: buf.Bytes()})
+		}
+	}
+	return variants, nil
+}
+
+// goDecode decode the image stored in inBuf and return it with its format (ffmpeg codec name) and EXIF orientation
+func goDecode(inBuf io.ReadSeeker) (image.Image, string, uint16, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	inBuf.Seek(0, 0)
+
+	// Check the size announced by the header before allocating the image
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("can't decode image: %s", err.Error())
+	}
+	if _, _, err := (ProbeResult{Width: config.Width, Height: config.Height}).Size(); err != nil {
+		return nil, "", 0, err
+	}
+	if config.Width*config.Height > GoMaxPixels {
+		return nil, "", 0, fmt.Errorf("image of %dx%d pixels is larger than the %d pixels of the go backend: %w",
+			config.Width, config.Height, GoMaxPixels, ErrImageTooLarge)
+	}
+
+	img, name, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("can't decode image: %s", err.Error())
+	}
+
+	orientation := readExifOrientation(findExif(data))
+	if orientation < 1 || orientation > 8 {
+		orientation = 1
+	}
+	return img, goCodec(name), orientation, nil
+}
+
+// goEncode encode img with format (ffmpeg codec name) to outBuf
+// compressionLevel (1-5, 0 for the default) and options are mapped like setCompressionKwargs and EncoderOptions.Apply,
+// options take precedence over compressionLevel
+func goEncode(img image.Image, format string, compressionLevel uint8, options EncoderOptions, outBuf io.Writer) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	// Only the quality of jpeg and the compression level of png can be chosen
+	for _, option := range []struct {
+		name string
+		set  bool
+		ok   bool
+	}{
+		{"quality", options.Quality != nil, format == "mjpeg"},
+		{"png_compression_level", options.PngCompressionLevel != nil, format == "png"},
+		{"chroma_subsampling", options.ChromaSubsampling != "", false},
+		{"palette", options.Palette, false},
+		{"lossless", options.Lossless, false},
+		{"method", options.Method != nil, false},
+		{"tiff_compression", options.TiffCompression != "", false},
+	} {
+		if option.set && !option.ok {
+			return fmt.Errorf("%s is not supported for format %s by the go backend", option.name, format)
+		}
+	}
+
+	switch format {
+	case "mjpeg":
+		quality := jpeg.DefaultQuality
+		if options.Quality != nil {
+			quality = *options.Quality
+		} else if compressionLevel != 0 {
+			// Same scale as the mjpeg qscale used by setCompressionKwargs, 5 is the worst quality
+			quality = int(math.Round(Mapfloat64(float64(compressionLevel), 1, 5, QualityMax, QualityMin)))
+		}
+		return jpeg.Encode(outBuf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		level := -1
+		if options.PngCompressionLevel != nil {
+			level = *options.PngCompressionLevel
+		} else if compressionLevel != 0 {
+			level = int(math.Round(Mapfloat64(float64(compressionLevel), 1, 5, 1, 9)))
+		}
+		encoder := png.Encoder{CompressionLevel: goPngCompressionLevel(level)}
+		return encoder.Encode(outBuf, img)
+	case "gif":
+		return gif.Encode(outBuf, img, nil)
+	case "bmp":
+		return bmp.Encode(outBuf, img)
+	}
+	return fmt.Errorf("file format %s is not supported by the go backend", format)
+}
+
+// goCrop cut the rectangle of options out of img, of srcWidth x srcHeight, see CropRectangle
+func goCrop(img image.Image, srcWidth uint16, srcHeight uint16, options CropOptions) (image.Image, error) {
+	x, y, err := CropRectangle(srcWidth, srcHeight, options)
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, int(options.Width), int(options.Height)))
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min.Add(image.Pt(int(x), int(y))), draw.Src)
+	return out, nil
+}
+
+// goRotate rotate img clockwise by angle, a multiple of 90 degrees, with the orientations undone by goOrient
+func goRotate(img image.Image, angle float64) (image.Image, error) {
+	switch math.Mod(math.Mod(angle, 360)+360, 360) {
+	case 0:
+		return img, nil
+	case 90:
+		return goOrient(img, 6), nil
+	case 180:
+		return goOrient(img, 3), nil
+	case 270:
+		return goOrient(img, 8), nil
+	}
+	return nil, notSupported("rotating by an arbitrary angle", BackendGo)
+}
+
+// goFlip mirror img in direction (see FlipFilter) with the orientations undone by goOrient
+func goFlip(img image.Image, direction string) image.Image {
+	switch direction {
+	case FlipHorizontal:
+		return goOrient(img, 2)
+	case FlipVertical:
+		return goOrient(img, 4)
+	case FlipBoth:
+		return goOrient(img, 3)
+	}
+	return img
+}
+
+// goSize return the width and height of img
+func goSize(img image.Image) (uint16, uint16, error) {
+	return ProbeResult{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}.Size()
+}
+
+// goPngCompressionLevel map a zlib level (0-9, -1 for the default) to the nearest level of image/png
+func goPngCompressionLevel(level int) png.CompressionLevel {
+	switch {
+	case level < 0:
+		return png.DefaultCompression
+	case level == 0:
+		return png.NoCompression
+	case level <= 3:
+		return png.BestSpeed
+	case level <= 6:
+		return png.DefaultCompression
+	}
+	return png.BestCompression
+}
+
+// goResize crop, scale and pad img according to geometry
+func goResize(img image.Image, geometry resizeGeometry) (image.Image, error) {
+	bounds := img.Bounds()
+	crop := image.Rect(0, 0, int(geometry.cropWidth), int(geometry.cropHeight)).
+		Add(bounds.Min).
+		Add(image.Pt((bounds.Dx()-int(geometry.cropWidth))/2, (bounds.Dy()-int(geometry.cropHeight))/2))
+
+	out := image.NewNRGBA(image.Rect(0, 0, int(geometry.width), int(geometry.height)))
+	scaled := image.Rect(0, 0, int(geometry.scaleWidth), int(geometry.scaleHeight)).
+		Add(image.Pt((int(geometry.width)-int(geometry.scaleWidth))/2, (int(geometry.height)-int(geometry.scaleHeight))/2))
+	if scaled != out.Bounds() {
+		background, err := goColor(geometry.background)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(out, out.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(out, scaled, img, crop, draw.Over, nil)
+	return out, nil
+}
+
+// goOrient undo the EXIF orientation of img, see OrientationFilter
+func goOrient(img image.Image, orientation uint16) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	_, swap := OrientationFilter(orientation)
+	outWidth, outHeight := width, height
+	if swap {
+		outWidth, outHeight = height, width
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			// Source pixel of the output pixel x, y
+			srcX, srcY := x, y
+			switch orientation {
+			case 2:
+				srcX = width - 1 - x
+			case 3:
+				srcX, srcY = width-1-x, height-1-y
+			case 4:
+				srcY = height - 1 - y
+			case 5:
+				srcX, srcY = y, x
+			case 6:
+				srcX, srcY = y, height-1-x
+			case 7:
+				srcX, srcY = width-1-y, height-1-x
+			case 8:
+				srcX, srcY = width-1-y, x
+			}
+			out.Set(x, y, img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+	return out
+}
+
+// goColor parse the background colours accepted by GoProcessor, names of goBackgrounds or hex colours
+// such as "#ff0000", "0xff000080" or "ff0000"
+func goColor(value string) (color.Color, error) {
+	if background, ok := goBackgrounds[strings.ToLower(value)]; ok {
+		return background, nil
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(value, "#"), "0x")
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || (len(hex) != 6 && len(hex) != 8) {
+		return nil, fmt.Errorf("background colour %s is not supported by the go backend", value)
+	}
+	if len(hex) == 6 {
+		rgba = rgba<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)}, nil
+}
+
+// goCodec return the ffmpeg codec name of the image/* format name
+func goCodec(name string) string {
+	if name == "jpeg" {
+		return "mjpeg"
+	}
+	return name
+}
+
+// goPixelFormat return the ffmpeg pixel format closest to the Go colour model
+func goPixelFormat(model color.Model) string {
+	switch model {
+	case color.RGBAModel, color.NRGBAModel:
+		return "rgba"
+	case color.RGBA64Model, color.NRGBA64Model:
+		return "rgba64be"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16be"
+	case color.YCbCrModel:
+		return "yuvj420p"
+	case color.CMYKModel:
+		return "cmyk"
+	}
+	if _, ok := model.(color.Palette); ok {
+		return "pal8"
+	}
+	return ""
+}
+
+func isGoEncodeFormat(format string) bool {
+	for _, goFormat := range GoEncodeFormats {
+		if format == goFormat {
+			return true
+		}
+	}
+	return false
+}
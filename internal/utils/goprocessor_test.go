@@ -0,0 +1,564 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// AssertGoImageEqual decode the image stored in data with the go backend and check its format and size
+func AssertGoImageEqual(t *testing.T, data []byte, format string, width int, height int) {
+	assert := assert.New(t)
+
+	probe, err := GoProcessor{}.Probe(bytes.NewReader(data))
+	assert.NoError(err, "Failed to probe image")
+	assert.Equal(format, probe.Format)
+	assert.Equal(width, probe.Width, fmt.Sprintf("got width %d, want %d", probe.Width, width))
+	assert.Equal(height, probe.Height, fmt.Sprintf("got height %d, want %d", probe.Height, height))
+}
+
+func TestGoProcessorProbe(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		wantFormat string
+		wantWidth  int
+		wantHeight int
+		wantFrames int
+		wantError  bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 1000, 1000, 1, false},
+		{"../../test/data/test_1000x625.png", "png", 1000, 625, 1, false},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 1000, 1000, 1, false},
+		{"../../test/data/test_1000x1000.webp", "webp", 1000, 1000, 1, false},
+		{"../../test/data/test_200x100_animated.gif", "gif", 200, 100, 4, false},
+		{"../../test/data/test_320x180.avif", "", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoProcessorProbe %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			probe, err := GoProcessor{}.Probe(inBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				assert.Equal(tt.wantFormat, probe.Format)
+				assert.Equal(tt.wantWidth, probe.Width)
+				assert.Equal(tt.wantHeight, probe.Height)
+				assert.Equal(tt.wantFrames, probe.FrameCount)
+				assert.Equal(1, probe.Streams)
+			}
+		})
+	}
+}
+
+func TestGoProcessorConvert(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName     string
+		targetFormat string
+		options      EncoderOptions
+		wantFormat   string
+		wantError    bool
+	}{
+		{"../../test/data/test_1000x1000.png", "jpg", EncoderOptions{}, "mjpeg", false},
+		{"../../test/data/test_1000x1000.jpg", "png", EncoderOptions{PngCompressionLevel: intPointer(1)}, "png", false},
+		{"../../test/data/test_1000x1000.webp", "bmp", EncoderOptions{}, "bmp", false},
+		{"../../test/data/test_1000x1000.bmp", "gif", EncoderOptions{}, "gif", false},
+		{"../../test/data/test_1000x1000.webp", "jpeg", EncoderOptions{Quality: intPointer(60)}, "mjpeg", false},
+		{"../../test/data/test_1000x1000.png", "webp", EncoderOptions{}, "", true},
+		{"../../test/data/test_1000x1000.png", "avif", EncoderOptions{}, "", true},
+		{"../../test/data/test_1000x1000.png", "tga", EncoderOptions{}, "", true},
+		{"../../test/data/test_1000x1000.png", "jpeg", EncoderOptions{ChromaSubsampling: "444"}, "", true},
+		{"../../test/data/test_1000x1000.png", "png", EncoderOptions{Palette: true}, "", true},
+		{"../../test/data/test_320x180.avif", "png", EncoderOptions{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoProcessorConvert %s to %s",
+			tt.fileName, tt.targetFormat,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = GoProcessor{}.Convert(inBuf, tt.targetFormat, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.wantFormat, 1000, 1000)
+			}
+		})
+	}
+}
+
+func TestGoProcessorResize(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		format     string
+		width      uint16
+		height     uint16
+		mode       string
+		background string
+		wantWidth  int
+		wantHeight int
+		wantError  bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 200, 100, "", "", 200, 100, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 0, "", "", 400, 250, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModeFit, "", 400, 250, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModeCover, "", 400, 400, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModePad, "#ff000080", 400, 400, false},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 300, 200, ResizeModeFit, "", 200, 200, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", 0, 100, "", "", 63, 100, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModePad, "darkorange", 0, 0, true},
+		{"../../test/data/test_1000x1000.webp", "webp", 100, 100, "", "", 0, 0, true},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 0, 0, "", "", 0, 0, true},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", ResizeMaxWidth + 1, 100, "", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoProcessorResize %s %dx%d %s",
+			tt.fileName, tt.width, tt.height, tt.mode,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = GoProcessor{}.Resize(inBuf, tt.format, tt.width, tt.height, tt.mode, tt.background, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.format, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestGoProcessorCompress(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName         string
+		format           string
+		compressionLevel uint8
+		options          EncoderOptions
+		wantError        bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 5, EncoderOptions{}, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 0, EncoderOptions{Quality: intPointer(30)}, false},
+		{"../../test/data/test_1000x1000.png", "png", 5, EncoderOptions{}, false},
+		{"../../test/data/test_1000x1000.png", "png", 0, EncoderOptions{PngCompressionLevel: intPointer(9)}, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 0, EncoderOptions{}, true},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 6, EncoderOptions{}, true},
+		{"../../test/data/test_1000x1000.webp", "webp", 3, EncoderOptions{}, true},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 3, EncoderOptions{}, true},
+		{"../../test/data/test_1000x1000.png", "png", 0, EncoderOptions{Quality: intPointer(30)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoProcessorCompress %s,level:%d,%+v",
+			tt.fileName, tt.compressionLevel, tt.options,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+			stat, err := inBuf.Stat()
+			assert.NoError(err)
+
+			outBuf := bytes.NewBuffer(nil)
+			err = GoProcessor{}.Compress(inBuf, tt.format, tt.compressionLevel, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				assert.Less(int64(outBuf.Len()), stat.Size())
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.format, 1000, 1000)
+			}
+		})
+	}
+}
+
+func TestGoProcessorCompressToSize(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName    string
+		format      string
+		maxBytes    int
+		downscale   bool
+		wantQuality bool
+		wantWidth   int
+		wantError   bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 60000, false, true, 1000, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 2000, true, true, 0, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 2000, false, false, 0, true},
+		{"../../test/data/test_1000x1000.webp", "webp", 60000, false, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoProcessorCompressToSize %s,%d,downscale:%t",
+			tt.fileName, tt.maxBytes, tt.downscale,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			result, err := GoProcessor{}.CompressToSize(inBuf, tt.format, tt.maxBytes, tt.downscale, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				assert.LessOrEqual(outBuf.Len(), tt.maxBytes)
+				assert.Equal(outBuf.Len(), result.Size)
+				assert.Equal(tt.wantQuality, result.Quality > 0)
+				if tt.wantWidth != 0 {
+					assert.Equal(tt.wantWidth, int(result.Width))
+				} else {
+					assert.Less(int(result.Width), 1000)
+				}
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.format, int(result.Width), int(result.Height))
+			}
+		})
+	}
+}
+
+func TestGoProcessorCrop(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName  string
+		format    string
+		options   CropOptions
+		wantError bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", CropOptions{X: 100, Y: 200, Width: 300, Height: 400}, false},
+		{"../../test/data/test_1000x625.png", "png", CropOptions{Width: 300, Height: 400, Gravity: GravitySouthEast}, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", CropOptions{X: 0, Y: 500, Width: 600, Height: 400}, false},
+		{"../../test/data/test_1000x625.png", "png", CropOptions{X: 800, Width: 300, Height: 400}, true},
+		{"../../test/data/test_1000x1000.webp", "webp", CropOptions{Width: 300, Height: 400}, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoProcessorCrop %s %+v", tt.fileName, tt.options), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = GoProcessor{}.Crop(inBuf, tt.format, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.format, int(tt.options.Width), int(tt.options.Height))
+			}
+		})
+	}
+}
+
+func TestGoProcessorTransform(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName        string
+		format          string
+		options         TransformOptions
+		wantWidth       int
+		wantHeight      int
+		wantUnsupported bool
+		wantError       bool
+	}{
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: 90}, 625, 1000, false, false},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: -180, Flip: FlipBoth}, 1000, 625, false, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", TransformOptions{AutoOrient: true}, 625, 1000, false, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", TransformOptions{AutoOrient: true, Rotate: 270}, 1000, 625, false, false},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: 45}, 0, 0, true, true},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Flip: "diagonal"}, 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoProcessorTransform %s %+v", tt.fileName, tt.options), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = GoProcessor{}.Transform(inBuf, tt.format, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.wantUnsupported, errors.Is(err, ErrNotSupported))
+			if err == nil {
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.format, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestGoProcessorThumbnail(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		options    ThumbnailOptions
+		wantFormat string
+		wantError  bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", ThumbnailOptions{Width: 200, Height: 100, AcceptWebp: true}, "mjpeg", false},
+		{"../../test/data/test_1000x625.png", ThumbnailOptions{Width: 100, Height: 100}, "png", false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", ThumbnailOptions{Width: 100, Height: 50, Format: "png"}, "png", false},
+		{"../../test/data/test_1000x1000.jpg", ThumbnailOptions{Width: 100, Height: 100, Format: "webp"}, "", true},
+		{"../../test/data/test_1000x1000.jpg", ThumbnailOptions{Width: 0, Height: 100}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoProcessorThumbnail %s %+v", tt.fileName, tt.options), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			format, err := GoProcessor{}.Thumbnail(inBuf, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			if err == nil {
+				assert.Equal(tt.wantFormat, format)
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.wantFormat, int(tt.options.Width), int(tt.options.Height))
+			}
+		})
+	}
+}
+
+func TestGoProcessorInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	inBuf, err := os.Open("../../test/data/test_1000x625_orientation_6.jpg")
+	assert.NoError(err)
+	defer inBuf.Close()
+
+	info, err := GoProcessor{}.Info(inBuf)
+	assert.NoError(err)
+	assert.Equal("mjpeg", info.Codec)
+	assert.Equal("image/jpeg", info.MimeType)
+	assert.Equal(1000, info.Width)
+	assert.Equal(625, info.Height)
+	assert.Equal(uint16(6), info.Orientation)
+	assert.True(info.HasExif)
+	assert.Equal(1, info.PageCount)
+	stat, err := inBuf.Stat()
+	assert.NoError(err)
+	assert.Equal(stat.Size(), info.FileSize)
+}
+
+func TestGoDecodeTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	// 1x1 PNG whose header announce a larger image
+	pngWithSize := func(width uint32, height uint32) []byte {
+		buf := bytes.NewBuffer(nil)
+		assert.NoError(png.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1))))
+		data := buf.Bytes()
+		binary.BigEndian.PutUint32(data[16:], width)
+		binary.BigEndian.PutUint32(data[20:], height)
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+		return data
+	}
+
+	var tests = []struct {
+		width     uint32
+		height    uint32
+		wantError error
+	}{
+		{1, 1, nil},
+		{60000, 60000, ErrImageTooLarge},
+		{70000, 1, ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoDecodeTooLarge %dx%d", tt.width, tt.height), func(t *testing.T) {
+			_, _, _, err := goDecode(bytes.NewReader(pngWithSize(tt.width, tt.height)))
+			if tt.wantError == nil {
+				assert.NoError(err)
+			} else {
+				assert.ErrorIs(err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestGoProcessorPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	x, y := uint16(100), uint16(50)
+	var tests = []struct {
+		fileName   string
+		pipeline   Pipeline
+		wantFormat string
+		wantWidth  int
+		wantHeight int
+		wantError  error
+	}{
+		{"../../test/data/test_1000x625.png", Pipeline{{Op: OperationResize, Width: 400}, {Op: OperationCrop, Width: 200, Height: 100}}, "png", 200, 100, nil},
+		{"../../test/data/test_1000x625.png", Pipeline{{Op: OperationCrop, Width: 300, Height: 200, X: &x, Y: &y}, {Op: OperationRotate, Angle: 90}, {Op: OperationFlip, Direction: FlipHorizontal}}, "png", 200, 300, nil},
+		{"../../test/data/test_1000x625_orientation_6.jpg", Pipeline{{Op: OperationAutoOrient}, {Op: OperationResize, Width: 100}, {Op: OperationCompress, CompressionLevel: 3}}, "mjpeg", 100, 160, nil},
+		{"../../test/data/test_1000x1000.webp", Pipeline{{Op: OperationConvert, Format: "jpeg"}, {Op: OperationResize, Width: 100, Height: 50, Mode: ResizeModePad, Background: "white"}}, "mjpeg", 100, 50, nil},
+		{"../../test/data/test_1000x625.png", Pipeline{{Op: OperationRotate, Angle: 45}}, "", 0, 0, ErrNotSupported},
+		{"../../test/data/test_1000x625.png", Pipeline{{Op: OperationConvert, Format: "webp"}}, "", 0, 0, errors.New("")},
+		{"../../test/data/test_1000x625.png", Pipeline{{Op: OperationCrop, Width: 2000, Height: 100}}, "", 0, 0, errors.New("")},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoProcessorPipeline %s %+v", tt.fileName, tt.pipeline), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			var percents []int
+			outBuf := bytes.NewBuffer(nil)
+			format, err := GoProcessor{}.Pipeline(inBuf, tt.pipeline, outBuf, func(percent int) { percents = append(percents, percent) })
+			switch {
+			case tt.wantError == nil:
+				assert.NoError(err)
+				assert.Equal(tt.wantFormat, format)
+				assert.Equal([]int{25, 50, 90}, percents)
+				AssertGoImageEqual(t, outBuf.Bytes(), tt.wantFormat, tt.wantWidth, tt.wantHeight)
+			case errors.Is(tt.wantError, ErrNotSupported):
+				assert.ErrorIs(err, ErrNotSupported)
+			default:
+				assert.Error(err)
+				assert.NotErrorIs(err, ErrNotSupported)
+			}
+		})
+	}
+}
+
+func TestGoProcessorVariants(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName     string
+		widths       []uint16
+		formats      []string
+		wantVariants []Variant
+		wantError    bool
+	}{
+		{"../../test/data/test_1000x625.png", []uint16{400, 200, 2000}, nil, []Variant{{Width: 200, Height: 125, Format: "png"}, {Width: 400, Height: 250, Format: "png"}}, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", []uint16{100}, []string{"png", "jpeg"}, []Variant{{Width: 100, Height: 160, Format: "png"}, {Width: 100, Height: 160, Format: "mjpeg"}}, false},
+		{"../../test/data/test_1000x625.png", []uint16{100}, []string{"webp"}, nil, true},
+		{"../../test/data/test_1000x625.png", nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestGoProcessorVariants %s %v %v", tt.fileName, tt.widths, tt.formats), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			variants, err := GoProcessor{}.Variants(inBuf, tt.widths, tt.formats)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Len(variants, len(tt.wantVariants))
+			for i, variant := range variants {
+				assert.Equal(tt.wantVariants[i].Width, variant.Width)
+				assert.Equal(tt.wantVariants[i].Height, variant.Height)
+				assert.Equal(tt.wantVariants[i].Format, variant.Format)
+				AssertGoImageEqual(t, variant.Data, variant.Format, int(variant.Width), int(variant.Height))
+			}
+		})
+	}
+}
+
+func TestGoOrient(t *testing.T) {
+	assert := assert.New(t)
+
+	// 3x2 image whose pixels are numbered row by row
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+
+	var tests = []struct {
+		orientation uint16
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoOrient %d",
+			tt.orientation,
+		), func(t *testing.T) {
+			out := goOrient(img, tt.orientation)
+			got := make([][]uint8, out.Bounds().Dy())
+			for y := range got {
+				got[y] = make([]uint8, out.Bounds().Dx())
+				for x := range got[y] {
+					got[y][x] = color.GrayModel.Convert(out.At(x, y)).(color.Gray).Y
+				}
+			}
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestGoColor(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		value     string
+		want      color.Color
+		wantError bool
+	}{
+		{"black", color.Black, false},
+		{"White", color.White, false},
+		{"#ff0000", color.NRGBA{R: 255, A: 255}, false},
+		{"0x00ff0080", color.NRGBA{G: 255, A: 128}, false},
+		{"0000ff", color.NRGBA{B: 255, A: 255}, false},
+		{"darkorange", nil, true},
+		{"#ff00", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGoColor %s",
+			tt.value,
+		), func(t *testing.T) {
+			got, err := goColor(tt.value)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestNewProcessor(t *testing.T) {
+	assert := assert.New(t)
+
+	processor, err := NewProcessor(BackendGo)
+	assert.NoError(err)
+	assert.Equal(BackendGo, processor.Name())
+
+	processor, err = NewProcessor(BackendFfmpeg)
+	assert.NoError(err)
+	assert.Equal(BackendFfmpeg, processor.Name())
+
+	processor, err = NewProcessor(BackendAuto)
+	assert.NoError(err)
+	if FfmpegAvailable() {
+		assert.Equal(BackendFfmpeg, processor.Name())
+	} else {
+		assert.Equal(BackendGo, processor.Name())
+	}
+
+	_, err = NewProcessor("imagemagick")
+	assert.Error(err)
+}
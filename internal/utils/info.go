@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ImageInfo describe an image as reported by GetImageInfo
+type ImageInfo struct {
+	Codec       string  `json:"codec"`        // ffmpeg codec name, e.g. "mjpeg"
+	Container   string  `json:"container"`    // ffmpeg demuxer name, e.g. "png_pipe"
+	MimeType    string  `json:"mime_type"`    // mimetype returned by the processing endpoints
+	Width       int     `json:"width"`        // width in pixels
+	Height      int     `json:"height"`       // height in pixels
+	PixelFormat string  `json:"pixel_format"` // ffmpeg pixel format, e.g. "rgba"
+	BitDepth    int     `json:"bit_depth"`    // bits per component
+	HasAlpha    bool    `json:"has_alpha"`    // whether the pixel format has an alpha channel
+	ColorSpace  string  `json:"color_space"`  // e.g. "bt470bg", empty when unknown
+	FrameCount  int     `json:"frame_count"`  // 1 for still images
+	LoopCount   int     `json:"loop_count"`   // number of plays of animations, 0 means forever or still image
+	PageCount   int     `json:"page_count"`   // number of pages of multi-page TIFF, 1 for other formats
+	Duration    float64 `json:"duration"`     // seconds, 0 for still images
+	FileSize    int64   `json:"file_size"`    // bytes
+	Orientation uint16  `json:"orientation"`  // EXIF orientation (1-8)
+	HasExif     bool    `json:"has_exif"`
+	HasXmp      bool    `json:"has_xmp"`
+	HasIcc      bool    `json:"has_icc"`
+}
+
+// GetImageInfo return the codec, size, pixel format, animation and metadata details of the image stored in inBuf
+func GetImageInfo(inBuf io.ReadSeeker) (ImageInfo, error) {
+	data, err := io.ReadAll(inBuf)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	inBuf.Seek(0, 0)
+
+	probe, err := Probe(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return imageInfo(data, probe), nil
+}
+
+// imageInfo complete probe, the result of a backend probe of data, with the details read from the container
+func imageInfo(data []byte, probe ProbeResult) ImageInfo {
+	info := ImageInfo{
+		Codec:       probe.Format,
+		Container:   probe.Container,
+		MimeType:    GetMimeType(probe.Format),
+		Width:       probe.Width,
+		Height:      probe.Height,
+		PixelFormat: probe.PixelFormat,
+		BitDepth:    probe.BitDepth,
+		HasAlpha:    PixelFormatHasAlpha(probe.PixelFormat),
+		ColorSpace:  probe.ColorSpace,
+		FrameCount:  probe.FrameCount,
+		Duration:    probe.Duration,
+		FileSize:    int64(len(data)),
+		Orientation: 1,
+		PageCount:   1,
+	}
+	if pages, err := TiffPageCount(data); err == nil {
+		info.PageCount = pages
+	}
+
+	// ffprobe doesn't count the frames of animated WebP, the container is parsed instead
+	if animation, ok := FindAnimation(data); ok {
+		info.FrameCount, info.LoopCount = animation.Frames, animation.Loop
+	}
+
+	metadata := FindImageMetadata(data)
+	info.HasExif, info.HasXmp, info.HasIcc = metadata.HasExif, metadata.HasXmp, metadata.HasIcc
+	if orientation := readExifOrientation(findExif(data)); orientation >= 1 && orientation <= 8 {
+		info.Orientation = orientation
+	}
+	return info
+}
+
+// PixelFormatBitDepth return the number of bits per component of the ffmpeg pixel format
+func PixelFormatBitDepth(pixelFormat string) int {
+	switch {
+	case pixelFormat == "":
+		return 0
+	case pixelFormat == "monob" || pixelFormat == "monow":
+		return 1
+	case strings.Contains(pixelFormat, "rgb48"), strings.Contains(pixelFormat, "rgba64"),
+		strings.Contains(pixelFormat, "16"):
+		return 16
+	case strings.Contains(pixelFormat, "p12"):
+		return 12
+	case strings.Contains(pixelFormat, "p10"):
+		return 10
+	}
+	return 8
+}
+
+// PixelFormatHasAlpha report whether the ffmpeg pixel format has an alpha channel
+func PixelFormatHasAlpha(pixelFormat string) bool {
+	for _, prefix := range []string{"rgba", "bgra", "argb", "abgr", "yuva", "gbrap", "ya8", "ya16"} {
+		if strings.HasPrefix(pixelFormat, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName        string
+		wantCodec       string
+		wantWidth       int
+		wantHeight      int
+		wantOrientation uint16
+		wantExif        bool
+		wantFrames      int
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 1000, 1000, 1, false, 1},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", 1000, 625, 6, true, 1},
+		{"../../test/data/test_1000x625.png", "png", 1000, 625, 1, false, 1},
+		{"../../test/data/test_1000x1000.webp", "webp", 1000, 1000, 1, false, 1},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 1000, 1000, 1, false, 1},
+		{"../../test/data/test_200x100_animated.gif", "gif", 200, 100, 1, false, 4},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGetImageInfo %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+			stat, err := inBuf.Stat()
+			assert.NoError(err)
+
+			info, err := GetImageInfo(inBuf)
+			assert.NoError(err)
+			assert.Equal(tt.wantCodec, info.Codec)
+			assert.Equal(tt.wantWidth, info.Width)
+			assert.Equal(tt.wantHeight, info.Height)
+			assert.Equal(tt.wantOrientation, info.Orientation)
+			assert.Equal(tt.wantExif, info.HasExif)
+			assert.Equal(tt.wantFrames, info.FrameCount)
+			assert.Equal(0, info.LoopCount)
+			if tt.wantFrames == 1 {
+				assert.Equal(float64(0), info.Duration)
+			}
+			assert.Equal(stat.Size(), info.FileSize)
+		})
+	}
+}
+
+func TestPixelFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		pixelFormat  string
+		wantBitDepth int
+		wantAlpha    bool
+	}{
+		{"yuvj420p", 8, false},
+		{"rgb24", 8, false},
+		{"rgba", 8, true},
+		{"yuva420p", 8, true},
+		{"pal8", 8, false},
+		{"gray", 8, false},
+		{"ya8", 8, true},
+		{"rgb48be", 16, false},
+		{"rgba64be", 16, true},
+		{"gray16be", 16, false},
+		{"yuv420p10le", 10, false},
+		{"yuv444p12le", 12, false},
+		{"monob", 1, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestPixelFormat %s",
+			tt.pixelFormat,
+		), func(t *testing.T) {
+			assert.Equal(tt.wantBitDepth, PixelFormatBitDepth(tt.pixelFormat))
+			assert.Equal(tt.wantAlpha, PixelFormatHasAlpha(tt.pixelFormat))
+		})
+	}
+}
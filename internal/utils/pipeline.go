@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Operations accepted in a Pipeline
+const (
+	OperationResize     = "resize"
+	OperationCrop       = "crop"
+	OperationRotate     = "rotate"
+	OperationFlip       = "flip"
+	OperationAutoOrient = "auto_orient"
+	OperationCompress   = "compress"
+	OperationConvert    = "convert"
+)
+
+// PipelineMaxOperations is the maximum number of operations in a Pipeline
+const PipelineMaxOperations = 32
+
+// Operation is a single step of a Pipeline, only the fields relevant to Op are used
+//
+//	resize: width, height, mode, background (see ResizeImageWithMode)
+//	crop: width, height and either x, y or gravity (see CropImage)
+//	rotate: angle, background (see TransformImage)
+//	flip: direction (see TransformImage)
+//	auto_orient: no parameter
+//	compress: compression_level and/or the encoder options (see CompressImageWithOptions and EncoderOptions)
+//	convert: format (see ConvertImage)
+type Operation struct {
+	Op               string  `json:"op"`
+	Width            uint16  `json:"width,omitempty"`
+	Height           uint16  `json:"height,omitempty"`
+	Mode             string  `json:"mode,omitempty"`
+	Background       string  `json:"background,omitempty"`
+	X                *uint16 `json:"x,omitempty"`
+	Y                *uint16 `json:"y,omitempty"`
+	Gravity          string  `json:"gravity,omitempty"`
+	Angle            float64 `json:"angle,omitempty"`
+	Direction        string  `json:"direction,omitempty"`
+	CompressionLevel uint8   `json:"compression_level,omitempty"`
+	Format           string  `json:"format,omitempty"`
+	EncoderOptions
+}
+
+// Pipeline is an ordered list of operations executed by RunPipeline with a single ffmpeg invocation
+// resize, crop, rotate, flip and auto_orient are chained in order in the filter graph,
+// compress and convert configure the encoder so they may appear at most once each
+type Pipeline []Operation
+
+// PipelinePlan is the ffmpeg invocation resolved from a Pipeline for a given source image
+type PipelinePlan struct {
+	Filter    string        // filter graph, empty when no filter is needed
+	Format    string        // ffmpeg codec of the output image
+	Width     uint16        // width of the output image
+	Height    uint16        // height of the output image
+	OutKwargs ffmpeg.KwArgs // ffmpeg output arguments
+}
+
+// Validate check the operation parameters that don't depend on the source image
+func (operation Operation) Validate() error {
+	switch operation.Op {
+	case OperationResize:
+		if operation.Width == 0 && operation.Height == 0 {
+			return fmt.Errorf("width or height must be specified")
+		}
+		if operation.Width > ResizeMaxWidth {
+			return fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+		}
+		if operation.Height > ResizeMaxHeight {
+			return fmt.Errorf("height must be positive and < %d", ResizeMaxHeight)
+		}
+		if operation.Mode != "" && !isResizeMode(operation.Mode) {
+			return fmt.Errorf("resize mode %s is not supported", operation.Mode)
+		}
+		if operation.Background != "" && !colorRegexp.MatchString(operation.Background) {
+			return fmt.Errorf("background colour %s is not valid", operation.Background)
+		}
+	case OperationCrop:
+		if operation.Width < 1 || operation.Height < 1 {
+			return fmt.Errorf("crop width and height must be positive")
+		}
+		if (operation.X == nil) != (operation.Y == nil) {
+			return fmt.Errorf("both x and y are required")
+		}
+		if operation.X != nil && operation.Gravity != "" {
+			return fmt.Errorf("gravity can't be combined with x and y")
+		}
+		if operation.Gravity != "" && !isGravity(operation.Gravity) {
+			return fmt.Errorf("gravity %s is not supported", operation.Gravity)
+		}
+	case OperationRotate:
+		if math.IsNaN(operation.Angle) || math.IsInf(operation.Angle, 0) {
+			return fmt.Errorf("rotation angle must be a number")
+		}
+		if operation.Background != "" && !colorRegexp.MatchString(operation.Background) {
+			return fmt.Errorf("background colour %s is not valid", operation.Background)
+		}
+	case OperationFlip:
+		if operation.Direction == "" {
+			return fmt.Errorf("flip direction must be specified")
+		}
+		if _, err := FlipFilter(operation.Direction); err != nil {
+			return err
+		}
+	case OperationAutoOrient:
+	case OperationCompress:
+		if operation.CompressionLevel == 0 && !operation.EncoderOptions.IsZero() {
+			return operation.EncoderOptions.Validate()
+		}
+		if operation.CompressionLevel < 1 || operation.CompressionLevel > 5 {
+			return fmt.Errorf("compression level must between 1 <= level <= 5")
+		}
+		if err := operation.EncoderOptions.Validate(); err != nil {
+			return err
+		}
+	case OperationConvert:
+		if _, ok := ConvertImageFormats[NormalizeFormat(operation.Format)]; !ok {
+			return fmt.Errorf("target format %s is not supported", operation.Format)
+		}
+	default:
+		return fmt.Errorf("operation %s is not supported", operation.Op)
+	}
+	return nil
+}
+
+// Validate check the whole pipeline before any processing happen
+func (pipeline Pipeline) Validate() error {
+	if len(pipeline) == 0 {
+		return fmt.Errorf("pipeline must contain at least one operation")
+	}
+	if len(pipeline) > PipelineMaxOperations {
+		return fmt.Errorf("pipeline must contain at most %d operations", PipelineMaxOperations)
+	}
+
+	seen := map[string]bool{}
+	for i, operation := range pipeline {
+		if err := operation.Validate(); err != nil {
+			return fmt.Errorf("operation %d (%s): %s", i, operation.Op, err.Error())
+		}
+		if operation.Op == OperationCompress || operation.Op == OperationConvert {
+			if seen[operation.Op] {
+				return fmt.Errorf("operation %d (%s): can only be specified once", i, operation.Op)
+			}
+			seen[operation.Op] = true
+		}
+	}
+	return nil
+}
+
+// Plan resolve the pipeline against a source image encoded with format, of srcWidth x srcHeight
+// and with the given EXIF orientation
+func (pipeline Pipeline) Plan(format string, srcWidth uint16, srcHeight uint16, orientation uint16) (PipelinePlan, error) {
+	if err := pipeline.Validate(); err != nil {
+		return PipelinePlan{}, err
+	}
+	if _, ok := ConvertFormatMatrix[format]; !ok {
+		return PipelinePlan{}, fmt.Errorf("file format %s is not supported", format)
+	}
+
+	plan := PipelinePlan{
+		Format: format,
+		Width:  srcWidth,
+		Height: srcHeight,
+	}
+	var compressionLevel uint8
+	var encoderOptions EncoderOptions
+
+	for i, operation := range pipeline {
+		var filter string
+		var err error
+
+		switch operation.Op {
+		case OperationResize:
+			filter, plan.Width, plan.Height, err = ResizeFilter(
+				plan.Width, plan.Height, operation.Width, operation.Height, operation.Mode, operation.Background,
+			)
+		case OperationCrop:
+			options := CropOptions{
+				Width:   operation.Width,
+				Height:  operation.Height,
+				Gravity: operation.Gravity,
+			}
+			if operation.X != nil {
+				options.X, options.Y = *operation.X, *operation.Y
+			} else if options.Gravity == "" {
+				options.Gravity = GravityCenter
+			}
+			filter, err = CropFilter(plan.Width, plan.Height, options)
+			if err == nil {
+				plan.Width, plan.Height = options.Width, options.Height
+			}
+		case OperationRotate:
+			filter, plan.Width, plan.Height, err = RotateFilter(plan.Width, plan.Height, operation.Angle, operation.Background)
+		case OperationFlip:
+			filter, err = FlipFilter(operation.Direction)
+		case OperationAutoOrient:
+			var swap bool
+			filter, swap = OrientationFilter(orientation)
+			if swap {
+				plan.Width, plan.Height = plan.Height, plan.Width
+			}
+		case OperationCompress:
+			compressionLevel = operation.CompressionLevel
+			encoderOptions = operation.EncoderOptions
+		case OperationConvert:
+			targetFormat := NormalizeFormat(operation.Format)
+			if !CanConvert(format, targetFormat) {
+				err = fmt.Errorf("converting %s to %s is not supported", format, targetFormat)
+			}
+			plan.Format = ConvertImageFormats[targetFormat]
+		}
+		if err != nil {
+			return PipelinePlan{}, fmt.Errorf("operation %d (%s): %s", i, operation.Op, err.Error())
+		}
+		plan.Filter = joinFilters(plan.Filter, filter)
+	}
+
+	plan.OutKwargs = ffmpeg.KwArgs{
+		"f":      "image2",
+		"vcodec": plan.Format,
+	}
+	if plan.Filter != "" {
+		plan.OutKwargs["vf"] = plan.Filter
+	}
+	if compressionLevel != 0 {
+		if err := setCompressionKwargs(plan.OutKwargs, plan.Format, compressionLevel); err != nil {
+			return PipelinePlan{}, fmt.Errorf("operation compress: %s", err.Error())
+		}
+	}
+	if !encoderOptions.IsZero() {
+		if !isCompressFormat(plan.Format) {
+			return PipelinePlan{}, fmt.Errorf("operation compress: file format %s is not supported", plan.Format)
+		}
+		if err := encoderOptions.Apply(plan.OutKwargs, plan.Format); err != nil {
+			return PipelinePlan{}, fmt.Errorf("operation compress: %s", err.Error())
+		}
+	}
+	return plan, nil
+}
+
+// RunPipeline function execute the pipeline on the image stored in inBuf and write the output to outBuf
+// the whole pipeline is executed by a single ffmpeg invocation
+// it return the ffmpeg codec of the output image
+func RunPipeline(inBuf io.ReadSeeker, pipeline Pipeline, outBuf io.Writer) (string, error) {
+	return RunPipelineProgress(inBuf, pipeline, outBuf, nil)
+}
+
+// RunPipelineProgress function execute the pipeline like RunPipeline and call progress (when not nil)
+// with the percentage of the steps done: probing the source, planning the ffmpeg invocation and encoding
+func RunPipelineProgress(inBuf io.ReadSeeker, pipeline Pipeline, outBuf io.Writer, progress func(percent int)) (string, error) {
+	if progress == nil {
+		progress = func(int) {}
+	}
+	if err := pipeline.Validate(); err != nil {
+		return "", err
+	}
+
+	// Get source format, size and orientation
+	probe, err := Probe(inBuf)
+	if err != nil {
+		return "", fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	srcWidth, srcHeight, err := probe.Size()
+	if err != nil {
+		return "", err
+	}
+
+	orientation, err := GetExifOrientation(inBuf)
+	if err != nil {
+		return "", fmt.Errorf("can't read exif orientation: %s", err.Error())
+	}
+	progress(25)
+
+	plan, err := pipeline.Plan(probe.Format, srcWidth, srcHeight, orientation)
+	if err != nil {
+		return "", err
+	}
+	progress(50)
+
+	if err := runFfmpeg(inBuf, plan.OutKwargs, outBuf); err != nil {
+		return "", err
+	}
+	progress(90)
+	return plan.Format, nil
+}
+
+func isGravity(gravity string) bool {
+	for _, g := range Gravities {
+		if gravity == g {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func uint16Pointer(value uint16) *uint16 {
+	return &value
+}
+
+func TestPipelineValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name      string
+		pipeline  Pipeline
+		wantError bool
+	}{
+		{"resize", Pipeline{{Op: OperationResize, Width: 100}}, false},
+		{"resize without size", Pipeline{{Op: OperationResize, Mode: ResizeModeFit}}, true},
+		{"resize too large", Pipeline{{Op: OperationResize, Width: ResizeMaxWidth + 1}}, true},
+		{"resize invalid mode", Pipeline{{Op: OperationResize, Width: 100, Mode: "stretch"}}, true},
+		{"resize invalid background", Pipeline{{Op: OperationResize, Width: 100, Mode: ResizeModePad, Background: "red;"}}, true},
+		{"crop rectangle", Pipeline{{Op: OperationCrop, Width: 100, Height: 100, X: uint16Pointer(0), Y: uint16Pointer(0)}}, false},
+		{"crop gravity", Pipeline{{Op: OperationCrop, Width: 100, Height: 100, Gravity: GravityNorth}}, false},
+		{"crop only x", Pipeline{{Op: OperationCrop, Width: 100, Height: 100, X: uint16Pointer(0)}}, true},
+		{"crop x and gravity", Pipeline{{Op: OperationCrop, Width: 100, Height: 100, X: uint16Pointer(0), Y: uint16Pointer(0), Gravity: GravityNorth}}, true},
+		{"crop invalid gravity", Pipeline{{Op: OperationCrop, Width: 100, Height: 100, Gravity: "middle"}}, true},
+		{"crop without size", Pipeline{{Op: OperationCrop, Width: 100}}, true},
+		{"rotate", Pipeline{{Op: OperationRotate, Angle: 90}}, false},
+		{"rotate nan", Pipeline{{Op: OperationRotate, Angle: math.NaN()}}, true},
+		{"flip", Pipeline{{Op: OperationFlip, Direction: FlipBoth}}, false},
+		{"flip without direction", Pipeline{{Op: OperationFlip}}, true},
+		{"auto orient", Pipeline{{Op: OperationAutoOrient}}, false},
+		{"compress", Pipeline{{Op: OperationCompress, CompressionLevel: 5}}, false},
+		{"compress invalid level", Pipeline{{Op: OperationCompress, CompressionLevel: 6}}, true},
+		{"compress encoder options", Pipeline{{Op: OperationCompress, EncoderOptions: EncoderOptions{Quality: intPointer(80)}}}, false},
+		{"compress invalid encoder options", Pipeline{{Op: OperationCompress, CompressionLevel: 3, EncoderOptions: EncoderOptions{Method: intPointer(7)}}}, true},
+		{"compress twice", Pipeline{{Op: OperationCompress, CompressionLevel: 1}, {Op: OperationCompress, CompressionLevel: 2}}, true},
+		{"convert", Pipeline{{Op: OperationConvert, Format: "JPG"}}, false},
+		{"convert invalid format", Pipeline{{Op: OperationConvert, Format: "tga"}}, true},
+		{"convert twice", Pipeline{{Op: OperationConvert, Format: "png"}, {Op: OperationConvert, Format: "webp"}}, true},
+		{"unknown operation", Pipeline{{Op: "blur"}}, true},
+		{"empty", Pipeline{}, true},
+		{"too long", make(Pipeline, PipelineMaxOperations+1), true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestPipelineValidate %s",
+			tt.name,
+		), func(t *testing.T) {
+			err := tt.pipeline.Validate()
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+		})
+	}
+}
+
+func TestPipelinePlan(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name          string
+		format        string
+		orientation   uint16
+		pipeline      Pipeline
+		wantOutKwargs ffmpeg.KwArgs
+		wantWidth     uint16
+		wantHeight    uint16
+		wantError     bool
+	}{
+		{
+			"resize compress convert", "png", 1,
+			Pipeline{
+				{Op: OperationResize, Width: 400, Height: 400, Mode: ResizeModeFit},
+				{Op: OperationCompress, CompressionLevel: 5},
+				{Op: OperationConvert, Format: "jpg"},
+			},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "mjpeg", "vf": "scale=400:250", "q": float64(31)},
+			400, 250, false,
+		},
+		{
+			"auto orient crop rotate flip", "mjpeg", 6,
+			Pipeline{
+				{Op: OperationAutoOrient},
+				{Op: OperationCrop, Width: 625, Height: 625, Gravity: GravitySouth},
+				{Op: OperationResize, Width: 100},
+				{Op: OperationRotate, Angle: 90},
+				{Op: OperationFlip, Direction: FlipHorizontal},
+			},
+			ffmpeg.KwArgs{
+				"f":      "image2",
+				"vcodec": "mjpeg",
+				"vf":     "transpose=clock,crop=625:625:0:375,scale=100:100,transpose=clock,hflip",
+			},
+			100, 100, false,
+		},
+		{
+			"crop default gravity", "webp", 1,
+			Pipeline{{Op: OperationCrop, Width: 100, Height: 100}},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "webp", "vf": "crop=100:100:450:262"},
+			100, 100, false,
+		},
+		{
+			"convert only", "bmp", 1,
+			Pipeline{{Op: OperationConvert, Format: "png"}},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "png"},
+			1000, 625, false,
+		},
+		{
+			"crop outside image", "png", 1,
+			Pipeline{{Op: OperationCrop, Width: 100, Height: 100, X: uint16Pointer(950), Y: uint16Pointer(0)}},
+			nil, 0, 0, true,
+		},
+		{
+			"crop after resize outside image", "png", 1,
+			Pipeline{{Op: OperationResize, Width: 100}, {Op: OperationCrop, Width: 200, Height: 50}},
+			nil, 0, 0, true,
+		},
+		{
+			"compress encoder options", "png", 1,
+			Pipeline{
+				{Op: OperationResize, Width: 400},
+				{Op: OperationCompress, CompressionLevel: 1, EncoderOptions: EncoderOptions{Quality: intPointer(90), ChromaSubsampling: "444"}},
+				{Op: OperationConvert, Format: "jpeg"},
+			},
+			ffmpeg.KwArgs{"f": "image2", "vcodec": "mjpeg", "vf": "scale=400:250", "q": float64(4), "pix_fmt": "yuvj444p"},
+			400, 250, false,
+		},
+		{
+			"compress encoder options of other format", "png", 1,
+			Pipeline{{Op: OperationCompress, EncoderOptions: EncoderOptions{Lossless: true}}},
+			nil, 0, 0, true,
+		},
+		{
+			"compress bmp", "bmp", 1,
+			Pipeline{{Op: OperationCompress, CompressionLevel: 3}},
+			nil, 0, 0, true,
+		},
+		{
+			"unsupported source", "tga", 1,
+			Pipeline{{Op: OperationConvert, Format: "png"}},
+			nil, 0, 0, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestPipelinePlan %s",
+			tt.name,
+		), func(t *testing.T) {
+			plan, err := tt.pipeline.Plan(tt.format, 1000, 625, tt.orientation)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal(tt.wantOutKwargs, plan.OutKwargs)
+				assert.Equal(tt.wantWidth, plan.Width, fmt.Sprintf("got width %d, want %d", plan.Width, tt.wantWidth))
+				assert.Equal(tt.wantHeight, plan.Height, fmt.Sprintf("got height %d, want %d", plan.Height, tt.wantHeight))
+			}
+		})
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		pipeline   Pipeline
+		wantFormat string
+		wantWidth  uint16
+		wantHeight uint16
+		wantError  bool
+	}{
+		{
+			"../../test/data/test_1000x625.png",
+			Pipeline{
+				{Op: OperationResize, Width: 400, Height: 400, Mode: ResizeModeCover},
+				{Op: OperationCompress, CompressionLevel: 3},
+				{Op: OperationConvert, Format: "webp"},
+			},
+			"webp", 400, 400, false,
+		},
+		{
+			"../../test/data/test_1000x625_orientation_6.jpg",
+			Pipeline{
+				{Op: OperationAutoOrient},
+				{Op: OperationCrop, Width: 300, Height: 200, Gravity: GravityNorth},
+				{Op: OperationRotate, Angle: 270},
+			},
+			"mjpeg", 200, 300, false,
+		},
+		{
+			"../../test/data/test_1000x1000.bmp",
+			Pipeline{{Op: OperationFlip, Direction: FlipVertical}, {Op: OperationConvert, Format: "png"}},
+			"png", 1000, 1000, false,
+		},
+		{
+			"../../test/data/test_1000x1000.bmp",
+			Pipeline{{Op: OperationCompress, CompressionLevel: 3}},
+			"", 0, 0, true,
+		},
+		{
+			"../../test/data/test_1000x1000.png",
+			Pipeline{{Op: OperationCrop, Width: 1001, Height: 10}},
+			"", 0, 0, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestRunPipeline %s %d operations",
+			tt.fileName, len(tt.pipeline),
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			var progress []int
+			format, err := RunPipelineProgress(inBuf, tt.pipeline, outBuf, func(percent int) {
+				progress = append(progress, percent)
+			})
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal([]int{25, 50, 90}, progress)
+				assert.Equal(tt.wantFormat, format)
+
+				outBufReader := bytes.NewReader(outBuf.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			}
+		})
+	}
+}
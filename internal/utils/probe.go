@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	// ErrNoImageStream is returned by Probe when ffprobe doesn't find any image stream in the input
+	ErrNoImageStream = errors.New("file doesn't contain any image stream")
+	// ErrImageTooLarge is returned when the image dimensions can't be processed
+	ErrImageTooLarge = fmt.Errorf("image width and height must be <= %d", math.MaxUint16)
+)
+
+// ProbeError is returned by Probe when ffprobe can't read the input or its output can't be parsed
+type ProbeError struct {
+	Err error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("ffprobe failed: %s", e.Err.Error())
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// ProbeResult describe the first image stream of a file as reported by ffprobe
+type ProbeResult struct {
+	Format      string  // ffmpeg codec name, e.g. "mjpeg", used as format by the other functions
+	Container   string  // ffmpeg demuxer name, e.g. "png_pipe"
+	Width       int     // width in pixels
+	Height      int     // height in pixels
+	PixelFormat string  // ffmpeg pixel format, e.g. "rgba"
+	BitDepth    int     // bits per component
+	ColorSpace  string  // e.g. "bt470bg", empty when unknown
+	FrameCount  int     // 1 for still images
+	Duration    float64 // seconds, 0 for still images
+	Streams     int     // number of image streams in the file
+}
+
+// ffprobeOutput is the subset of "ffprobe -show_streams -show_format -of json" used by Probe
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecName        string `json:"codec_name"`
+		CodecType        string `json:"codec_type"`
+		Width            int    `json:"width"`
+		Height           int    `json:"height"`
+		PixFmt           string `json:"pix_fmt"`
+		BitsPerRawSample string `json:"bits_per_raw_sample"`
+		ColorSpace       string `json:"color_space"`
+		NbFrames         string `json:"nb_frames"`
+		NbReadPackets    string `json:"nb_read_packets"`
+		Duration         string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe run ffprobe on the image stored in inBuf and return its first image stream
+// the returned error is either a *ProbeError or ErrNoImageStream
+func Probe(inBuf io.Reader) (ProbeResult, error) {
+	out, err := ffmpeg.ProbeReaderWithTimeoutExec(inBuf, 0, ffmpeg.KwArgs{
+		"v":             "error",
+		"show_streams":  "",
+		"show_format":   "",
+		"count_packets": "",
+		"of":            "json",
+	})
+	if err != nil {
+		return ProbeResult{}, &ProbeError{Err: err}
+	}
+	return parseProbeOutput([]byte(out))
+}
+
+// parseProbeOutput build the ProbeResult from the JSON output of ffprobe
+func parseProbeOutput(out []byte) (ProbeResult, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return ProbeResult{}, &ProbeError{Err: fmt.Errorf("invalid output: %s", err.Error())}
+	}
+
+	var result ProbeResult
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		result.Streams++
+		if result.Streams > 1 {
+			continue
+		}
+
+		result.Format = stream.CodecName
+		result.Width = stream.Width
+		result.Height = stream.Height
+		result.PixelFormat = stream.PixFmt
+		result.BitDepth = PixelFormatBitDepth(stream.PixFmt)
+		if bitDepth, err := strconv.Atoi(stream.BitsPerRawSample); err == nil && bitDepth > 0 {
+			result.BitDepth = bitDepth
+		}
+		if stream.ColorSpace != "unknown" {
+			result.ColorSpace = stream.ColorSpace
+		}
+
+		result.FrameCount = 1
+		for _, frames := range []string{stream.NbReadPackets, stream.NbFrames} {
+			if frameCount, err := strconv.Atoi(frames); err == nil && frameCount > 0 {
+				result.FrameCount = frameCount
+				break
+			}
+		}
+		if result.FrameCount > 1 {
+			for _, duration := range []string{stream.Duration, probe.Format.Duration} {
+				if seconds, err := strconv.ParseFloat(duration, 64); err == nil && seconds > 0 {
+					result.Duration = seconds
+					break
+				}
+			}
+		}
+	}
+	if result.Streams == 0 {
+		return ProbeResult{}, ErrNoImageStream
+	}
+	result.Container = probe.Format.FormatName
+	return result, nil
+}
+
+// Size return the image size as used by the filter builders
+// ErrImageTooLarge is returned when it doesn't fit
+func (result ProbeResult) Size() (uint16, uint16, error) {
+	if result.Width < 1 || result.Height < 1 {
+		return 0, 0, fmt.Errorf("image size %dx%d is not valid", result.Width, result.Height)
+	}
+	if result.Width > math.MaxUint16 || result.Height > math.MaxUint16 {
+		return 0, 0, ErrImageTooLarge
+	}
+	return uint16(result.Width), uint16(result.Height), nil
+}
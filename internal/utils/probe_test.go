@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		wantFormat string
+		wantWidth  int
+		wantHeight int
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 1000, 1000},
+		{"../../test/data/test_1000x625.png", "png", 1000, 625},
+		{"../../test/data/test_625x1000.png", "png", 625, 1000},
+		{"../../test/data/test_1000x1000.webp", "webp", 1000, 1000},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 1000, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestProbe %s",
+			tt.fileName,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			probe, err := Probe(inBuf)
+			assert.NoError(err)
+			assert.Equal(tt.wantFormat, probe.Format)
+			assert.Equal(tt.wantWidth, probe.Width)
+			assert.Equal(tt.wantHeight, probe.Height)
+			assert.Equal(1, probe.FrameCount)
+			assert.Equal(1, probe.Streams)
+		})
+	}
+
+	t.Run("TestProbe invalid file", func(t *testing.T) {
+		inBuf, err := os.Open("../../README.md")
+		assert.NoError(err)
+		defer inBuf.Close()
+
+		_, err = Probe(inBuf)
+		var probeError *ProbeError
+		assert.True(errors.As(err, &probeError), err)
+	})
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		name       string
+		output     string
+		wantResult ProbeResult
+		wantErr    error
+	}{
+		{
+			"jpeg",
+			`{"streams":[{"codec_name":"mjpeg","codec_type":"video","width":1000,"height":625,"pix_fmt":"yuvj420p","bits_per_raw_sample":"8","color_space":"bt470bg","nb_read_packets":"1"}],
+			"format":{"format_name":"jpeg_pipe","size":"1234"}}`,
+			ProbeResult{Format: "mjpeg", Container: "jpeg_pipe", Width: 1000, Height: 625, PixelFormat: "yuvj420p", BitDepth: 8, ColorSpace: "bt470bg", FrameCount: 1, Streams: 1},
+			nil,
+		},
+		{
+			"png 16 bit without bits_per_raw_sample",
+			`{"streams":[{"codec_name":"png","codec_type":"video","width":70000,"height":10,"pix_fmt":"rgba64be","color_space":"unknown"}],"format":{"format_name":"png_pipe"}}`,
+			ProbeResult{Format: "png", Container: "png_pipe", Width: 70000, Height: 10, PixelFormat: "rgba64be", BitDepth: 16, FrameCount: 1, Streams: 1},
+			nil,
+		},
+		{
+			"animation",
+			`{"streams":[{"codec_name":"gif","codec_type":"video","width":10,"height":10,"pix_fmt":"bgra","nb_read_packets":"12","duration":"1.200000"}],"format":{"format_name":"gif","duration":"1.200000"}}`,
+			ProbeResult{Format: "gif", Container: "gif", Width: 10, Height: 10, PixelFormat: "bgra", BitDepth: 8, FrameCount: 12, Duration: 1.2, Streams: 1},
+			nil,
+		},
+		{
+			"multiple streams",
+			`{"streams":[{"codec_type":"data"},{"codec_name":"png","codec_type":"video","width":20,"height":30,"pix_fmt":"rgb24"},{"codec_name":"mjpeg","codec_type":"video","width":5,"height":5}],"format":{"format_name":"mov,mp4"}}`,
+			ProbeResult{Format: "png", Container: "mov,mp4", Width: 20, Height: 30, PixelFormat: "rgb24", BitDepth: 8, FrameCount: 1, Streams: 2},
+			nil,
+		},
+		{"no image stream", `{"streams":[{"codec_name":"mp3","codec_type":"audio"}],"format":{"format_name":"mp3"}}`, ProbeResult{}, ErrNoImageStream},
+		{"no stream", `{}`, ProbeResult{}, ErrNoImageStream},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestParseProbeOutput %s",
+			tt.name,
+		), func(t *testing.T) {
+			result, err := parseProbeOutput([]byte(tt.output))
+			assert.Equal(tt.wantErr, err)
+			assert.Equal(tt.wantResult, result)
+		})
+	}
+
+	t.Run("TestParseProbeOutput invalid json", func(t *testing.T) {
+		_, err := parseProbeOutput([]byte("1000\n625\n"))
+		var probeError *ProbeError
+		assert.True(errors.As(err, &probeError), err)
+	})
+}
+
+func TestProbeResultSize(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		width      int
+		height     int
+		wantWidth  uint16
+		wantHeight uint16
+		wantErr    bool
+	}{
+		{1000, 625, 1000, 625, false},
+		{65535, 1, 65535, 1, false},
+		{65536, 1, 0, 0, true},
+		{1, 70000, 0, 0, true},
+		{0, 10, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestProbeResultSize %dx%d",
+			tt.width, tt.height,
+		), func(t *testing.T) {
+			width, height, err := ProbeResult{Width: tt.width, Height: tt.height}.Size()
+			assert.Equal(tt.wantErr, err != nil)
+			assert.Equal(tt.wantWidth, width)
+			assert.Equal(tt.wantHeight, height)
+		})
+	}
+	_, _, err := ProbeResult{Width: 70000, Height: 1}.Size()
+	assert.ErrorIs(err, ErrImageTooLarge)
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Processing backends accepted by NewProcessor
+const (
+	BackendAuto   = "auto"   // ffmpeg when ffmpeg and ffprobe are in PATH, go otherwise
+	BackendFfmpeg = "ffmpeg" // ffmpeg and ffprobe CLI, support every format and option
+	BackendGo     = "go"     // pure Go, no external binary but a subset of the formats and options
+)
+
+var Backends = [...]string{
+	BackendAuto,
+	BackendFfmpeg,
+	BackendGo,
+}
+
+// ErrNotSupported is wrapped by the errors of the operations a backend can't handle
+var ErrNotSupported = errors.New("operation is not supported")
+
+// notSupported return the ErrNotSupported error of operation for backend
+func notSupported(operation string, backend string) error {
+	return fmt.Errorf("%s is not supported by the %s backend: %w", operation, backend, ErrNotSupported)
+}
+
+// ImageProcessor is an image processing backend, formats are ffmpeg codec names (as reported by GetImageFormat)
+type ImageProcessor interface {
+	// Name return the backend name, BackendFfmpeg or BackendGo
+	Name() string
+	// Probe return the format and size of the image stored in inBuf
+	Probe(inBuf io.ReadSeeker) (ProbeResult, error)
+	// Convert the image stored in inBuf to targetFormat (key of ConvertImageFormats), see ConvertImageWithOptions
+	Convert(inBuf io.ReadSeeker, targetFormat string, options EncoderOptions, outBuf io.Writer) error
+	// Resize the image stored in inBuf whose format is format, see ResizeImageWithMode
+	Resize(inBuf io.ReadSeeker, format string, width uint16, height uint16, mode string, background string, outBuf io.Writer) error
+	// Compress the image stored in inBuf whose format is format, see CompressImageWithOptions
+	Compress(inBuf io.ReadSeeker, format string, compressionLevel uint8, options EncoderOptions, outBuf io.Writer) error
+	// CompressToSize compress the image stored in inBuf whose format is format under maxBytes, see CompressToSize
+	CompressToSize(inBuf io.ReadSeeker, format string, maxBytes int, downscale bool, outBuf io.Writer) (TargetSizeResult, error)
+	// Crop the image stored in inBuf whose format is format, see CropImage
+	Crop(inBuf io.ReadSeeker, format string, options CropOptions, outBuf io.Writer) error
+	// Transform the image stored in inBuf whose format is format, see TransformImage
+	Transform(inBuf io.ReadSeeker, format string, options TransformOptions, outBuf io.Writer) error
+	// Thumbnail write a thumbnail of the image stored in inBuf and return its format, see ThumbnailImage
+	Thumbnail(inBuf io.ReadSeeker, options ThumbnailOptions, outBuf io.Writer) (string, error)
+	// Info return the details of the image stored in inBuf, see GetImageInfo
+	Info(inBuf io.ReadSeeker) (ImageInfo, error)
+	// Pipeline apply pipeline to the image stored in inBuf and return the output format, see RunPipelineProgress
+	Pipeline(inBuf io.ReadSeeker, pipeline Pipeline, outBuf io.Writer, progress func(percent int)) (string, error)
+	// Variants encode the srcset variants of the image stored in inBuf, see GenerateVariants
+	Variants(inBuf io.ReadSeeker, widths []uint16, formats []string) ([]Variant, error)
+}
+
+// NewProcessor return the backend named backend (one of Backends),
+// BackendAuto fall back to the go backend when ffmpeg is missing
+func NewProcessor(backend string) (ImageProcessor, error) {
+	switch backend {
+	case BackendAuto, "":
+		if FfmpegAvailable() {
+			return FfmpegProcessor{}, nil
+		}
+		return GoProcessor{}, nil
+	case BackendFfmpeg:
+		return FfmpegProcessor{}, nil
+	case BackendGo:
+		return GoProcessor{}, nil
+	}
+	return nil, fmt.Errorf("backend %s is not supported", backend)
+}
+
+// FfmpegAvailable report whether the ffmpeg and ffprobe binaries are in PATH
+func FfmpegAvailable() bool {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// FfmpegProcessor process the images with the ffmpeg CLI
+type FfmpegProcessor struct{}
+
+func (FfmpegProcessor) Name() string {
+	return BackendFfmpeg
+}
+
+func (FfmpegProcessor) Probe(inBuf io.ReadSeeker) (ProbeResult, error) {
+	return Probe(inBuf)
+}
+
+func (FfmpegProcessor) Convert(inBuf io.ReadSeeker, targetFormat string, options EncoderOptions, outBuf io.Writer) error {
+	return ConvertImageWithOptions(inBuf, targetFormat, options, outBuf)
+}
+
+func (FfmpegProcessor) Resize(inBuf io.ReadSeeker, format string, width uint16, height uint16, mode string, background string, outBuf io.Writer) error {
+	return ResizeImageWithMode(inBuf, format, width, height, mode, background, outBuf)
+}
+
+func (FfmpegProcessor) Compress(inBuf io.ReadSeeker, format string, compressionLevel uint8, options EncoderOptions, outBuf io.Writer) error {
+	return CompressImageWithOptions(inBuf, format, compressionLevel, options, outBuf)
+}
+
+func (FfmpegProcessor) CompressToSize(inBuf io.ReadSeeker, format string, maxBytes int, downscale bool, outBuf io.Writer) (TargetSizeResult, error) {
+	return CompressToSize(inBuf, format, maxBytes, downscale, outBuf)
+}
+
+func (FfmpegProcessor) Crop(inBuf io.ReadSeeker, format string, options CropOptions, outBuf io.Writer) error {
+	return CropImage(inBuf, format, options, outBuf)
+}
+
+func (FfmpegProcessor) Transform(inBuf io.ReadSeeker, format string, options TransformOptions, outBuf io.Writer) error {
+	return TransformImage(inBuf, format, options, outBuf)
+}
+
+func (FfmpegProcessor) Thumbnail(inBuf io.ReadSeeker, options ThumbnailOptions, outBuf io.Writer) (string, error) {
+	return ThumbnailImage(inBuf, options, outBuf)
+}
+
+func (FfmpegProcessor) Info(inBuf io.ReadSeeker) (ImageInfo, error) {
+	return GetImageInfo(inBuf)
+}
+
+func (FfmpegProcessor) Pipeline(inBuf io.ReadSeeker, pipeline Pipeline, outBuf io.Writer, progress func(percent int)) (string, error) {
+	return RunPipelineProgress(inBuf, pipeline, outBuf, progress)
+}
+
+func (FfmpegProcessor) Variants(inBuf io.ReadSeeker, widths []uint16, formats []string) ([]Variant, error) {
+	return GenerateVariants(inBuf, widths, formats)
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// SrcsetMaxWidths is the maximum number of widths of a srcset
+const SrcsetMaxWidths = 16
+
+// Variant is one image of a srcset
+type Variant struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+	Format string `json:"format"` // ffmpeg codec
+	Data   []byte `json:"-"`
+}
+
+// SrcsetWidths sort and deduplicate widths, widths larger than srcWidth are dropped
+// as the source is never upscaled, srcWidth is used when none is left
+func SrcsetWidths(srcWidth uint16, widths []uint16) []uint16 {
+	seen := map[uint16]bool{}
+	var result []uint16
+	for _, width := range widths {
+		if width > srcWidth || seen[width] {
+			continue
+		}
+		seen[width] = true
+		result = append(result, width)
+	}
+	if len(result) == 0 {
+		return []uint16{srcWidth}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// SrcsetFilter build the ffmpeg filter graph producing every width in every format (ffmpeg codecs)
+// from an image of srcWidth x srcHeight with the given EXIF orientation
+// the output of the graph for the i-th returned variant is labelled [o<i>]
+func SrcsetFilter(srcWidth uint16, srcHeight uint16, orientation uint16, widths []uint16, formats []string) (string, []Variant, error) {
+	orientFilter, swap := OrientationFilter(orientation)
+	if swap {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
+
+	var variants []Variant
+	var scaleFilters []string
+	for _, format := range formats {
+		for _, width := range SrcsetWidths(srcWidth, widths) {
+			filter, width, height, err := ResizeFilter(srcWidth, srcHeight, width, 0, ResizeModeFill, "")
+			if err != nil {
+				return "", nil, err
+			}
+			scaleFilters = append(scaleFilters, fmt.Sprintf("[s%d]%s[o%d]", len(variants), filter, len(variants)))
+			variants = append(variants, Variant{Width: width, Height: height, Format: format})
+		}
+	}
+
+	splitLabels := ""
+	for i := range variants {
+		splitLabels += fmt.Sprintf("[s%d]", i)
+	}
+	split := fmt.Sprintf("[0:v]%s%s", joinFilters(orientFilter, fmt.Sprintf("split=%d", len(variants))), splitLabels)
+	return strings.Join(append([]string{split}, scaleFilters...), ";"), variants, nil
+}
+
+// GenerateVariants resize the image stored in inBuf to every width in every target format
+// ("jpeg", "png", "webp", "bmp", "gif", "avif", see ConvertImage) with a single ffmpeg invocation
+// heights follow the source aspect ratio, the EXIF orientation is applied and the source is never upscaled
+// when formats is empty the source format is kept, variants are ordered by format then width
+func GenerateVariants(inBuf io.ReadSeeker, widths []uint16, formats []string) ([]Variant, error) {
+	if err := checkSrcsetWidths(widths); err != nil {
+		return nil, err
+	}
+
+	// Get source format, size and orientation
+	probe, err := Probe(inBuf)
+	if err != nil {
+		return nil, fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	srcWidth, srcHeight, err := probe.Size()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ConvertFormatMatrix[probe.Format]; !ok {
+		return nil, fmt.Errorf("file format %s is not supported", probe.Format)
+	}
+
+	orientation, err := GetExifOrientation(inBuf)
+	if err != nil {
+		return nil, fmt.Errorf("can't read exif orientation: %s", err.Error())
+	}
+
+	codecs, err := srcsetCodecs(probe.Format, formats)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, variants, err := SrcsetFilter(srcWidth, srcHeight, orientation, widths, codecs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The variants are written to temporary files as a pipe can only carry one output
+	dir, err := os.MkdirTemp("", "srcset")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := ffmpeg.Input("pipe:", ffmpeg.KwArgs{"noautorotate": ""})
+	var outputs []*ffmpeg.Stream
+	for i, variant := range variants {
+		outKwargs := ffmpeg.KwArgs{
+			"map":      fmt.Sprintf("[o%d]", i),
+			"vcodec":   variant.Format,
+			"f":        "image2",
+			"frames:v": "1",
+		}
+		if i == 0 {
+			outKwargs["filter_complex"] = filter
+		}
+		outputs = append(outputs, input.Output(filepath.Join(dir, fmt.Sprintf("%d", i)), encoderKwargs(outKwargs)))
+	}
+	err = ffmpeg.MergeOutputs(outputs...).WithInput(inBuf).Silent(true).Run()
+	if err != nil {
+		return nil, fmt.Errorf("error while transcoding: %s", err.Error())
+	}
+
+	for i := range variants {
+		variants[i].Data, err = os.ReadFile(filepath.Join(dir, fmt.Sprintf("%d", i)))
+		if err != nil {
+			return nil, fmt.Errorf("error while transcoding: %s", err.Error())
+		}
+	}
+	return variants, nil
+}
+
+// checkSrcsetWidths check the number of widths and their range
+func checkSrcsetWidths(widths []uint16) error {
+	if len(widths) < 1 || len(widths) > SrcsetMaxWidths {
+		return fmt.Errorf("between 1 and %d widths must be specified", SrcsetMaxWidths)
+	}
+	for _, width := range widths {
+		if width < 1 || width > ResizeMaxWidth {
+			return fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+		}
+	}
+	return nil
+}
+
+// srcsetCodecs return the deduplicated ffmpeg codecs of the target formats of a source encoded with format,
+// format when there is none
+func srcsetCodecs(format string, formats []string) ([]string, error) {
+	var codecs []string
+	seen := map[string]bool{}
+	for _, targetFormat := range formats {
+		normalized := NormalizeFormat(targetFormat)
+		codec, ok := ConvertImageFormats[normalized]
+		if !ok {
+			return nil, fmt.Errorf("target format %s is not supported", targetFormat)
+		}
+		if !CanConvert(format, normalized) {
+			return nil, fmt.Errorf("converting %s to %s is not supported", format, normalized)
+		}
+		if !seen[codec] {
+			seen[codec] = true
+			codecs = append(codecs, codec)
+		}
+	}
+	if len(codecs) == 0 {
+		codecs = []string{format}
+	}
+	return codecs, nil
+}
+
+// PictureHTML return a <picture> element serving the variants, name return the URL of a variant
+// every format but the last one is a <source>, the last format is the <img> fallback
+func PictureHTML(variants []Variant, name func(Variant) string, alt string, sizes string) string {
+	var formats []string
+	srcsets := map[string][]string{}
+	largest := map[string]Variant{}
+	for _, variant := range variants {
+		if _, ok := srcsets[variant.Format]; !ok {
+			formats = append(formats, variant.Format)
+		}
+		srcsets[variant.Format] = append(srcsets[variant.Format], fmt.Sprintf("%s %dw", name(variant), variant.Width))
+		if variant.Width >= largest[variant.Format].Width {
+			largest[variant.Format] = variant
+		}
+	}
+	if len(formats) == 0 {
+		return ""
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("<picture>\n")
+	for _, format := range formats[:len(formats)-1] {
+		fmt.Fprintf(
+			&builder, "  <source type=\"%s\" srcset=\"%s\" sizes=\"%s\">\n",
+			GetMimeType(format), html.EscapeString(strings.Join(srcsets[format], ", ")), html.EscapeString(sizes),
+		)
+	}
+	fallback := formats[len(formats)-1]
+	fmt.Fprintf(
+		&builder, "  <img src=\"%s\" srcset=\"%s\" sizes=\"%s\" width=\"%d\" height=\"%d\" alt=\"%s\">\n",
+		html.EscapeString(name(largest[fallback])), html.EscapeString(strings.Join(srcsets[fallback], ", ")), html.EscapeString(sizes),
+		largest[fallback].Width, largest[fallback].Height, html.EscapeString(alt),
+	)
+	builder.WriteString("</picture>\n")
+	return builder.String()
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSrcsetWidths(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		srcWidth uint16
+		widths   []uint16
+		want     []uint16
+	}{
+		{1000, []uint16{640, 320, 960}, []uint16{320, 640, 960}},
+		{1000, []uint16{320, 320, 640}, []uint16{320, 640}},
+		{1000, []uint16{320, 1280, 1000}, []uint16{320, 1000}},
+		{1000, []uint16{1280, 1920}, []uint16{1000}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSrcsetWidths %d %v",
+			tt.srcWidth, tt.widths,
+		), func(t *testing.T) {
+			assert.Equal(tt.want, SrcsetWidths(tt.srcWidth, tt.widths))
+		})
+	}
+}
+
+func TestSrcsetFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		srcWidth     uint16
+		srcHeight    uint16
+		orientation  uint16
+		widths       []uint16
+		formats      []string
+		wantFilter   string
+		wantVariants []Variant
+	}{
+		{
+			1000, 625, 1, []uint16{640, 320}, []string{"webp", "mjpeg"},
+			"[0:v]split=4[s0][s1][s2][s3];[s0]scale=320:200[o0];[s1]scale=640:400[o1];[s2]scale=320:200[o2];[s3]scale=640:400[o3]",
+			[]Variant{{320, 200, "webp", nil}, {640, 400, "webp", nil}, {320, 200, "mjpeg", nil}, {640, 400, "mjpeg", nil}},
+		},
+		{
+			1000, 625, 6, []uint16{300, 625, 1000}, []string{"png"},
+			"[0:v]transpose=clock,split=2[s0][s1];[s0]scale=300:480[o0];[s1]scale=625:1000[o1]",
+			[]Variant{{300, 480, "png", nil}, {625, 1000, "png", nil}},
+		},
+		{
+			1000, 1000, 1, []uint16{2000}, []string{"mjpeg"},
+			"[0:v]split=1[s0];[s0]scale=1000:1000[o0]",
+			[]Variant{{1000, 1000, "mjpeg", nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSrcsetFilter %dx%d %d %v %v",
+			tt.srcWidth, tt.srcHeight, tt.orientation, tt.widths, tt.formats,
+		), func(t *testing.T) {
+			filter, variants, err := SrcsetFilter(tt.srcWidth, tt.srcHeight, tt.orientation, tt.widths, tt.formats)
+			assert.NoError(err)
+			assert.Equal(tt.wantFilter, filter)
+			assert.Equal(tt.wantVariants, variants)
+		})
+	}
+}
+
+func TestPictureHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	variants := []Variant{{320, 200, "webp", nil}, {640, 400, "webp", nil}, {320, 200, "mjpeg", nil}, {640, 400, "mjpeg", nil}}
+	name := func(variant Variant) string {
+		return fmt.Sprintf("shoe-%d.%s", variant.Width, GetExtension(variant.Format))
+	}
+	assert.Equal(
+		"<picture>\n"+
+			"  <source type=\"image/webp\" srcset=\"shoe-320.webp 320w, shoe-640.webp 640w\" sizes=\"100vw\">\n"+
+			"  <img src=\"shoe-640.jpg\" srcset=\"shoe-320.jpg 320w, shoe-640.jpg 640w\" sizes=\"100vw\" width=\"640\" height=\"400\" alt=\"Red &#34;shoe&#34;\">\n"+
+			"</picture>\n",
+		PictureHTML(variants, name, `Red "shoe"`, "100vw"),
+	)
+	assert.Equal("", PictureHTML(nil, name, "", "100vw"))
+}
+
+func TestGenerateVariants(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName     string
+		widths       []uint16
+		formats      []string
+		wantVariants []Variant
+		wantErr      bool
+	}{
+		{"../../test/data/test_1000x625.png", []uint16{320, 640}, []string{"webp", "jpg"}, []Variant{{320, 200, "webp", nil}, {640, 400, "webp", nil}, {320, 200, "mjpeg", nil}, {640, 400, "mjpeg", nil}}, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", []uint16{250}, nil, []Variant{{250, 400, "mjpeg", nil}}, false},
+		{"../../test/data/test_1000x625.png", []uint16{320}, []string{"tga"}, nil, true},
+		{"../../test/data/test_1000x625.png", []uint16{0}, nil, nil, true},
+		{"../../test/data/test_1000x625.png", nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestGenerateVariants %s %v %v",
+			tt.fileName, tt.widths, tt.formats,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			variants, err := GenerateVariants(inBuf, tt.widths, tt.formats)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Len(variants, len(tt.wantVariants))
+			for i, variant := range variants {
+				want := tt.wantVariants[i]
+				assert.Equal(want.Format, variant.Format)
+				AssertImageFormatEqual(t, bytes.NewReader(variant.Data), want.Format)
+				AssertImageSizeEqual(t, bytes.NewReader(variant.Data), want.Width, want.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Quality range searched by CompressToSize, 100 is the best quality
+const (
+	QualityMin = 1
+	QualityMax = 100
+)
+
+// TargetSizeMinWidth is the smallest width CompressToSize downscale to
+const TargetSizeMinWidth = 16
+
+// TargetSizeMaxDownscales is the maximum number of downscaling steps tried by CompressToSize
+const TargetSizeMaxDownscales = 8
+
+// ErrTargetSizeUnreachable is returned when the image can't be compressed under the requested size
+var ErrTargetSizeUnreachable = errors.New("image can't be compressed under the requested size")
+
+// TargetSizeResult describe the output chosen by CompressToSize
+type TargetSizeResult struct {
+	Quality int    // quality between QualityMin and QualityMax, 0 for lossless formats (png, tiff)
+	Width   uint16 // width of the output image
+	Height  uint16 // height of the output image
+	Size    int    // size of the output image in bytes
+}
+
+// CompressToSize function compress the image stored in inBuf so the output is at most maxBytes and write it to outBuf
+// format is one of the following ("mjpeg", "png", "webp", "av1", "tiff")
+// the highest quality fitting maxBytes is binary searched, png and tiff being lossless they are only encoded with the
+// highest compression level, when downscale is true and the lowest quality is still too large the image is downscaled
+// the EXIF orientation is applied before compressing
+func CompressToSize(inBuf io.ReadSeeker, format string, maxBytes int, downscale bool, outBuf io.Writer) (TargetSizeResult, error) {
+	if maxBytes < 1 {
+		return TargetSizeResult{}, fmt.Errorf("max bytes must be positive")
+	}
+	if err := setQualityKwargs(ffmpeg.KwArgs{}, format, QualityMax); err != nil {
+		return TargetSizeResult{}, err
+	}
+
+	// Get source size and orientation
+	probe, err := Probe(inBuf)
+	if err != nil {
+		return TargetSizeResult{}, fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	srcWidth, srcHeight, err := probe.Size()
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+
+	orientFilter, swap, err := autoOrientFilter(inBuf)
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+	if swap {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
+
+	heights := map[uint16]uint16{srcWidth: srcHeight}
+	encode := func(quality int, width uint16) ([]byte, error) {
+		outKwargs := ffmpeg.KwArgs{
+			"f":      "image2",
+			"vcodec": format,
+		}
+		if err := setQualityKwargs(outKwargs, format, quality); err != nil {
+			return nil, err
+		}
+
+		filter := orientFilter
+		if width != srcWidth {
+			scaleFilter, _, height, err := ResizeFilter(srcWidth, srcHeight, width, 0, ResizeModeFill, "")
+			if err != nil {
+				return nil, err
+			}
+			heights[width] = height
+			filter = joinFilters(orientFilter, scaleFilter)
+		}
+		if filter != "" {
+			outKwargs["vf"] = filter
+		}
+
+		inBuf.Seek(0, 0)
+		buf := bytes.NewBuffer(nil)
+		if err := runFfmpeg(inBuf, outKwargs, buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	quality, width, data, err := fitSize(maxBytes, srcWidth, format != "png" && format != "tiff", downscale, encode)
+	if err != nil {
+		return TargetSizeResult{}, err
+	}
+	if _, err := outBuf.Write(data); err != nil {
+		return TargetSizeResult{}, err
+	}
+	return TargetSizeResult{Quality: quality, Width: width, Height: heights[width], Size: len(data)}, nil
+}
+
+// setQualityKwargs add the encoder options matching quality (QualityMin-QualityMax) for format to outKwargs
+func setQualityKwargs(outKwargs ffmpeg.KwArgs, format string, quality int) error {
+	switch format {
+	case "mjpeg":
+		// For JPEG we use q that range from 31 (worst) to 1 (best)
+		outKwargs["q"] = jpegQScale(quality)
+	case "webp":
+		// For WebP we use the libwebp quality that range from 0 to 100
+		outKwargs["quality"] = quality
+	case "av1":
+		// For AVIF we use crf that range from 63 (worst) to 0 (best)
+		outKwargs["crf"] = avifCrf(quality)
+	case "png":
+		// PNG is lossless, only the compression level can be chosen
+		outKwargs["compression_level"] = 9
+	case "tiff":
+		// TIFF is lossless too, deflate is its smallest compression
+		outKwargs["compression_algo"] = "deflate"
+	default:
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+	return nil
+}
+
+// fitSize search the highest quality, then the largest width when downscale is true,
+// whose output encoded by encode is at most maxBytes
+// it return the chosen quality (0 when not lossy), width and output
+func fitSize(maxBytes int, srcWidth uint16, lossy bool, downscale bool, encode func(quality int, width uint16) ([]byte, error)) (int, uint16, []byte, error) {
+	width := srcWidth
+	for step := 0; ; step++ {
+		quality, data, err := searchQuality(maxBytes, lossy, func(quality int) ([]byte, error) {
+			return encode(quality, width)
+		})
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if len(data) <= maxBytes {
+			return quality, width, data, nil
+		}
+		if !downscale || step >= TargetSizeMaxDownscales || width <= TargetSizeMinWidth {
+			return 0, 0, nil, ErrTargetSizeUnreachable
+		}
+
+		// The size is roughly proportional to the area, aim a bit lower and always shrink by at least 10%
+		scale := math.Min(math.Sqrt(float64(maxBytes)/float64(len(data)))*0.95, 0.9)
+		width = uint16(math.Max(float64(width)*scale, TargetSizeMinWidth))
+	}
+}
+
+// searchQuality binary search the highest quality whose output is at most maxBytes
+// the output of QualityMin is returned when none fit, lossless formats are encoded once with quality 0
+func searchQuality(maxBytes int, lossy bool, encode func(quality int) ([]byte, error)) (int, []byte, error) {
+	if !lossy {
+		data, err := encode(0)
+		return 0, data, err
+	}
+
+	var best []byte
+	bestQuality := QualityMin
+	low, high := QualityMin, QualityMax
+	for low <= high {
+		quality := (low + high) / 2
+		data, err := encode(quality)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(data) <= maxBytes {
+			best, bestQuality = data, quality
+			low = quality + 1
+		} else {
+			if best == nil && quality == QualityMin {
+				best = data
+			}
+			high = quality - 1
+		}
+	}
+	return bestQuality, best, nil
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEncode return an output whose size grow with the quality and the area of the image
+func fakeEncode(srcWidth uint16, lossy bool) func(quality int, width uint16) ([]byte, error) {
+	return func(quality int, width uint16) ([]byte, error) {
+		if !lossy {
+			quality = QualityMax
+		}
+		area := float64(width) * float64(width) / (float64(srcWidth) * float64(srcWidth))
+		return make([]byte, int(float64(quality*1000)*area)), nil
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		maxBytes    int
+		lossy       bool
+		downscale   bool
+		wantQuality int
+		wantWidth   uint16
+		wantErr     error
+	}{
+		{200000, true, false, 100, 1000, nil},
+		{73500, true, false, 73, 1000, nil},
+		{1000, true, false, 1, 1000, nil},
+		{999, true, false, 0, 0, ErrTargetSizeUnreachable},
+		{500, true, true, 1, 671, nil},
+		{100000, false, false, 0, 1000, nil},
+		{50000, false, false, 0, 0, ErrTargetSizeUnreachable},
+		{50000, false, true, 0, 671, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestFitSize %d lossy:%t downscale:%t",
+			tt.maxBytes, tt.lossy, tt.downscale,
+		), func(t *testing.T) {
+			quality, width, data, err := fitSize(tt.maxBytes, 1000, tt.lossy, tt.downscale, fakeEncode(1000, tt.lossy))
+			if tt.wantErr != nil {
+				assert.Equal(tt.wantErr, err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tt.wantQuality, quality)
+			assert.Equal(tt.wantWidth, width)
+			assert.LessOrEqual(len(data), tt.maxBytes)
+		})
+	}
+}
+
+func TestSearchQuality(t *testing.T) {
+	assert := assert.New(t)
+
+	encodes := 0
+	quality, data, err := searchQuality(42000, true, func(quality int) ([]byte, error) {
+		encodes++
+		return make([]byte, quality*1000), nil
+	})
+	assert.NoError(err)
+	assert.Equal(42, quality)
+	assert.Len(data, 42000)
+	assert.LessOrEqual(encodes, 7)
+
+	quality, data, err = searchQuality(10, true, func(quality int) ([]byte, error) {
+		return make([]byte, quality*1000), nil
+	})
+	assert.NoError(err)
+	assert.Equal(QualityMin, quality)
+	assert.Len(data, 1000)
+}
+
+func TestCompressToSize(t *testing.T) {
+	assert := assert.New(t)
+
+	var failTests = []struct {
+		fileName string
+		format   string
+		maxBytes int
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 0},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 100000},
+		{"../../test/data/test_1000x1000.png", "png", 100},
+	}
+
+	for _, tt := range failTests {
+		t.Run(fmt.Sprintf(
+			"TestCompressToSize case fail %s,max bytes:%d",
+			tt.format, tt.maxBytes,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			_, err = CompressToSize(inBuf, tt.format, tt.maxBytes, false, outBuf)
+			assert.Error(err)
+		})
+	}
+
+	var tests = []struct {
+		fileName  string
+		format    string
+		maxBytes  int
+		downscale bool
+	}{
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 50000, false},
+		{"../../test/data/test_1000x1000.webp", "webp", 20000, false},
+		{"../../test/data/test_1000x1000.png", "png", 20000, true},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 5000, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestCompressToSize %s,max bytes:%d,downscale:%t",
+			tt.fileName, tt.maxBytes, tt.downscale,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			result, err := CompressToSize(inBuf, tt.format, tt.maxBytes, tt.downscale, outBuf)
+			assert.NoError(err)
+			assert.LessOrEqual(outBuf.Len(), tt.maxBytes)
+			assert.Equal(outBuf.Len(), result.Size)
+			AssertImageFormatEqual(t, bytes.NewReader(outBuf.Bytes()), tt.format)
+			AssertImageSizeEqual(t, bytes.NewReader(outBuf.Bytes()), result.Width, result.Height)
+		})
+	}
+}
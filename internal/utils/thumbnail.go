@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+)
+
+// ThumbnailOptions configure ThumbnailImage
+type ThumbnailOptions struct {
+	Width      uint16 // 1 to ResizeMaxWidth
+	Height     uint16 // 1 to ResizeMaxHeight
+	Format     string // target format ("jpeg", "png", "webp"), empty string means ThumbnailFormat
+	AcceptWebp bool   // whether ThumbnailFormat may pick webp
+}
+
+// ThumbnailFormats are the target formats accepted by ThumbnailImage
+var ThumbnailFormats = []string{"jpeg", "png", "webp"}
+
+// ThumbnailFormat pick the thumbnail format of an image with the given pixel format:
+// webp when the client accept it, otherwise png to keep the transparency or jpeg
+func ThumbnailFormat(pixelFormat string, acceptWebp bool) string {
+	switch {
+	case acceptWebp:
+		return "webp"
+	case PixelFormatHasAlpha(pixelFormat):
+		return "png"
+	}
+	return "jpeg"
+}
+
+// ThumbnailCompressionLevel pick the compression level (see CompressImage) of a thumbnail,
+// small thumbnails are viewed up close so they are compressed less
+func ThumbnailCompressionLevel(width uint16, height uint16) uint8 {
+	if uint32(width)*uint32(height) <= 256*256 {
+		return 2
+	}
+	return 3
+}
+
+// ThumbnailImage function produce a width x height thumbnail of the image stored in inBuf and write it to outBuf
+// the image is auto oriented, resized with ResizeModeCover, compressed and its metadata is stripped
+// it return the ffmpeg codec of the thumbnail
+func ThumbnailImage(inBuf io.ReadSeeker, options ThumbnailOptions, outBuf io.Writer) (string, error) {
+	// Check width and height
+	if options.Width < 1 || options.Width > ResizeMaxWidth {
+		return "", fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+	}
+
+	if options.Height < 1 || options.Height > ResizeMaxHeight {
+		return "", fmt.Errorf("height must be positive and < %d", ResizeMaxHeight)
+	}
+
+	// Get source format, size and orientation
+	probe, err := Probe(inBuf)
+	if err != nil {
+		return "", fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	srcWidth, srcHeight, err := probe.Size()
+	if err != nil {
+		return "", err
+	}
+
+	orientation, err := GetExifOrientation(inBuf)
+	if err != nil {
+		return "", fmt.Errorf("can't read exif orientation: %s", err.Error())
+	}
+
+	// Check format
+	format := NormalizeFormat(options.Format)
+	if format == "" {
+		format = ThumbnailFormat(probe.PixelFormat, options.AcceptWebp)
+	}
+	if !isThumbnailFormat(format) {
+		return "", fmt.Errorf("thumbnail format %s is not supported", options.Format)
+	}
+
+	pipeline := Pipeline{
+		{Op: OperationAutoOrient},
+		{Op: OperationResize, Width: options.Width, Height: options.Height, Mode: ResizeModeCover},
+		{Op: OperationCompress, CompressionLevel: ThumbnailCompressionLevel(options.Width, options.Height)},
+		{Op: OperationConvert, Format: format},
+	}
+	plan, err := pipeline.Plan(probe.Format, srcWidth, srcHeight, orientation)
+	if err != nil {
+		return "", err
+	}
+
+	// Strip metadata and keep only the first frame of animations
+	plan.OutKwargs["map_metadata"] = "-1"
+	plan.OutKwargs["frames:v"] = "1"
+
+	if err := runFfmpeg(inBuf, plan.OutKwargs, outBuf); err != nil {
+		return "", err
+	}
+	return plan.Format, nil
+}
+
+func isThumbnailFormat(format string) bool {
+	for _, f := range ThumbnailFormats {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnailFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		pixelFormat string
+		acceptWebp  bool
+		want        string
+	}{
+		{"yuvj420p", true, "webp"},
+		{"rgba", true, "webp"},
+		{"yuvj420p", false, "jpeg"},
+		{"rgb24", false, "jpeg"},
+		{"rgba", false, "png"},
+		{"yuva420p", false, "png"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestThumbnailFormat %s %t",
+			tt.pixelFormat, tt.acceptWebp,
+		), func(t *testing.T) {
+			assert.Equal(tt.want, ThumbnailFormat(tt.pixelFormat, tt.acceptWebp))
+		})
+	}
+
+	assert.Equal(uint8(2), ThumbnailCompressionLevel(128, 128))
+	assert.Equal(uint8(2), ThumbnailCompressionLevel(256, 256))
+	assert.Equal(uint8(3), ThumbnailCompressionLevel(512, 512))
+}
+
+func TestThumbnailImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		options    ThumbnailOptions
+		wantFormat string
+		wantErr    bool
+	}{
+		{"../../test/data/test_1000x625.png", ThumbnailOptions{Width: 128, Height: 128}, "png", false},
+		{"../../test/data/test_1000x1000.jpg", ThumbnailOptions{Width: 256, Height: 128}, "mjpeg", false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", ThumbnailOptions{Width: 100, Height: 160, AcceptWebp: true}, "webp", false},
+		{"../../test/data/test_1000x1000.webp", ThumbnailOptions{Width: 64, Height: 64, Format: "jpg"}, "mjpeg", false},
+		{"../../test/data/test_1000x1000.bmp", ThumbnailOptions{Width: 64, Height: 64, Format: "bmp"}, "", true},
+		{"../../test/data/test_1000x1000.png", ThumbnailOptions{Width: 0, Height: 64}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestThumbnailImage %s %+v",
+			tt.fileName, tt.options,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			format, err := ThumbnailImage(inBuf, tt.options, outBuf)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tt.wantFormat, format)
+
+			outBufReader := bytes.NewReader(outBuf.Bytes())
+			AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			outBufReader.Seek(0, 0)
+			AssertImageSizeEqual(t, outBufReader, tt.options.Width, tt.options.Height)
+			outBufReader.Seek(0, 0)
+			assert.Equal(ImageMetadata{}, FindImageMetadata(outBuf.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// TiffCompressions maps the TIFF compressions accepted by EncoderOptions to the ffmpeg tiff encoder compression_algo
+var TiffCompressions = map[string]string{
+	"none":    "raw",
+	"lzw":     "lzw",
+	"deflate": "deflate",
+}
+
+// TiffMaxPages is the maximum number of pages read from a multi-page TIFF
+const TiffMaxPages = 1000
+
+// ErrNotTiff is returned when a TIFF page is requested from another format
+var ErrNotTiff = errors.New("image is not a TIFF")
+
+// ErrTiffTooLarge is returned when the extracted pages would copy more bytes than the TIFF holds,
+// which only happens when pages or values reference the same data
+var ErrTiffTooLarge = errors.New("TIFF pages are larger than the file")
+
+// TIFF tags whose values are offsets to the image data, with the tag holding the byte counts
+var tiffDataTags = map[uint16]uint16{
+	273: 279, // StripOffsets, StripByteCounts
+	324: 325, // TileOffsets, TileByteCounts
+}
+
+// TIFF tags pointing to other IFDs or to data that can't be relocated, they are dropped from extracted pages
+var tiffDroppedTags = map[uint16]bool{
+	330:   true, // SubIFDs
+	513:   true, // JPEGInterchangeFormat
+	514:   true, // JPEGInterchangeFormatLength
+	34665: true, // Exif IFD
+	34853: true, // GPS IFD
+	40965: true, // Interoperability IFD
+}
+
+// tiffTypeSizes maps the TIFF field types to the size of one value
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+// tiffEntry is a field of a TIFF IFD
+type tiffEntry struct {
+	tag       uint16
+	fieldType uint16
+	count     uint32
+	value     []byte // the values, inline or not
+}
+
+// isTiff report whether data start with a TIFF header
+func isTiff(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// tiffByteOrder return the byte order of the TIFF stored in data
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	if data[0] == 'I' {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// tiffIfdOffsets return the offset of every IFD (page) of the TIFF stored in data
+func tiffIfdOffsets(data []byte) ([]int, error) {
+	if !isTiff(data) || len(data) < 8 {
+		return nil, ErrNotTiff
+	}
+	byteOrder := tiffByteOrder(data)
+
+	var offsets []int
+	visited := map[int]bool{}
+	offset := int(byteOrder.Uint32(data[4:8]))
+	for offset != 0 {
+		if offset < 8 || offset+2 > len(data) || visited[offset] {
+			return nil, fmt.Errorf("invalid TIFF IFD offset %d", offset)
+		}
+		if len(offsets) >= TiffMaxPages {
+			return nil, fmt.Errorf("TIFF has more than %d pages", TiffMaxPages)
+		}
+		visited[offset] = true
+		offsets = append(offsets, offset)
+
+		next := offset + 2 + int(byteOrder.Uint16(data[offset:offset+2]))*12
+		if next+4 > len(data) {
+			return nil, fmt.Errorf("truncated TIFF IFD at offset %d", offset)
+		}
+		offset = int(byteOrder.Uint32(data[next : next+4]))
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("TIFF has no page")
+	}
+	return offsets, nil
+}
+
+// TiffPageCount return the number of pages of the TIFF stored in data
+func TiffPageCount(data []byte) (int, error) {
+	offsets, err := tiffIfdOffsets(data)
+	return len(offsets), err
+}
+
+// TiffPage return the page (starting at 1) of the multi-page TIFF stored in data as a single page TIFF
+// the IFD pointers (SubIFDs, EXIF and GPS) are dropped
+func TiffPage(data []byte, page int) ([]byte, error) {
+	offsets, err := tiffIfdOffsets(data)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || page > len(offsets) {
+		return nil, fmt.Errorf("page must between 1 <= page <= %d", len(offsets))
+	}
+	byteOrder := tiffByteOrder(data)
+
+	budget := int64(len(data))
+	return tiffPage(data, byteOrder, offsets[page-1], page, &budget)
+}
+
+// TiffPages return every page of the multi-page TIFF stored in data as single page TIFFs, see TiffPage
+// at most len(data) bytes of values and image data are copied for all the pages
+func TiffPages(data []byte) ([][]byte, error) {
+	offsets, err := tiffIfdOffsets(data)
+	if err != nil {
+		return nil, err
+	}
+	byteOrder := tiffByteOrder(data)
+
+	budget := int64(len(data))
+	pages := make([][]byte, len(offsets))
+	for i, offset := range offsets {
+		if pages[i], err = tiffPage(data, byteOrder, offset, i+1, &budget); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// tiffPage extract the page whose IFD is at offset, budget is the number of bytes that may still be copied from data
+func tiffPage(data []byte, byteOrder binary.ByteOrder, offset int, page int, budget *int64) ([]byte, error) {
+	entries, err := readTiffIfd(data, byteOrder, offset)
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %s", page, err.Error())
+	}
+	out, err := writeTiff(data, byteOrder, entries, budget)
+	if errors.Is(err, ErrTiffTooLarge) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("page %d: %s", page, err.Error())
+	}
+	return out, nil
+}
+
+// readTiffIfd read the entries of the IFD at offset, the dropped tags are skipped
+func readTiffIfd(data []byte, byteOrder binary.ByteOrder, offset int) ([]tiffEntry, error) {
+	var entries []tiffEntry
+	count := int(byteOrder.Uint16(data[offset : offset+2]))
+	for i := 0; i < count; i++ {
+		entry := data[offset+2+i*12 : offset+14+i*12]
+		tag, fieldType, valueCount := byteOrder.Uint16(entry[0:2]), byteOrder.Uint16(entry[2:4]), byteOrder.Uint32(entry[4:8])
+		typeSize, ok := tiffTypeSizes[fieldType]
+		if !ok {
+			return nil, fmt.Errorf("tag %d has unknown type %d", tag, fieldType)
+		}
+		if tiffDroppedTags[tag] {
+			continue
+		}
+
+		size := int64(typeSize) * int64(valueCount)
+		value := entry[8 : 8+min(size, 4)]
+		if size > 4 {
+			valueOffset := int64(byteOrder.Uint32(entry[8:12]))
+			if valueOffset+size > int64(len(data)) {
+				return nil, fmt.Errorf("tag %d value is out of the file", tag)
+			}
+			value = data[valueOffset : valueOffset+size]
+		}
+		entries = append(entries, tiffEntry{tag: tag, fieldType: fieldType, count: valueCount, value: value})
+	}
+	return entries, nil
+}
+
+// tiffValues read the SHORT or LONG values of entry
+func tiffValues(byteOrder binary.ByteOrder, entry tiffEntry) ([]uint32, error) {
+	values := make([]uint32, entry.count)
+	for i := range values {
+		switch entry.fieldType {
+		case 3:
+			values[i] = uint32(byteOrder.Uint16(entry.value[i*2:]))
+		case 4:
+			values[i] = byteOrder.Uint32(entry.value[i*4:])
+		default:
+			return nil, fmt.Errorf("tag %d must be SHORT or LONG", entry.tag)
+		}
+	}
+	return values, nil
+}
+
+// writeTiff write a single page TIFF made of entries, whose image data is copied from data
+// the strips (or tiles) must not overlap, the copied values and image data are subtracted from budget
+func writeTiff(data []byte, byteOrder binary.ByteOrder, entries []tiffEntry, budget *int64) ([]byte, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	byTag := map[uint16]tiffEntry{}
+	for _, entry := range entries {
+		byTag[entry.tag] = entry
+	}
+
+	// Header, then the IFD, then the values that don't fit in the entries, then the image data
+	ifdSize := 2 + len(entries)*12 + 4
+	out := make([]byte, 8+ifdSize)
+	copy(out, data[0:4])
+	byteOrder.PutUint32(out[4:8], 8)
+	byteOrder.PutUint16(out[8:10], uint16(len(entries)))
+
+	for i, entry := range entries {
+		value := entry.value
+		if countTag, ok := tiffDataTags[entry.tag]; ok {
+			// Copy every strip or tile and store their new offsets as LONG
+			offsets, err := tiffValues(byteOrder, entry)
+			if err != nil {
+				return nil, err
+			}
+			counts, err := tiffValues(byteOrder, byTag[countTag])
+			if err != nil || len(counts) != len(offsets) {
+				return nil, fmt.Errorf("tag %d doesn't match tag %d", entry.tag, countTag)
+			}
+			if err := checkTiffStrips(offsets, counts, int64(len(data))); err != nil {
+				return nil, err
+			}
+			value = make([]byte, len(offsets)*4)
+			for j := range offsets {
+				end := int64(offsets[j]) + int64(counts[j])
+				if *budget -= int64(counts[j]); *budget < 0 {
+					return nil, ErrTiffTooLarge
+				}
+				out = padTiff(out)
+				byteOrder.PutUint32(value[j*4:], uint32(len(out)))
+				out = append(out, data[offsets[j]:end]...)
+			}
+			entry.fieldType = 4
+		}
+
+		field := out[10+i*12 : 22+i*12]
+		byteOrder.PutUint16(field[0:2], entry.tag)
+		byteOrder.PutUint16(field[2:4], entry.fieldType)
+		byteOrder.PutUint32(field[4:8], entry.count)
+		if len(value) <= 4 {
+			copy(field[8:12], value)
+		} else {
+			if *budget -= int64(len(value)); *budget < 0 {
+				return nil, ErrTiffTooLarge
+			}
+			out = padTiff(out)
+			byteOrder.PutUint32(out[18+i*12:22+i*12], uint32(len(out)))
+			out = append(out, value...)
+		}
+		if len(out) > 1<<32-1 {
+			return nil, fmt.Errorf("TIFF page is larger than 4GB")
+		}
+	}
+	return out, nil
+}
+
+// checkTiffStrips check that the strips (or tiles) starting at offsets and made of counts bytes
+// are in the size bytes of the file and that none of them overlap or is repeated
+func checkTiffStrips(offsets []uint32, counts []uint32, size int64) error {
+	order := make([]int, len(offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return offsets[order[i]] < offsets[order[j]] })
+
+	var previousEnd int64
+	for _, j := range order {
+		start, end := int64(offsets[j]), int64(offsets[j])+int64(counts[j])
+		if end > size {
+			return fmt.Errorf("image data is out of the file")
+		}
+		if counts[j] == 0 {
+			continue
+		}
+		if start < previousEnd {
+			return fmt.Errorf("image data strips overlap")
+		}
+		previousEnd = end
+	}
+	return nil
+}
+
+// padTiff align the next value on a word boundary as required by TIFF
+func padTiff(out []byte) []byte {
+	if len(out)%2 == 1 {
+		return append(out, 0)
+	}
+	return out
+}
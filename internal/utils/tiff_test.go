@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multiPageTiff return an uncompressed RGB TIFF of width x height whose pages are filled with the fills bytes,
+// every page is stored in two strips
+func multiPageTiff(byteOrder binary.ByteOrder, width uint32, height uint32, fills ...byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	if byteOrder == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, byteOrder, uint16(42))
+	binary.Write(buf, byteOrder, uint32(8))
+
+	stripSize := width * height * 3 / 2
+	for i, fill := range fills {
+		// IFD, then BitsPerSample, StripOffsets and StripByteCounts values, then the strips
+		ifdOffset := uint32(buf.Len())
+		ifdSize := uint32(2 + 10*12 + 4)
+		bitsOffset := ifdOffset + ifdSize
+		offsetsOffset := bitsOffset + 6
+		countsOffset := offsetsOffset + 8
+		dataOffset := countsOffset + 8
+		next := uint32(0)
+		if i < len(fills)-1 {
+			next = dataOffset + 2*stripSize
+		}
+
+		binary.Write(buf, byteOrder, uint16(10))
+		for _, entry := range []struct {
+			tag       uint16
+			fieldType uint16
+			count     uint32
+			value     uint32
+		}{
+			{256, 4, 1, width},
+			{257, 4, 1, height},
+			{258, 3, 3, bitsOffset},
+			{259, 3, 1, 1},
+			{262, 3, 1, 2},
+			{273, 4, 2, offsetsOffset},
+			{277, 3, 1, 3},
+			{278, 4, 1, height / 2},
+			{279, 4, 2, countsOffset},
+			{34665, 4, 1, 0},
+		} {
+			binary.Write(buf, byteOrder, entry.tag)
+			binary.Write(buf, byteOrder, entry.fieldType)
+			binary.Write(buf, byteOrder, entry.count)
+			if entry.fieldType == 3 && entry.count == 1 {
+				binary.Write(buf, byteOrder, uint16(entry.value))
+				binary.Write(buf, byteOrder, uint16(0))
+			} else {
+				binary.Write(buf, byteOrder, entry.value)
+			}
+		}
+		binary.Write(buf, byteOrder, next)
+
+		binary.Write(buf, byteOrder, []uint16{8, 8, 8})
+		binary.Write(buf, byteOrder, []uint32{dataOffset, dataOffset + stripSize})
+		binary.Write(buf, byteOrder, []uint32{stripSize, stripSize})
+		buf.Write(bytes.Repeat([]byte{fill}, int(2*stripSize)))
+	}
+	return buf.Bytes()
+}
+
+func TestTiffPage(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := multiPageTiff(byteOrder, 10, 4, 0x11, 0x22, 0x33)
+
+		t.Run(fmt.Sprintf("TestTiffPage %s", byteOrder), func(t *testing.T) {
+			count, err := TiffPageCount(data)
+			assert.NoError(err)
+			assert.Equal(3, count)
+
+			pages, err := TiffPages(data)
+			assert.NoError(err)
+			assert.Len(pages, 3)
+			for i, page := range pages {
+				assert.Equal(data[0:4], page[0:4])
+
+				count, err := TiffPageCount(page)
+				assert.NoError(err)
+				assert.Equal(1, count)
+
+				entries, err := readTiffIfd(page, byteOrder, 8)
+				assert.NoError(err)
+				byTag := map[uint16]tiffEntry{}
+				for _, entry := range entries {
+					byTag[entry.tag] = entry
+				}
+				assert.NotContains(byTag, uint16(34665))
+				bitsPerSample, err := tiffValues(byteOrder, byTag[258])
+				assert.NoError(err)
+				assert.Equal([]uint32{8, 8, 8}, bitsPerSample)
+
+				offsets, err := tiffValues(byteOrder, byTag[273])
+				assert.NoError(err)
+				counts, err := tiffValues(byteOrder, byTag[279])
+				assert.NoError(err)
+				assert.Equal([]uint32{60, 60}, counts)
+				for j := range offsets {
+					assert.Equal(bytes.Repeat([]byte{byte(0x11 * (i + 1))}, 60), page[offsets[j]:offsets[j]+counts[j]])
+				}
+			}
+		})
+	}
+
+	data := multiPageTiff(binary.LittleEndian, 10, 4, 0x11, 0x22)
+	// The next IFD offset of the first page point back to it
+	loop := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(loop[8+2+10*12:], 8)
+	// StripOffsets of the first page are after its IFD and BitsPerSample values
+	stripOffsets := 8 + 2 + 10*12 + 4 + 6
+	duplicate := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(duplicate[stripOffsets+4:], binary.LittleEndian.Uint32(data[stripOffsets:]))
+	overlap := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(overlap[stripOffsets+4:], binary.LittleEndian.Uint32(data[stripOffsets:])+1)
+	// The strips of the first page cover the whole file
+	whole := bytes.Clone(data)
+	binary.LittleEndian.PutUint32(whole[stripOffsets:], 0)
+	binary.LittleEndian.PutUint32(whole[stripOffsets+4:], uint32(len(data)/2))
+	binary.LittleEndian.PutUint32(whole[stripOffsets+8:], uint32(len(data)/2))
+	binary.LittleEndian.PutUint32(whole[stripOffsets+12:], uint32(len(data)-len(data)/2))
+	var failTests = []struct {
+		name string
+		data []byte
+		page int
+	}{
+		{"page 0", data, 0},
+		{"page out of range", data, 3},
+		{"not tiff", pngWithChunk("IDAT", nil), 1},
+		{"truncated", data[:20], 1},
+		{"loop", loop, 1},
+		{"duplicate strips", duplicate, 1},
+		{"overlapping strips", overlap, 1},
+		{"larger than the file", whole, 1},
+	}
+	for _, tt := range failTests {
+		t.Run(fmt.Sprintf("TestTiffPage case fail %s", tt.name), func(t *testing.T) {
+			_, err := TiffPage(tt.data, tt.page)
+			assert.Error(err)
+		})
+	}
+
+	// The strips of the second page cover most of the file, the page alone fits but not with the first one
+	shared := bytes.Clone(data)
+	second := int(binary.LittleEndian.Uint32(data[8+2+10*12:])) + 2 + 10*12 + 4 + 6
+	binary.LittleEndian.PutUint32(shared[second:], 0)
+	binary.LittleEndian.PutUint32(shared[second+4:], uint32(len(data)/2))
+	binary.LittleEndian.PutUint32(shared[second+8:], uint32(len(data)/2))
+	binary.LittleEndian.PutUint32(shared[second+12:], uint32(len(data)/2-100))
+	t.Run("TestTiffPage case fail pages larger than the file", func(t *testing.T) {
+		_, err := TiffPage(shared, 2)
+		assert.NoError(err)
+		_, err = TiffPages(shared)
+		assert.ErrorIs(err, ErrTiffTooLarge)
+	})
+}
+
+func TestConvertTiff(t *testing.T) {
+	assert := assert.New(t)
+
+	fileName := "../../test/data/test_100x50_3_pages.tiff"
+	data, err := os.ReadFile(fileName)
+	assert.NoError(err, fmt.Sprintf("Failed to open file: %s", fileName))
+
+	var tests = []struct {
+		page         int
+		targetFormat string
+		options      EncoderOptions
+		wantFormat   string
+	}{
+		{1, "png", EncoderOptions{}, "png"},
+		{2, "jpeg", EncoderOptions{}, "mjpeg"},
+		{3, "tiff", EncoderOptions{TiffCompression: "lzw"}, "tiff"},
+		{3, "tiff", EncoderOptions{TiffCompression: "deflate"}, "tiff"},
+		{3, "tiff", EncoderOptions{TiffCompression: "none"}, "tiff"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestConvertTiff page:%d,%s,%+v",
+			tt.page, tt.targetFormat, tt.options,
+		), func(t *testing.T) {
+			page, err := TiffPage(data, tt.page)
+			assert.NoError(err)
+
+			outBuf := bytes.NewBuffer(nil)
+			err = ConvertImageWithOptions(bytes.NewReader(page), tt.targetFormat, tt.options, outBuf)
+			assert.NoError(err)
+			AssertImageFormatEqual(t, bytes.NewReader(outBuf.Bytes()), tt.wantFormat)
+			AssertImageSizeEqual(t, bytes.NewReader(outBuf.Bytes()), 100, 50)
+		})
+	}
+}
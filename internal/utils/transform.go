@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Flip directions accepted by TransformOptions.Flip
+const (
+	FlipHorizontal = "horizontal"
+	FlipVertical   = "vertical"
+	FlipBoth       = "both"
+)
+
+var FlipDirections = [...]string{
+	FlipHorizontal,
+	FlipVertical,
+	FlipBoth,
+}
+
+// TransformOptions describe the operations applied by TransformImage
+// in the following order: auto orient, rotate, flip
+type TransformOptions struct {
+	AutoOrient bool    // undo the EXIF Orientation tag
+	Rotate     float64 // clockwise angle in degrees
+	Flip       string  // one of FlipDirections, empty string means no flip
+	Background string  // colour of the uncovered area when rotating by an arbitrary angle, empty string means black
+}
+
+// OrientationFilter return the ffmpeg filter undoing the EXIF orientation
+// and whether the filter swap width and height
+func OrientationFilter(orientation uint16) (string, bool) {
+	switch orientation {
+	case 2:
+		return "hflip", false
+	case 3:
+		return "hflip,vflip", false
+	case 4:
+		return "vflip", false
+	case 5:
+		return "transpose=cclock_flip", true
+	case 6:
+		return "transpose=clock", true
+	case 7:
+		return "transpose=clock_flip", true
+	case 8:
+		return "transpose=cclock", true
+	}
+	return "", false
+}
+
+// RotateFilter build the ffmpeg filter rotating an image of srcWidth x srcHeight clockwise by angle degrees
+// and return it together with the size of the resulting image
+// multiples of 90 degrees are lossless, other angles expand the image and fill the corners with background
+func RotateFilter(srcWidth uint16, srcHeight uint16, angle float64, background string) (string, uint16, uint16, error) {
+	if math.IsNaN(angle) || math.IsInf(angle, 0) {
+		return "", 0, 0, fmt.Errorf("rotation angle must be a number")
+	}
+
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+
+	switch angle {
+	case 0:
+		return "", srcWidth, srcHeight, nil
+	case 90:
+		return "transpose=clock", srcHeight, srcWidth, nil
+	case 180:
+		return "hflip,vflip", srcWidth, srcHeight, nil
+	case 270:
+		return "transpose=cclock", srcHeight, srcWidth, nil
+	}
+
+	if background == "" {
+		background = "black"
+	}
+	if !colorRegexp.MatchString(background) {
+		return "", 0, 0, fmt.Errorf("background colour %s is not valid", background)
+	}
+
+	radians := angle * math.Pi / 180
+	sin, cos := math.Abs(math.Sin(radians)), math.Abs(math.Cos(radians))
+	width := math.Round(float64(srcWidth)*cos + float64(srcHeight)*sin)
+	height := math.Round(float64(srcWidth)*sin + float64(srcHeight)*cos)
+	if width > float64(ResizeMaxWidth) || height > float64(ResizeMaxHeight) {
+		return "", 0, 0, fmt.Errorf(
+			"rotated size %.0fx%.0f exceeds %dx%d",
+			width, height, ResizeMaxWidth, ResizeMaxHeight,
+		)
+	}
+
+	return fmt.Sprintf(
+		"rotate=%.6f:ow=%.0f:oh=%.0f:c=%s",
+		radians, width, height, background,
+	), uint16(width), uint16(height), nil
+}
+
+// FlipFilter build the ffmpeg filter flipping the image in direction (one of FlipDirections)
+func FlipFilter(direction string) (string, error) {
+	switch direction {
+	case "":
+		return "", nil
+	case FlipHorizontal:
+		return "hflip", nil
+	case FlipVertical:
+		return "vflip", nil
+	case FlipBoth:
+		return "hflip,vflip", nil
+	}
+	return "", fmt.Errorf("flip direction %s is not supported", direction)
+}
+
+// TransformFilter build the ffmpeg filter applying options to an image of srcWidth x srcHeight
+// with the given EXIF orientation and return it together with the size of the resulting image
+// an empty filter means the image is left untouched
+func TransformFilter(srcWidth uint16, srcHeight uint16, orientation uint16, options TransformOptions) (string, uint16, uint16, error) {
+	var orientFilter string
+	width, height := srcWidth, srcHeight
+
+	if options.AutoOrient {
+		var swap bool
+		orientFilter, swap = OrientationFilter(orientation)
+		if swap {
+			width, height = height, width
+		}
+	}
+
+	rotateFilter, width, height, err := RotateFilter(width, height, options.Rotate, options.Background)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	flipFilter, err := FlipFilter(options.Flip)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	return joinFilters(orientFilter, rotateFilter, flipFilter), width, height, nil
+}
+
+// TransformImage function rotate and/or flip the image stored in inBuf and write the output to outBuf
+// format is one of the following ("mjpeg", "png", "webp", "bmp", "av1", "gif", "tiff")
+func TransformImage(inBuf io.ReadSeeker, format string, options TransformOptions, outBuf io.Writer) error {
+	// Check format
+	if !isResizeFormat(format) {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+
+	// Get source size and orientation
+	srcWidth, srcHeight, err := GetImageSize(inBuf)
+	if err != nil {
+		return fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	orientation, err := GetExifOrientation(inBuf)
+	if err != nil {
+		return fmt.Errorf("can't read exif orientation: %s", err.Error())
+	}
+
+	filter, _, _, err := TransformFilter(srcWidth, srcHeight, orientation, options)
+	if err != nil {
+		return err
+	}
+	if filter == "" {
+		filter = "null"
+	}
+
+	// Transform
+	return runImageFilter(inBuf, format, filter, outBuf)
+}
+
+// autoOrientFilter return the filter undoing the EXIF orientation of the image stored in inBuf
+// and whether it swap width and height
+func autoOrientFilter(inBuf io.ReadSeeker) (string, bool, error) {
+	orientation, err := GetExifOrientation(inBuf)
+	if err != nil {
+		return "", false, fmt.Errorf("can't read exif orientation: %s", err.Error())
+	}
+	filter, swap := OrientationFilter(orientation)
+	return filter, swap, nil
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrientationFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		orientation uint16
+		wantFilter  string
+		wantSwap    bool
+	}{
+		{0, "", false},
+		{1, "", false},
+		{2, "hflip", false},
+		{3, "hflip,vflip", false},
+		{4, "vflip", false},
+		{5, "transpose=cclock_flip", true},
+		{6, "transpose=clock", true},
+		{7, "transpose=clock_flip", true},
+		{8, "transpose=cclock", true},
+		{9, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestOrientationFilter %d",
+			tt.orientation,
+		), func(t *testing.T) {
+			filter, swap := OrientationFilter(tt.orientation)
+			assert.Equal(tt.wantFilter, filter)
+			assert.Equal(tt.wantSwap, swap)
+		})
+	}
+}
+
+func TestRotateFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		angle      float64
+		background string
+		wantFilter string
+		wantWidth  uint16
+		wantHeight uint16
+		wantError  bool
+	}{
+		{0, "", "", 1000, 625, false},
+		{360, "", "", 1000, 625, false},
+		{90, "", "transpose=clock", 625, 1000, false},
+		{-270, "", "transpose=clock", 625, 1000, false},
+		{180, "", "hflip,vflip", 1000, 625, false},
+		{270, "", "transpose=cclock", 625, 1000, false},
+		{-90, "", "transpose=cclock", 625, 1000, false},
+		{45, "", "rotate=0.785398:ow=1149:oh=1149:c=black", 1149, 1149, false},
+		{30, "white", "rotate=0.523599:ow=1179:oh=1041:c=white", 1179, 1041, false},
+		{30, "white:x", "", 0, 0, true},
+		{math.NaN(), "", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestRotateFilter %.0f",
+			tt.angle,
+		), func(t *testing.T) {
+			filter, width, height, err := RotateFilter(1000, 625, tt.angle, tt.background)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal(tt.wantFilter, filter)
+				assert.Equal(tt.wantWidth, width, fmt.Sprintf("got width %d, want %d", width, tt.wantWidth))
+				assert.Equal(tt.wantHeight, height, fmt.Sprintf("got height %d, want %d", height, tt.wantHeight))
+			}
+		})
+	}
+
+	// Rotated image exceeding the maximum size
+	_, _, _, err := RotateFilter(ResizeMaxWidth, ResizeMaxHeight, 45, "")
+	assert.Error(err)
+}
+
+func TestFlipFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		direction  string
+		wantFilter string
+		wantError  bool
+	}{
+		{"", "", false},
+		{FlipHorizontal, "hflip", false},
+		{FlipVertical, "vflip", false},
+		{FlipBoth, "hflip,vflip", false},
+		{"diagonal", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestFlipFilter %s",
+			tt.direction,
+		), func(t *testing.T) {
+			filter, err := FlipFilter(tt.direction)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.wantFilter, filter)
+		})
+	}
+}
+
+func TestTransformFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		orientation uint16
+		options     TransformOptions
+		wantFilter  string
+		wantWidth   uint16
+		wantHeight  uint16
+		wantError   bool
+	}{
+		{6, TransformOptions{}, "", 1000, 625, false},
+		{6, TransformOptions{AutoOrient: true}, "transpose=clock", 625, 1000, false},
+		{6, TransformOptions{AutoOrient: true, Rotate: 90}, "transpose=clock,transpose=clock", 1000, 625, false},
+		{1, TransformOptions{AutoOrient: true, Flip: FlipHorizontal}, "hflip", 1000, 625, false},
+		{3, TransformOptions{AutoOrient: true, Rotate: 270, Flip: FlipVertical}, "hflip,vflip,transpose=cclock,vflip", 625, 1000, false},
+		{1, TransformOptions{Flip: "diagonal"}, "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestTransformFilter %d %+v",
+			tt.orientation, tt.options,
+		), func(t *testing.T) {
+			filter, width, height, err := TransformFilter(1000, 625, tt.orientation, tt.options)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal(tt.wantFilter, filter)
+				assert.Equal(tt.wantWidth, width, fmt.Sprintf("got width %d, want %d", width, tt.wantWidth))
+				assert.Equal(tt.wantHeight, height, fmt.Sprintf("got height %d, want %d", height, tt.wantHeight))
+			}
+		})
+	}
+}
+
+func TestTransformImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		format     string
+		options    TransformOptions
+		wantWidth  uint16
+		wantHeight uint16
+		wantError  bool
+	}{
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: 90}, 625, 1000, false},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: 180, Flip: FlipBoth}, 1000, 625, false},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Rotate: 45, Background: "none"}, 1149, 1149, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", TransformOptions{Flip: FlipHorizontal}, 1000, 1000, false},
+		{"../../test/data/test_1000x1000.webp", "webp", TransformOptions{Rotate: 270}, 1000, 1000, false},
+		{"../../test/data/test_1000x1000.bmp", "bmp", TransformOptions{Flip: FlipVertical}, 1000, 1000, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", TransformOptions{AutoOrient: true}, 625, 1000, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", TransformOptions{}, 1000, 625, false},
+		{"../../test/data/test_1000x625.png", "png", TransformOptions{Flip: "diagonal"}, 0, 0, true},
+		{"../../test/data/test_1000x625.png", "gif", TransformOptions{Rotate: 90}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestTransformImage %s %+v",
+			tt.fileName, tt.options,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = TransformImage(inBuf, tt.format, tt.options, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				outBufReader := bytes.NewReader(outBuf.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.format)
+			}
+		})
+	}
+}
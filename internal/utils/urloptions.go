@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NoPathOptions is the options segment serving the source untouched (apart from the EXIF orientation)
+const NoPathOptions = "-"
+
+// ParsePathOptions parse the options segment of a URL driven transformation
+// into a Pipeline, options are separated by "," and their arguments by ":"
+//
+//	rs:<mode>:<width>:<height>	resize, mode, width and height may be empty (see ResizeImageWithMode)
+//	w:<width>			resize width
+//	h:<height>			resize height
+//	m:<mode>			resize mode
+//	bg:<colour>			background colour used by the pad resize mode
+//	c:<width>:<height>[:<gravity>]	crop anchored with gravity, default center (see CropImage)
+//	q:<level>			compression level 1-5 (see CompressImage)
+//	f:<format>			output format (see ConvertImage)
+//
+// e.g. "rs:fit:300:200,q:3,f:webp"
+// the resulting pipeline always apply the EXIF orientation first then crop, resize, compress and convert
+func ParsePathOptions(options string) (Pipeline, error) {
+	pipeline := Pipeline{{Op: OperationAutoOrient}}
+	if options == NoPathOptions {
+		return pipeline, nil
+	}
+
+	var crop, resize, compress, convert *Operation
+	for _, option := range strings.Split(options, ",") {
+		args := strings.Split(option, ":")
+		name, args := args[0], args[1:]
+
+		var err error
+		switch name {
+		case "rs", "resize":
+			if len(args) < 1 || len(args) > 3 {
+				return nil, fmt.Errorf("option %s: expected rs:<mode>:<width>:<height>", option)
+			}
+			if resize == nil {
+				resize = &Operation{Op: OperationResize}
+			}
+			resize.Mode = args[0]
+			if len(args) > 1 {
+				resize.Width, err = parsePathOptionSize(args[1])
+			}
+			if err == nil && len(args) > 2 {
+				resize.Height, err = parsePathOptionSize(args[2])
+			}
+		case "w", "width", "h", "height", "m", "mode", "bg", "background":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("option %s: expected %s:<value>", option, name)
+			}
+			if resize == nil {
+				resize = &Operation{Op: OperationResize}
+			}
+			switch name {
+			case "w", "width":
+				resize.Width, err = parsePathOptionSize(args[0])
+			case "h", "height":
+				resize.Height, err = parsePathOptionSize(args[0])
+			case "m", "mode":
+				resize.Mode = args[0]
+			default:
+				resize.Background = args[0]
+			}
+		case "c", "crop":
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("option %s: expected c:<width>:<height>[:<gravity>]", option)
+			}
+			crop = &Operation{Op: OperationCrop, Gravity: GravityCenter}
+			crop.Width, err = parsePathOptionSize(args[0])
+			if err == nil {
+				crop.Height, err = parsePathOptionSize(args[1])
+			}
+			if len(args) > 2 && args[2] != "" {
+				crop.Gravity = args[2]
+			}
+		case "q", "quality":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("option %s: expected q:<level>", option)
+			}
+			var level uint64
+			level, err = strconv.ParseUint(args[0], 10, 8)
+			compress = &Operation{Op: OperationCompress, CompressionLevel: uint8(level)}
+		case "f", "format":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("option %s: expected f:<format>", option)
+			}
+			convert = &Operation{Op: OperationConvert, Format: args[0]}
+		default:
+			return nil, fmt.Errorf("option %s is not supported", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("option %s: %s", option, err.Error())
+		}
+	}
+
+	for _, operation := range []*Operation{crop, resize, compress, convert} {
+		if operation != nil {
+			pipeline = append(pipeline, *operation)
+		}
+	}
+	if err := pipeline.Validate(); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+// parsePathOptionSize parse a width or height, empty string means 0 (derived from the aspect ratio)
+func parsePathOptionSize(value string) (uint16, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", value)
+	}
+	return uint16(size), nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePathOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	autoOrient := Operation{Op: OperationAutoOrient}
+
+	var tests = []struct {
+		options      string
+		wantPipeline Pipeline
+		wantError    bool
+	}{
+		{NoPathOptions, Pipeline{autoOrient}, false},
+		{"rs:fit:300:200", Pipeline{autoOrient, {Op: OperationResize, Mode: ResizeModeFit, Width: 300, Height: 200}}, false},
+		{"rs:cover:300", Pipeline{autoOrient, {Op: OperationResize, Mode: ResizeModeCover, Width: 300}}, false},
+		{"rs::300:200", Pipeline{autoOrient, {Op: OperationResize, Width: 300, Height: 200}}, false},
+		{"w:300", Pipeline{autoOrient, {Op: OperationResize, Width: 300}}, false},
+		{"h:200,m:pad,bg:white", Pipeline{autoOrient, {Op: OperationResize, Mode: ResizeModePad, Height: 200, Background: "white"}}, false},
+		{
+			"f:webp,q:3,w:300,c:500:400:north",
+			Pipeline{
+				autoOrient,
+				{Op: OperationCrop, Width: 500, Height: 400, Gravity: GravityNorth},
+				{Op: OperationResize, Width: 300},
+				{Op: OperationCompress, CompressionLevel: 3},
+				{Op: OperationConvert, Format: "webp"},
+			},
+			false,
+		},
+		{"c:500:400", Pipeline{autoOrient, {Op: OperationCrop, Width: 500, Height: 400, Gravity: GravityCenter}}, false},
+		{"rs:fit", nil, true},
+		{"rs:fit:300:200:1", nil, true},
+		{"w:abc", nil, true},
+		{"w:70000", nil, true},
+		{"w:5000", nil, true},
+		{"m:stretch,w:300", nil, true},
+		{"c:500", nil, true},
+		{"c:500:400:middle", nil, true},
+		{"q:6", nil, true},
+		{"q:-1", nil, true},
+		{"f:tga", nil, true},
+		{"blur:5", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestParsePathOptions %s",
+			tt.options,
+		), func(t *testing.T) {
+			pipeline, err := ParsePathOptions(tt.options)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+			assert.Equal(tt.wantPipeline, pipeline)
+		})
+	}
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"fmt"
 	"io"
-	"strconv"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	ffmpeg "github.com/u2takey/ffmpeg-go"
@@ -17,46 +20,135 @@ var FfmpegResizeImageFormats = [...]string{
 	"png",
 	"webp",
 	"bmp",
+	"av1",
+	"gif",
+	"tiff",
 }
 
+// Resize modes accepted by ResizeImageWithMode
+const (
+	ResizeModeFill  = "fill"  // stretch to exactly width x height
+	ResizeModeFit   = "fit"   // fit inside width x height keeping aspect ratio
+	ResizeModeCover = "cover" // cover width x height keeping aspect ratio then crop the overflow
+	ResizeModePad   = "pad"   // fit inside width x height then pad the rest with background colour
+)
+
+var ResizeModes = [...]string{
+	ResizeModeFill,
+	ResizeModeFit,
+	ResizeModeCover,
+	ResizeModePad,
+}
+
+// colorRegexp match colours accepted by ffmpeg that are safe to embed in a filter graph
+// e.g. "black", "#ff0000", "0xff000080"
+var colorRegexp = regexp.MustCompile(`^([a-zA-Z]+|(#|0x)?[0-9a-fA-F]{6}([0-9a-fA-F]{2})?)$`)
+
 var FfmpegCompressImageFormats = [...]string{
 	"mjpeg",
 	"png",
 	"webp",
+	"av1",
+	"tiff",
+}
+
+// AvifEncoder is the ffmpeg encoder of the AVIF images, whose codec is reported as "av1"
+const AvifEncoder = "libaom-av1"
+
+// AvifDefaultSpeed is the libaom cpu-used (0 slowest to 8 fastest) used when no compression level is given,
+// libaom default to the slowest one which is far too slow for a web service
+const AvifDefaultSpeed = 6
+
+// ConvertImageFormats maps every target format accepted by ConvertImage to the
+// ffmpeg codec used to encode it
+var ConvertImageFormats = map[string]string{
+	"jpeg": "mjpeg",
+	"png":  "png",
+	"webp": "webp",
+	"bmp":  "bmp",
+	"gif":  "gif",
+	"avif": "av1",
+	"tiff": "tiff",
+}
+
+// ConvertFormatMatrix declares which target formats (keys of ConvertImageFormats)
+// each source format (as reported by GetImageFormat) can be converted to
+var ConvertFormatMatrix = map[string][]string{
+	"mjpeg": {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"png":   {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"webp":  {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"bmp":   {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"gif":   {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"av1":   {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
+	"tiff":  {"jpeg", "png", "webp", "bmp", "gif", "avif", "tiff"},
 }
 
 func Mapfloat64(x float64, inMin float64, inMax float64, outMin float64, outMax float64) float64 {
 	return (x-inMin)*(outMax-outMin)/(inMax-inMin) + outMin
 }
 
+// GetImageFormat return the ffmpeg codec of the image stored in inBuf (see Probe)
 func GetImageFormat(inBuf io.Reader) (string, error) {
-	format, err := ffmpeg.ProbeReaderWithTimeoutExec(inBuf, 0, ffmpeg.KwArgs{
-		"v":            "error",
-		"show_entries": "stream=codec_name",
-		"of":           "default=noprint_wrappers=1:nokey=1",
-	})
-	return strings.TrimSuffix(format, "\r\n"), err
+	probe, err := Probe(inBuf)
+	if err != nil {
+		return "", err
+	}
+	return probe.Format, nil
 }
 
+// GetImageSize return the width and height of the image stored in inBuf (see Probe)
 func GetImageSize(inBuf io.Reader) (uint16, uint16, error) {
-	size, err := ffmpeg.ProbeReaderWithTimeoutExec(inBuf, 0, ffmpeg.KwArgs{
-		"v":            "error",
-		"show_entries": "stream=width,height",
-		"of":           "default=noprint_wrappers=1:nokey=1",
-	})
+	probe, err := Probe(inBuf)
 	if err != nil {
 		return 0, 0, err
 	}
-	sizeSlice := strings.Split(strings.TrimSuffix(size, "\r\n"), "\r\n")
-	width, err := strconv.ParseInt(sizeSlice[0], 10, 32)
-	if err != nil {
-		return 0, 0, err
+	return probe.Size()
+}
+
+// NormalizeFormat lowercase the user supplied target format and resolve aliases
+// (e.g. "jpg") to the keys used by ConvertImageFormats
+func NormalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
 	}
-	height, err := strconv.ParseInt(sizeSlice[1], 10, 32)
-	if err != nil {
-		return 0, 0, err
+	return format
+}
+
+// GetMimeType return the mimetype of an image encoded with format (as reported by GetImageFormat)
+func GetMimeType(format string) string {
+	switch format {
+	case "mjpeg":
+		return "image/jpeg"
+	case "av1":
+		return "image/avif"
+	}
+	return fmt.Sprintf("image/%s", format)
+}
+
+// GetExtension return the file extension (without dot) of an image encoded with format (as reported by GetImageFormat)
+func GetExtension(format string) string {
+	switch format {
+	case "mjpeg":
+		return "jpg"
+	case "av1":
+		return "avif"
 	}
-	return uint16(width), uint16(height), err
+	return format
+}
+
+// CanConvert report whether ConvertFormatMatrix allow converting format
+// (as reported by GetImageFormat) to targetFormat
+func CanConvert(format string, targetFormat string) bool {
+	for _, allowedFormat := range ConvertFormatMatrix[format] {
+		if allowedFormat == targetFormat {
+			return true
+		}
+	}
+	return false
 }
 
 func ConvertPngToJpeg(inBuf io.ReadSeeker, outBuf io.Writer) error {
@@ -71,27 +163,59 @@ func ConvertPngToJpeg(inBuf io.ReadSeeker, outBuf io.Writer) error {
 	inBuf.Seek(0, 0)
 
 	// Convert to JPG
-	err = ffmpeg.
-		Input("pipe:").
-		WithInput(inBuf).
-		Output("pipe:", ffmpeg.KwArgs{
-			"vcodec": "mjpeg",
-			"f":      "image2",
-		}).
-		WithOutput(outBuf). //, os.Stdout).
-		Silent(true).
-		Run()
+	return convertImage(inBuf, format, "jpeg", EncoderOptions{}, outBuf)
+}
+
+// ConvertImage function convert the image stored in inBuf to targetFormat and write the output to outBuf
+// targetFormat is one of the keys of ConvertImageFormats ("jpeg", "png", "webp", "bmp", "gif", "avif", "tiff")
+// the source format is probed and must be allowed by ConvertFormatMatrix
+func ConvertImage(inBuf io.ReadSeeker, targetFormat string, outBuf io.Writer) error {
+	return ConvertImageWithOptions(inBuf, targetFormat, EncoderOptions{}, outBuf)
+}
+
+// ConvertImageWithOptions function convert the image stored in inBuf like ConvertImage
+// and configure the encoder of the target format with options
+func ConvertImageWithOptions(inBuf io.ReadSeeker, targetFormat string, options EncoderOptions, outBuf io.Writer) error {
+	format, err := GetImageFormat(inBuf)
 	if err != nil {
-		return fmt.Errorf("error while transcoding: %s", err.Error())
+		return fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
 	}
-	return err
+	inBuf.Seek(0, 0)
+
+	return convertImage(inBuf, format, NormalizeFormat(targetFormat), options, outBuf)
+}
+
+func convertImage(inBuf io.ReadSeeker, format string, targetFormat string, options EncoderOptions, outBuf io.Writer) error {
+	// Check format
+	codec, ok := ConvertImageFormats[targetFormat]
+	if !ok {
+		return fmt.Errorf("target format %s is not supported", targetFormat)
+	}
+	if _, ok := ConvertFormatMatrix[format]; !ok {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+	if !CanConvert(format, targetFormat) {
+		return fmt.Errorf("converting %s to %s is not supported", format, targetFormat)
+	}
+
+	outKwargs := ffmpeg.KwArgs{
+		"vcodec": codec,
+		"f":      "image2",
+	}
+	if err := options.Apply(outKwargs, codec); err != nil {
+		return err
+	}
+
+	// Convert
+	return runFfmpeg(inBuf, outKwargs, outBuf)
 }
 
 // ResizeImage function resize the image stored in inBuf and write the output to outBuf
-// format is one of the following ("mjpeg", "png", "webp", "bmp")
+// format is one of the following ("mjpeg", "png", "webp", "bmp", "av1", "gif", "tiff")
 // width is value between 1 to 4096 (ResizeMaxWidth)
 // height is value between 1 to 4096 (ResizeMaxHeight)
-func ResizeImage(inBuf io.Reader, format string, width uint16, height uint16, outBuf io.Writer) error {
+// the EXIF orientation is applied before resizing
+func ResizeImage(inBuf io.ReadSeeker, format string, width uint16, height uint16, outBuf io.Writer) error {
 	// Check width and height
 	if width < 1 || width > ResizeMaxWidth {
 		return fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
@@ -102,26 +226,260 @@ func ResizeImage(inBuf io.Reader, format string, width uint16, height uint16, ou
 	}
 
 	// Check format
-	formatFound := false
+	if !isResizeFormat(format) {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+
+	orientFilter, _, err := autoOrientFilter(inBuf)
+	if err != nil {
+		return err
+	}
+
+	// Resize
+	return runImageFilter(inBuf, format, joinFilters(orientFilter, fmt.Sprintf("scale=%d:%d", width, height)), outBuf)
+}
+
+// ResizeImageWithMode function resize the image stored in inBuf according to mode and write the output to outBuf
+// format is one of the following ("mjpeg", "png", "webp", "bmp", "av1", "gif", "tiff")
+// width and height are values between 0 to 4096 (ResizeMaxWidth, ResizeMaxHeight),
+// when one of them is 0 it is derived from the source aspect ratio
+// mode is one of ResizeModes, empty string means ResizeModeFill
+// background is the colour used by ResizeModePad, empty string means black
+// the EXIF orientation is applied before resizing
+func ResizeImageWithMode(inBuf io.ReadSeeker, format string, width uint16, height uint16, mode string, background string, outBuf io.Writer) error {
+	// Check width and height
+	if width == 0 && height == 0 {
+		return fmt.Errorf("width or height must be specified")
+	}
+
+	if width > ResizeMaxWidth {
+		return fmt.Errorf("width must be positive and < %d", ResizeMaxWidth)
+	}
+
+	if height > ResizeMaxHeight {
+		return fmt.Errorf("height must be positive and < %d", ResizeMaxHeight)
+	}
+
+	// Check format
+	if !isResizeFormat(format) {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+
+	// Get source size
+	srcWidth, srcHeight, err := GetImageSize(inBuf)
+	if err != nil {
+		return fmt.Errorf("can't probe file, make sure the file is valid image: %s", err.Error())
+	}
+	inBuf.Seek(0, 0)
+
+	orientFilter, swap, err := autoOrientFilter(inBuf)
+	if err != nil {
+		return err
+	}
+	if swap {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
+
+	filter, _, _, err := ResizeFilter(srcWidth, srcHeight, width, height, mode, background)
+	if err != nil {
+		return err
+	}
+
+	// Resize
+	return runImageFilter(inBuf, format, joinFilters(orientFilter, filter), outBuf)
+}
+
+// ResizeFilter build the ffmpeg filter resizing an image of srcWidth x srcHeight according to mode
+// and return it together with the size of the resulting image
+// when width or height is 0 it is derived from the source aspect ratio
+func ResizeFilter(srcWidth uint16, srcHeight uint16, width uint16, height uint16, mode string, background string) (string, uint16, uint16, error) {
+	geometry, err := resizeGeometryOf(srcWidth, srcHeight, width, height, mode, background)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	filter := fmt.Sprintf("scale=%d:%d", geometry.scaleWidth, geometry.scaleHeight)
+	switch mode {
+	case ResizeModePad:
+		filter = fmt.Sprintf(
+			"%s,pad=%d:%d:%d:%d:color=%s",
+			filter, geometry.width, geometry.height,
+			(geometry.width-geometry.scaleWidth)/2, (geometry.height-geometry.scaleHeight)/2, geometry.background,
+		)
+	case ResizeModeCover:
+		filter = fmt.Sprintf("crop=%d:%d,%s", geometry.cropWidth, geometry.cropHeight, filter)
+	}
+	return filter, geometry.width, geometry.height, nil
+}
+
+// resizeGeometry describe a resize: the centered crop of the source, its scaled size
+// and the size of the output, larger than the scaled size when it is padded with background
+type resizeGeometry struct {
+	cropWidth   uint16
+	cropHeight  uint16
+	scaleWidth  uint16
+	scaleHeight uint16
+	width       uint16
+	height      uint16
+	background  string
+}
+
+// resizeGeometryOf compute the geometry of resizing an image of srcWidth x srcHeight according to mode,
+// see ResizeFilter
+func resizeGeometryOf(srcWidth uint16, srcHeight uint16, width uint16, height uint16, mode string, background string) (resizeGeometry, error) {
+	if srcWidth == 0 || srcHeight == 0 {
+		return resizeGeometry{}, fmt.Errorf("source size must be positive")
+	}
+
+	if mode == "" {
+		mode = ResizeModeFill
+	}
+	if !isResizeMode(mode) {
+		return resizeGeometry{}, fmt.Errorf("resize mode %s is not supported", mode)
+	}
+
+	if background == "" {
+		background = "black"
+	}
+	if !colorRegexp.MatchString(background) {
+		return resizeGeometry{}, fmt.Errorf("background colour %s is not valid", background)
+	}
+
+	// Derive missing dimension from the source aspect ratio
+	if width == 0 && height == 0 {
+		return resizeGeometry{}, fmt.Errorf("width or height must be specified")
+	} else if width == 0 {
+		derived, err := scaleDimension(srcWidth, float64(height)/float64(srcHeight), ResizeMaxWidth)
+		if err != nil {
+			return resizeGeometry{}, fmt.Errorf("derived width %s", err.Error())
+		}
+		width = derived
+	} else if height == 0 {
+		derived, err := scaleDimension(srcHeight, float64(width)/float64(srcWidth), ResizeMaxHeight)
+		if err != nil {
+			return resizeGeometry{}, fmt.Errorf("derived height %s", err.Error())
+		}
+		height = derived
+	}
+
+	geometry := resizeGeometry{
+		cropWidth: srcWidth, cropHeight: srcHeight,
+		scaleWidth: width, scaleHeight: height,
+		width: width, height: height,
+		background: background,
+	}
+	widthRatio := float64(width) / float64(srcWidth)
+	heightRatio := float64(height) / float64(srcHeight)
+
+	switch mode {
+	case ResizeModeFit, ResizeModePad:
+		ratio := math.Min(widthRatio, heightRatio)
+		geometry.scaleWidth, _ = scaleDimension(srcWidth, ratio, width)
+		geometry.scaleHeight, _ = scaleDimension(srcHeight, ratio, height)
+		if mode == ResizeModeFit {
+			geometry.width, geometry.height = geometry.scaleWidth, geometry.scaleHeight
+		}
+	case ResizeModeCover:
+		// Crop the source to the target aspect ratio first so the
+		// intermediate image is never larger than the source
+		if widthRatio < heightRatio {
+			geometry.cropWidth, _ = scaleDimension(srcHeight, float64(width)/float64(height), srcWidth)
+		} else {
+			geometry.cropHeight, _ = scaleDimension(srcWidth, float64(height)/float64(width), srcHeight)
+		}
+	}
+	return geometry, nil
+}
+
+// scaleDimension multiply size by ratio, rounding to the nearest pixel between 1 and max
+func scaleDimension(size uint16, ratio float64, max uint16) (uint16, error) {
+	scaled := math.Round(float64(size) * ratio)
+	if scaled > float64(max) {
+		return 0, fmt.Errorf("%.0f exceeds %d", scaled, max)
+	}
+	if scaled < 1 {
+		scaled = 1
+	}
+	return uint16(scaled), nil
+}
+
+func isResizeFormat(format string) bool {
 	for _, ffmpegFormat := range FfmpegResizeImageFormats {
 		if format == ffmpegFormat {
-			formatFound = true
-			break
+			return true
 		}
 	}
-	if !formatFound {
-		return fmt.Errorf("file format %s is not supported", format)
+	return false
+}
+
+func isResizeMode(mode string) bool {
+	for _, resizeMode := range ResizeModes {
+		if mode == resizeMode {
+			return true
+		}
 	}
+	return false
+}
 
-	// Resize
-	err := ffmpeg.
-		Input("pipe:").
+// joinFilters chain the non empty ffmpeg filters
+func joinFilters(filters ...string) string {
+	var nonEmpty []string
+	for _, filter := range filters {
+		if filter != "" {
+			nonEmpty = append(nonEmpty, filter)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+// runImageFilter apply the ffmpeg filter to the image stored in inBuf and
+// write the output encoded with format to outBuf
+func runImageFilter(inBuf io.ReadSeeker, format string, filter string, outBuf io.Writer) error {
+	return runFfmpeg(inBuf, ffmpeg.KwArgs{
+		"vf":     filter,
+		"vcodec": format,
+		"f":      "image2",
+	}, outBuf)
+}
+
+// encoderKwargs return a copy of outKwargs whose codec ("vcodec") is translated to the encoder and muxer
+// producing an image file: AVIF ("av1") is encoded by AvifEncoder and written by the avif muxer
+func encoderKwargs(outKwargs ffmpeg.KwArgs) ffmpeg.KwArgs {
+	kwargs := ffmpeg.KwArgs{}
+	for key, value := range outKwargs {
+		kwargs[key] = value
+	}
+	if kwargs["vcodec"] == "av1" {
+		kwargs["vcodec"] = AvifEncoder
+		kwargs["f"] = "avif"
+		if _, ok := kwargs["cpu-used"]; !ok {
+			kwargs["cpu-used"] = AvifDefaultSpeed
+		}
+	}
+	return kwargs
+}
+
+// runFfmpeg transcode the image stored in inBuf with outKwargs and write the output to outBuf
+// orientation is handled by the callers so ffmpeg must not rotate the input on its own
+// every frame of animated GIF and WebP is kept when the output format can be animated, see setAnimationKwargs
+func runFfmpeg(inBuf io.ReadSeeker, outKwargs ffmpeg.KwArgs, outBuf io.Writer) error {
+	animation, animated, err := GetAnimation(inBuf)
+	if err != nil {
+		return err
+	}
+
+	outKwargs = encoderKwargs(outKwargs)
+	if animated {
+		setAnimationKwargs(outKwargs, animation)
+	}
+	if outKwargs["f"] == "avif" {
+		return runFfmpegSeekable(inBuf, outKwargs, outBuf)
+	}
+
+	err = ffmpeg.
+		Input("pipe:", ffmpeg.KwArgs{"noautorotate": ""}).
 		WithInput(inBuf).
-		Output("pipe:", ffmpeg.KwArgs{
-			"vf":     fmt.Sprintf("scale=%d:%d", width, height),
-			"vcodec": format,
-			"f":      "image2",
-		}).
+		Output("pipe:", outKwargs).
 		WithOutput(outBuf). //, os.Stdout)
 		Silent(true).
 		Run()
@@ -131,19 +489,88 @@ func ResizeImage(inBuf io.Reader, format string, width uint16, height uint16, ou
 	return err
 }
 
+// runFfmpegSeekable is runFfmpeg for the muxers that seek back in their output (avif),
+// the output is written to a temporary file then copied to outBuf
+func runFfmpegSeekable(inBuf io.Reader, outKwargs ffmpeg.KwArgs, outBuf io.Writer) error {
+	dir, err := os.MkdirTemp("", "ffmpeg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	outPath := filepath.Join(dir, "output")
+	err = ffmpeg.
+		Input("pipe:", ffmpeg.KwArgs{"noautorotate": ""}).
+		WithInput(inBuf).
+		Output(outPath, outKwargs).
+		Silent(true).
+		Run()
+	if err != nil {
+		return fmt.Errorf("error while transcoding: %s", err.Error())
+	}
+
+	outFile, err := os.Open(outPath)
+	if err != nil {
+		return fmt.Errorf("error while transcoding: %s", err.Error())
+	}
+	defer outFile.Close()
+	_, err = io.Copy(outBuf, outFile)
+	return err
+}
+
 // CompressImage function compress the image stored in inBuf and write the output to outBuf
-// format is one of the following ("mjpeg", "png", "webp")
+// format is one of the following ("mjpeg", "png", "webp", "av1", "tiff")
 // compressionLevel is value between 1-5 where 1 means largest file size and 5 means smallest file size
-func CompressImage(inBuf io.Reader, format string, compressionLevel uint8, outBuf io.Writer) error {
-	// Check format
-	formatFound := false
+// the EXIF orientation is applied before compressing
+func CompressImage(inBuf io.ReadSeeker, format string, compressionLevel uint8, outBuf io.Writer) error {
+	return CompressImageWithOptions(inBuf, format, compressionLevel, EncoderOptions{}, outBuf)
+}
+
+// CompressImageWithOptions function compress the image stored in inBuf like CompressImage
+// then configure the encoder with options, which take precedence over compressionLevel
+// compressionLevel may be 0 when options are set
+func CompressImageWithOptions(inBuf io.ReadSeeker, format string, compressionLevel uint8, options EncoderOptions, outBuf io.Writer) error {
+	// Compress
+	outKwargs := ffmpeg.KwArgs{
+		"f":      "image2",
+		"vcodec": format,
+	}
+	if compressionLevel != 0 || options.IsZero() {
+		if err := setCompressionKwargs(outKwargs, format, compressionLevel); err != nil {
+			return err
+		}
+	} else if !isCompressFormat(format) {
+		return fmt.Errorf("file format %s is not supported", format)
+	}
+
+	orientFilter, _, err := autoOrientFilter(inBuf)
+	if err != nil {
+		return err
+	}
+	if orientFilter != "" {
+		outKwargs["vf"] = orientFilter
+	}
+
+	if err := options.Apply(outKwargs, format); err != nil {
+		return err
+	}
+
+	return runFfmpeg(inBuf, outKwargs, outBuf)
+}
+
+func isCompressFormat(format string) bool {
 	for _, ffmpegFormat := range FfmpegCompressImageFormats {
 		if format == ffmpegFormat {
-			formatFound = true
-			break
+			return true
 		}
 	}
-	if !formatFound {
+	return false
+}
+
+// setCompressionKwargs add the encoder options matching compressionLevel (1-5) for format to outKwargs
+func setCompressionKwargs(outKwargs ffmpeg.KwArgs, format string, compressionLevel uint8) error {
+	// Check format
+	if !isCompressFormat(format) {
 		return fmt.Errorf("file format %s is not supported", format)
 	}
 
@@ -152,12 +579,6 @@ func CompressImage(inBuf io.Reader, format string, compressionLevel uint8, outBu
 		return fmt.Errorf("compression level must between 1 <= level <= 5")
 	}
 
-	// Compress
-	outKwargs := ffmpeg.KwArgs{
-		"f":      "image2",
-		"vcodec": format,
-	}
-
 	if format == "png" {
 		// For PNG we use compression_level that range from 1-9
 		outKwargs["compression_level"] = Mapfloat64(float64(compressionLevel), 1, 5, 1, 9)
@@ -167,17 +588,14 @@ func CompressImage(inBuf io.Reader, format string, compressionLevel uint8, outBu
 	} else if format == "mjpeg" {
 		// For JPEG we use q for quality that range from 1-31
 		outKwargs["q"] = Mapfloat64(float64(compressionLevel), 1, 5, 1, 31)
+	} else if format == "av1" {
+		// For AVIF we use crf that range from 0-63, only 20-50 give sensible images,
+		// lower levels keep more detail so they also get the slower and more thorough cpu-used (0-8)
+		outKwargs["crf"] = math.Round(Mapfloat64(float64(compressionLevel), 1, 5, 20, 50))
+		outKwargs["cpu-used"] = math.Round(Mapfloat64(float64(compressionLevel), 1, 5, 4, 8))
+	} else if format == "tiff" {
+		// For TIFF we use compression_algo, from the fastest packbits to the smallest deflate
+		outKwargs["compression_algo"] = []string{"packbits", "lzw", "lzw", "deflate", "deflate"}[compressionLevel-1]
 	}
-
-	err := ffmpeg.
-		Input("pipe:").
-		WithInput(inBuf).
-		Output("pipe:", outKwargs).
-		WithOutput(outBuf). //, os.Stdout).
-		Silent(true).
-		Run()
-	if err != nil {
-		return fmt.Errorf("error while transcoding: %s", err.Error())
-	}
-	return err
+	return nil
 }
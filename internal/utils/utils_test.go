@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
 func AssertImageSizeEqual(t *testing.T, inBuf io.Reader, width uint16, height uint16) {
@@ -82,6 +83,8 @@ func TestGetImageFormat(t *testing.T) {
 		{"../../test/data/test_1000x1000.jpg", "mjpeg"},
 		{"../../test/data/test_1000x1000.png", "png"},
 		{"../../test/data/test_1000x1000.webp", "webp"},
+		{"../../test/data/test_320x180.avif", "av1"},
+		{"../../test/data/test_100x50_3_pages.tiff", "tiff"},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf(
@@ -107,6 +110,8 @@ func TestGetImageSize(t *testing.T) {
 		{"../../test/data/test_1000x1000.png", 1000, 1000},
 		{"../../test/data/test_1000x625.png", 1000, 625},
 		{"../../test/data/test_625x1000.png", 625, 1000},
+		{"../../test/data/test_320x180.avif", 320, 180},
+		{"../../test/data/test_100x50_3_pages.tiff", 100, 50},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf(
@@ -161,6 +166,95 @@ func TestConvertPngToJpeg(t *testing.T) {
 	}
 }
 
+func TestNormalizeFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{"jpeg", "jpeg"},
+		{"jpg", "jpeg"},
+		{"JPG", "jpeg"},
+		{" PNG ", "png"},
+		{"webp", "webp"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestNormalizeFormat %s",
+			tt.format,
+		), func(t *testing.T) {
+			ans := NormalizeFormat(tt.format)
+			assert.Equal(tt.want, ans, fmt.Sprintf("got %s, want %s", ans, tt.want))
+		})
+	}
+}
+
+func TestConvertFormatMatrix(t *testing.T) {
+	assert := assert.New(t)
+
+	for format, targetFormats := range ConvertFormatMatrix {
+		for _, targetFormat := range targetFormats {
+			_, ok := ConvertImageFormats[targetFormat]
+			assert.True(ok, fmt.Sprintf("%s -> %s: target format has no codec", format, targetFormat))
+			assert.True(CanConvert(format, targetFormat))
+		}
+	}
+	assert.False(CanConvert("mjpeg", "tga"))
+	assert.False(CanConvert("tga", "jpeg"))
+}
+
+func TestConvertImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName     string
+		targetFormat string
+		width        uint16
+		height       uint16
+		wantFormat   string
+		wantError    bool
+	}{
+		{"../../test/data/test_1000x1000.bmp", "jpeg", 1000, 1000, "mjpeg", false},
+		{"../../test/data/test_1000x1000.jpg", "png", 1000, 1000, "png", false},
+		{"../../test/data/test_1000x1000.png", "jpg", 1000, 1000, "mjpeg", false},
+		{"../../test/data/test_1000x1000.png", "webp", 1000, 1000, "webp", false},
+		{"../../test/data/test_1000x1000.webp", "bmp", 1000, 1000, "bmp", false},
+		{"../../test/data/test_1000x1000.webp", "gif", 1000, 1000, "gif", false},
+		{"../../test/data/test_1000x625.png", "webp", 1000, 625, "webp", false},
+		{"../../test/data/test_625x1000.png", "bmp", 625, 1000, "bmp", false},
+		{"../../test/data/test_1000x1000.png", "avif", 1000, 1000, "av1", false},
+		{"../../test/data/test_320x180.avif", "jpeg", 320, 180, "mjpeg", false},
+		{"../../test/data/test_320x180.avif", "AVIF", 320, 180, "av1", false},
+		{"../../test/data/test_1000x1000.jpg", "tif", 1000, 1000, "tiff", false},
+		{"../../test/data/test_100x50_3_pages.tiff", "png", 100, 50, "png", false},
+		{"../../test/data/test_1000x1000.png", "tga", 1000, 1000, "", true},
+		{"../../test/data/test_1000x1000.png", "", 1000, 1000, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestConvertImage %s to %s",
+			tt.fileName, tt.targetFormat,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = ConvertImage(inBuf, tt.targetFormat, outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				outBufReader := bytes.NewReader(outBuf.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.width, tt.height)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.wantFormat)
+			}
+		})
+	}
+}
+
 func TestResizeImage(t *testing.T) {
 	assert := assert.New(t)
 
@@ -195,6 +289,9 @@ func TestResizeImage(t *testing.T) {
 		{"../../test/data/test_1000x1000.webp", "webp", 100, 0, true},
 		{"../../test/data/test_1000x1000.webp", "webp", ResizeMaxWidth + 1, 100, true},
 		{"../../test/data/test_1000x1000.webp", "webp", 100, ResizeMaxHeight + 1, true},
+		{"../../test/data/test_320x180.avif", "av1", 160, 90, false},
+		{"../../test/data/test_100x50_3_pages.tiff", "tiff", 50, 25, false},
+		{"../../test/data/test_320x180.avif", "av1", 0, 90, true},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf(
@@ -220,6 +317,131 @@ func TestResizeImage(t *testing.T) {
 	}
 }
 
+func TestResizeFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		srcWidth   uint16
+		srcHeight  uint16
+		width      uint16
+		height     uint16
+		mode       string
+		background string
+		wantFilter string
+		wantWidth  uint16
+		wantHeight uint16
+		wantError  bool
+	}{
+		{1000, 625, 400, 400, "", "", "scale=400:400", 400, 400, false},
+		{1000, 625, 400, 400, ResizeModeFill, "", "scale=400:400", 400, 400, false},
+		{1000, 625, 500, 0, ResizeModeFill, "", "scale=500:313", 500, 313, false},
+		{1000, 625, 0, 250, ResizeModeFill, "", "scale=400:250", 400, 250, false},
+		{1000, 625, 400, 400, ResizeModeFit, "", "scale=400:250", 400, 250, false},
+		{625, 1000, 400, 400, ResizeModeFit, "", "scale=250:400", 250, 400, false},
+		{1000, 625, 400, 400, ResizeModeCover, "", "crop=625:625,scale=400:400", 400, 400, false},
+		{625, 1000, 400, 200, ResizeModeCover, "", "crop=625:313,scale=400:200", 400, 200, false},
+		{1000, 625, 400, 400, ResizeModePad, "", "scale=400:250,pad=400:400:0:75:color=black", 400, 400, false},
+		{625, 1000, 400, 400, ResizeModePad, "#ff0000", "scale=250:400,pad=400:400:75:0:color=#ff0000", 400, 400, false},
+		{1000, 625, 0, 0, ResizeModeFill, "", "", 0, 0, true},
+		{1000, 625, 400, 400, "stretch", "", "", 0, 0, true},
+		{1000, 625, 400, 400, ResizeModePad, "red,drawtext", "", 0, 0, true},
+		{100, 1000, ResizeMaxWidth, 0, ResizeModeFill, "", "", 0, 0, true},
+		{0, 1000, 400, 400, ResizeModeFill, "", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestResizeFilter %dx%d to %dx%d %s",
+			tt.srcWidth, tt.srcHeight, tt.width, tt.height, tt.mode,
+		), func(t *testing.T) {
+			filter, width, height, err := ResizeFilter(tt.srcWidth, tt.srcHeight, tt.width, tt.height, tt.mode, tt.background)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				assert.Equal(tt.wantFilter, filter)
+				assert.Equal(tt.wantWidth, width, fmt.Sprintf("got width %d, want %d", width, tt.wantWidth))
+				assert.Equal(tt.wantHeight, height, fmt.Sprintf("got height %d, want %d", height, tt.wantHeight))
+			}
+		})
+	}
+}
+
+func TestResizeImageWithMode(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		fileName   string
+		format     string
+		width      uint16
+		height     uint16
+		mode       string
+		wantWidth  uint16
+		wantHeight uint16
+		wantError  bool
+	}{
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModeFill, 400, 400, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModeFit, 400, 250, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModeCover, 400, 400, false},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, ResizeModePad, 400, 400, false},
+		{"../../test/data/test_1000x625.png", "png", 500, 0, ResizeModeFit, 500, 313, false},
+		{"../../test/data/test_625x1000.png", "png", 0, 500, ResizeModeFill, 313, 500, false},
+		{"../../test/data/test_1000x1000.jpg", "mjpeg", 300, 200, ResizeModeCover, 300, 200, false},
+		{"../../test/data/test_1000x1000.webp", "webp", 300, 200, ResizeModePad, 300, 200, false},
+		{"../../test/data/test_1000x1000.bmp", "bmp", 300, 200, ResizeModeFit, 200, 200, false},
+		{"../../test/data/test_1000x625_orientation_6.jpg", "mjpeg", 100, 0, ResizeModeFit, 100, 160, false},
+		{"../../test/data/test_1000x625.png", "png", 0, 0, ResizeModeFit, 0, 0, true},
+		{"../../test/data/test_1000x625.png", "png", 400, 400, "stretch", 0, 0, true},
+		{"../../test/data/test_1000x625.png", "png", ResizeMaxWidth + 1, 0, ResizeModeFit, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestResizeImageWithMode %s %dx%d %s",
+			tt.fileName, tt.width, tt.height, tt.mode,
+		), func(t *testing.T) {
+			inBuf, err := os.Open(tt.fileName)
+			assert.NoError(err, fmt.Sprintf("Failed to open file: %s", tt.fileName))
+			defer inBuf.Close()
+
+			outBuf := bytes.NewBuffer(nil)
+			err = ResizeImageWithMode(inBuf, tt.format, tt.width, tt.height, tt.mode, "", outBuf)
+			assert.Equal(err != nil, tt.wantError, fmt.Sprintf("got %s, want error %t", err, tt.wantError))
+
+			if err == nil {
+				outBufReader := bytes.NewReader(outBuf.Bytes())
+				AssertImageSizeEqual(t, outBufReader, tt.wantWidth, tt.wantHeight)
+
+				outBufReader.Seek(0, 0)
+				AssertImageFormatEqual(t, outBufReader, tt.format)
+			}
+		})
+	}
+}
+
+func TestSetCompressionKwargs(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		format           string
+		compressionLevel uint8
+		key              string
+		value            interface{}
+	}{
+		{"png", 5, "compression_level", 9.0},
+		{"tiff", 1, "compression_algo", "packbits"},
+		{"tiff", 3, "compression_algo", "lzw"},
+		{"tiff", 5, "compression_algo", "deflate"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestSetCompressionKwargs %s,level:%d", tt.format, tt.compressionLevel), func(t *testing.T) {
+			outKwargs := ffmpeg.KwArgs{}
+			assert.NoError(setCompressionKwargs(outKwargs, tt.format, tt.compressionLevel))
+			assert.Equal(tt.value, outKwargs[tt.key])
+		})
+	}
+
+	assert.Error(setCompressionKwargs(ffmpeg.KwArgs{}, "bmp", 3))
+	assert.Error(setCompressionKwargs(ffmpeg.KwArgs{}, "tiff", 6))
+}
+
 func TestCompressImage(t *testing.T) {
 	assert := assert.New(t)
 
@@ -264,6 +486,7 @@ func TestCompressImage(t *testing.T) {
 		{"../../test/data/test_1000x1000.jpg", 1000, 1000, "mjpeg"},
 		{"../../test/data/test_1000x1000.png", 1000, 1000, "png"},
 		{"../../test/data/test_1000x1000.webp", 1000, 1000, "webp"},
+		{"../../test/data/test_320x180.avif", 320, 180, "av1"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,111 @@
+// Package urlsign sign and verify the URLs of the GET /img transformation route
+// so only URLs generated by holders of the shared secret are processed
+//
+// The signature is the unpadded base64url encoded HMAC-SHA256 of the path after /img
+// ("/{options}/{source}") and the expiry timestamp, sent in the signature and expires query parameters:
+//
+//	/img/rs:fit:300:200,f:webp/products/shoe.png?expires=1767225600&signature=...
+//
+// The destination=bucket/key of the processing routes is signed the same way over DestinationPath(destination),
+// sent in the destination_signature and destination_expires form fields
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters holding the signature and the expiry unix timestamp
+const (
+	SignatureParam = "signature"
+	ExpiresParam   = "expires"
+)
+
+// Form fields holding the signature and the expiry unix timestamp of a destination
+const (
+	DestinationSignatureField = "destination_signature"
+	DestinationExpiresField   = "destination_expires"
+)
+
+var (
+	ErrMissingSignature = errors.New("signature is missing")
+	ErrInvalidSignature = errors.New("signature is invalid")
+	ErrInvalidExpires   = errors.New("expires must be a unix timestamp")
+	ErrExpired          = errors.New("signature has expired")
+)
+
+// Sign return the signature of path ("/{options}/{source}") valid until expires
+// expires is a unix timestamp, 0 means the signature never expire
+func Sign(secret []byte, path string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify check signature and expires (as found in the query parameters, expires may be empty) against path at now
+func Verify(secret []byte, path string, expires string, signature string, now time.Time) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+
+	var expiresAt int64
+	if expires != "" {
+		var err error
+		expiresAt, err = strconv.ParseInt(expires, 10, 64)
+		if err != nil || expiresAt <= 0 {
+			return ErrInvalidExpires
+		}
+	}
+
+	want := Sign(secret, path, expiresAt)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if expiresAt != 0 && now.Unix() > expiresAt {
+		return ErrExpired
+	}
+	return nil
+}
+
+// DestinationPath return the path signed for destination (bucket/key), it never start with "/"
+// so the signature of a GET /img path can't be used as the signature of a destination
+func DestinationPath(destination string) string {
+	return "destination:" + destination
+}
+
+// URL build the signed URL of source transformed with options
+// baseURL is the address of the route, e.g. "https://images.example.com/img"
+// expires is the zero time for URLs that never expire
+func URL(baseURL string, secret []byte, options string, source string, expires time.Time) string {
+	source = strings.TrimPrefix(source, "/")
+	path := "/" + options + "/" + source
+
+	var expiresAt int64
+	if !expires.IsZero() {
+		expiresAt = expires.Unix()
+	}
+
+	// Escape each segment so the service decode back the signed path
+	segments := strings.Split(source, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	query := url.Values{}
+	if expiresAt != 0 {
+		query.Set(ExpiresParam, strconv.FormatInt(expiresAt, 10))
+	}
+	query.Set(SignatureParam, Sign(secret, path, expiresAt))
+
+	return strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(options) + "/" +
+		strings.Join(segments, "/") + "?" + query.Encode()
+}
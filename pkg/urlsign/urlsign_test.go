@@ -0,0 +1,86 @@
+package urlsign
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	path := "/rs:fit:300:200,f:webp/products/shoe.png"
+
+	var tests = []struct {
+		name      string
+		path      string
+		expires   string
+		signature string
+		wantError error
+	}{
+		{"valid without expiry", path, "", Sign(secret, path, 0), nil},
+		{"valid with expiry", path, "1700000060", Sign(secret, path, 1700000060), nil},
+		{"expired", path, "1699999999", Sign(secret, path, 1699999999), ErrExpired},
+		{"missing signature", path, "", "", ErrMissingSignature},
+		{"other path", "/rs:fit:3000:2000,f:webp/products/shoe.png", "", Sign(secret, path, 0), ErrInvalidSignature},
+		{"other secret", path, "", Sign([]byte("other"), path, 0), ErrInvalidSignature},
+		{"destination", DestinationPath("products/shoe.png"), "", Sign(secret, DestinationPath("products/shoe.png"), 0), nil},
+		{"path as destination", DestinationPath(path[1:]), "", Sign(secret, path, 0), ErrInvalidSignature},
+		{"expiry removed", path, "", Sign(secret, path, 1700000060), ErrInvalidSignature},
+		{"expiry extended", path, "1800000000", Sign(secret, path, 1700000060), ErrInvalidSignature},
+		{"invalid expiry", path, "tomorrow", Sign(secret, path, 0), ErrInvalidExpires},
+		{"negative expiry", path, "-1", Sign(secret, path, -1), ErrInvalidExpires},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestVerify %s",
+			tt.name,
+		), func(t *testing.T) {
+			err := Verify(secret, tt.path, tt.expires, tt.signature, now)
+			assert.Equal(tt.wantError, err)
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := []byte("secret")
+	expires := time.Unix(1700000060, 0)
+
+	var tests = []struct {
+		baseURL  string
+		options  string
+		source   string
+		expires  time.Time
+		wantPath string
+	}{
+		{"https://images.example.com/img", "w:300", "shoe.png", time.Time{}, "/img/w:300/shoe.png"},
+		{"https://images.example.com/img/", "rs:fit:300:200,f:webp", "/products/shoe.png", expires, "/img/rs:fit:300:200,f:webp/products/shoe.png"},
+		{"http://localhost:8000/img", "-", "products/red shoe?.png", expires, "/img/-/products/red shoe?.png"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestURL %s %s",
+			tt.options, tt.source,
+		), func(t *testing.T) {
+			signedURL := URL(tt.baseURL, secret, tt.options, tt.source, tt.expires)
+			assert.True(strings.HasPrefix(signedURL, strings.TrimSuffix(tt.baseURL, "/")+"/"), signedURL)
+
+			// The service see the decoded path
+			parsedURL, err := url.Parse(signedURL)
+			assert.NoError(err)
+			assert.Equal(tt.wantPath, parsedURL.Path)
+
+			query := parsedURL.Query()
+			err = Verify(secret, strings.TrimPrefix(parsedURL.Path, "/img"), query.Get(ExpiresParam), query.Get(SignatureParam), time.Unix(1700000000, 0))
+			assert.NoError(err)
+		})
+	}
+}
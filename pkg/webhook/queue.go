@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the maximum number of pending deliveries is reached
+	ErrQueueFull = errors.New("callback queue is full")
+	// ErrQueueClosed is returned by Enqueue after Close
+	ErrQueueClosed = errors.New("callback queue is closed")
+)
+
+type delivery struct {
+	url     string
+	payload interface{}
+	done    func(error)
+}
+
+// Queue deliver payloads in the background with a Sender and a fixed number of workers,
+// so that the retries of slow receivers don't pile up goroutines
+type Queue struct {
+	sender  *Sender
+	mu      sync.Mutex
+	pending chan delivery
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewQueue start workers goroutines delivering the enqueued payloads with sender
+// at most capacity deliveries may wait for a worker
+func NewQueue(sender *Sender, workers int, capacity int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 0 {
+		capacity = 0
+	}
+	queue := &Queue{
+		sender:  sender,
+		pending: make(chan delivery, capacity),
+	}
+	queue.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	return queue
+}
+
+// Enqueue schedule the delivery of payload to url, done (when not nil) is called with the result of Sender.Send
+// it doesn't block: ErrQueueFull is returned when every worker is busy and capacity deliveries are waiting
+func (queue *Queue) Enqueue(url string, payload interface{}, done func(error)) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if queue.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case queue.pending <- delivery{url: url, payload: payload, done: done}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stop accepting deliveries and wait for the queued ones to finish
+func (queue *Queue) Close() {
+	queue.mu.Lock()
+	if queue.closed {
+		queue.mu.Unlock()
+		return
+	}
+	queue.closed = true
+	close(queue.pending)
+	queue.mu.Unlock()
+
+	queue.wg.Wait()
+}
+
+func (queue *Queue) work() {
+	defer queue.wg.Done()
+	for delivery := range queue.pending {
+		err := queue.sender.Send(context.Background(), delivery.url, delivery.payload)
+		if delivery.done != nil {
+			delivery.done(err)
+		}
+	}
+}
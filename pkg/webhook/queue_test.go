@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer receiver.Close()
+
+	queue := NewQueue(&Sender{}, 2, 10)
+	var mu sync.Mutex
+	results := map[string]error{}
+	for _, path := range []string{"/ok", "/fail"} {
+		path := path
+		assert.NoError(queue.Enqueue(receiver.URL+path, map[string]string{}, func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[path] = err
+		}))
+	}
+	queue.Close()
+
+	assert.Len(results, 2)
+	assert.NoError(results["/ok"])
+	assert.Error(results["/fail"])
+
+	assert.ErrorIs(queue.Enqueue(receiver.URL, map[string]string{}, nil), ErrQueueClosed)
+}
+
+func TestQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+	}))
+	defer receiver.Close()
+
+	// The first delivery occupy the worker, the second one the queue
+	queue := NewQueue(&Sender{Client: &http.Client{Timeout: 10 * time.Second}}, 1, 1)
+	assert.NoError(queue.Enqueue(receiver.URL, map[string]string{}, nil))
+	<-started
+	assert.NoError(queue.Enqueue(receiver.URL, map[string]string{}, nil))
+	assert.ErrorIs(queue.Enqueue(receiver.URL, map[string]string{}, nil), ErrQueueFull)
+
+	close(release)
+	queue.Close()
+}
@@ -0,0 +1,154 @@
+// Package webhook sign and deliver the JSON callbacks sent by the image converter API
+// and let receivers verify them
+//
+// The signature is the hex encoded HMAC-SHA256 of "<timestamp>.<body>" computed with the shared secret,
+// it is sent in the SignatureHeader header and the unix timestamp in the TimestampHeader header.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rudcode/go_image_converter_api/internal/fetch"
+)
+
+const (
+	// SignatureHeader is the header holding the signature of the payload
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader is the header holding the unix timestamp the payload was signed at
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	ErrExpired          = errors.New("signature expired")
+)
+
+// Sign return the signature of body sent at timestamp
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify check the signature and timestamp headers of a received callback
+// callbacks signed more than tolerance before or after now are rejected, a zero tolerance disable the check
+func Verify(secret []byte, timestamp string, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, signedAt, body))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(signedAt, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrExpired
+		}
+	}
+	return nil
+}
+
+// Sender POST signed JSON payloads, retrying with exponential backoff
+type Sender struct {
+	// Client is the HTTP client used for the deliveries, http.DefaultClient when nil
+	Client *http.Client
+	// Secret sign the payloads, they are sent unsigned when empty
+	Secret []byte
+	// MaxAttempts is the number of deliveries tried before giving up, 1 when < 1
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles after each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Send POST payload encoded as JSON to url until the receiver answers with a 2xx status
+// network errors, 429 and 5xx responses are retried, blocked addresses, invalid URLs and other responses are final
+func (sender *Sender) Send(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := sender.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	attempts := sender.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	backoff := sender.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := sender.deliver(ctx, client, url, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			return fmt.Errorf("delivery failed after %d attempt(s): %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if sender.MaxBackoff > 0 && backoff > sender.MaxBackoff {
+			backoff = sender.MaxBackoff
+		}
+	}
+}
+
+// deliver make a single delivery attempt and report whether it may be retried
+func (sender *Sender) deliver(ctx context.Context, client *http.Client, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || req.URL.Host == "" {
+		return false, fmt.Errorf("%w: %s", fetch.ErrInvalidURL, url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(sender.Secret) > 0 {
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(sender.Secret, timestamp, body))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// The address is refused by the dialer of fetch.NewClient on every attempt
+		if errors.Is(err, fetch.ErrBlockedAddress) {
+			return false, err
+		}
+		return ctx.Err() == nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("receiver answered %s", res.Status)
+}
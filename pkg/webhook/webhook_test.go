@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rudcode/go_image_converter_api/internal/fetch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"job_id":"1","status":"succeeded"}`)
+
+	var tests = []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantError error
+	}{
+		{"valid", "1700000000", Sign(secret, 1700000000, body), body, nil},
+		{"valid within tolerance", "1699999800", Sign(secret, 1699999800, body), body, nil},
+		{"too old", "1699999000", Sign(secret, 1699999000, body), body, ErrExpired},
+		{"in the future", "1700001000", Sign(secret, 1700001000, body), body, ErrExpired},
+		{"missing signature", "1700000000", "", body, ErrMissingSignature},
+		{"invalid timestamp", "now", Sign(secret, 1700000000, body), body, ErrInvalidTimestamp},
+		{"other timestamp", "1700000001", Sign(secret, 1700000000, body), body, ErrInvalidSignature},
+		{"other body", "1700000000", Sign(secret, 1700000000, body), []byte(`{"job_id":"1","status":"failed"}`), ErrInvalidSignature},
+		{"other secret", "1700000000", Sign([]byte("other"), 1700000000, body), body, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestVerify %s",
+			tt.name,
+		), func(t *testing.T) {
+			err := Verify(secret, tt.timestamp, tt.signature, tt.body, now, 5*time.Minute)
+			assert.Equal(tt.wantError, err)
+		})
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := []byte("secret")
+	payload := map[string]string{"job_id": "1", "status": "succeeded"}
+
+	var tests = []struct {
+		name         string
+		statuses     []int // answered in order, the last one is repeated
+		maxAttempts  int
+		wantAttempts int
+		wantError    bool
+	}{
+		{"delivered", []int{http.StatusOK}, 3, 1, false},
+		{"retried after server errors", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent}, 3, 3, false},
+		{"retried after too many requests", []int{http.StatusTooManyRequests, http.StatusOK}, 3, 2, false},
+		{"gave up", []int{http.StatusServiceUnavailable}, 3, 3, true},
+		{"not retried after client error", []int{http.StatusBadRequest, http.StatusOK}, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf(
+			"TestSenderSend %s",
+			tt.name,
+		), func(t *testing.T) {
+			var mu sync.Mutex
+			var attempts []time.Time
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(http.MethodPost, r.Method)
+				assert.Equal("application/json", r.Header.Get("Content-Type"))
+				assert.JSONEq(`{"job_id":"1","status":"succeeded"}`, string(body))
+				assert.NoError(Verify(secret, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), body, time.Now(), time.Minute))
+
+				mu.Lock()
+				attempts = append(attempts, time.Now())
+				status := tt.statuses[min(len(attempts), len(tt.statuses))-1]
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			defer receiver.Close()
+
+			sender := &Sender{
+				Secret:      secret,
+				MaxAttempts: tt.maxAttempts,
+				Backoff:     10 * time.Millisecond,
+				MaxBackoff:  15 * time.Millisecond,
+			}
+			err := sender.Send(context.Background(), receiver.URL, payload)
+			assert.Equal(tt.wantError, err != nil, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Len(attempts, tt.wantAttempts)
+			// Backoff between attempts: 10ms then capped to 15ms
+			for i := 1; i < len(attempts); i++ {
+				assert.GreaterOrEqual(attempts[i].Sub(attempts[i-1]), 10*time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestSenderSendUnsigned(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(r.Header.Get(SignatureHeader))
+		assert.Empty(r.Header.Get(TimestampHeader))
+	}))
+	defer receiver.Close()
+
+	sender := &Sender{}
+	assert.NoError(sender.Send(context.Background(), receiver.URL, map[string]string{}))
+}
+
+func TestSenderSendCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sender := &Sender{MaxAttempts: 10, Backoff: time.Hour}
+	start := time.Now()
+	err := sender.Send(ctx, receiver.URL, map[string]string{})
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Less(time.Since(start), time.Second)
+}
+
+func TestSenderSendFinal(t *testing.T) {
+	assert := assert.New(t)
+
+	// The receiver is on loopback, refused by a client without allowlist
+	var mu sync.Mutex
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+	}))
+	defer receiver.Close()
+
+	var tests = []struct {
+		url       string
+		wantError error
+	}{
+		{receiver.URL, fetch.ErrBlockedAddress},
+		{"ftp://example.com/callback", fetch.ErrInvalidURL},
+		{"/callback", fetch.ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("TestSenderSendFinal %s", tt.url), func(t *testing.T) {
+			sender := &Sender{Client: fetch.NewClient(nil, time.Second), MaxAttempts: 5, Backoff: time.Hour}
+			start := time.Now()
+			err := sender.Send(context.Background(), tt.url, map[string]string{})
+			assert.ErrorIs(err, tt.wantError)
+			assert.ErrorContains(err, "after 1 attempt(s)")
+			assert.Less(time.Since(start), time.Second)
+		})
+	}
+	assert.Zero(attempts)
+}